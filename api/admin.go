@@ -0,0 +1,61 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"signing-service/config"
+	"strings"
+)
+
+// AdminTokenEnv is the environment variable holding the admin token.
+// It takes precedence over the configured token file.
+const AdminTokenEnv = "SIGNING_SERVICE_ADMIN_TOKEN"
+
+// MinAdminTokenLength is the length an admin token needs at least
+const MinAdminTokenLength = 32
+
+// LoadAdminToken reads the bearer token of the admin endpoints from AdminTokenEnv or the
+// configured token file. Without a token the admin endpoints stay disabled.
+func (s *Server) LoadAdminToken(adminConfig config.AdminConfig) error {
+	token := os.Getenv(AdminTokenEnv)
+	if token == "" && adminConfig.TokenFile != "" {
+		tokenBytes, err := ioutil.ReadFile(adminConfig.TokenFile)
+		if err != nil {
+			return fmt.Errorf("cannot read admin token file %s: %w", adminConfig.TokenFile, err)
+		}
+		token = string(tokenBytes)
+	}
+
+	token = strings.TrimSpace(token)
+	if token != "" && len(token) < MinAdminTokenLength {
+		return fmt.Errorf("admin token must have at least %d characters", MinAdminTokenLength)
+	}
+
+	s.adminToken = []byte(token)
+	return nil
+}
+
+// authorizeAdmin checks the bearer token of an admin request. If it does not match, the
+// error response is written and false returned.
+func (s *Server) authorizeAdmin(response http.ResponseWriter, request *http.Request) bool {
+	if len(s.adminToken) == 0 {
+		WriteErrorResponse(response, http.StatusForbidden, []string{
+			"admin endpoints are disabled, no admin token is configured",
+		})
+		return false
+	}
+
+	token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), s.adminToken) != 1 {
+		response.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		WriteErrorResponse(response, http.StatusUnauthorized, []string{
+			http.StatusText(http.StatusUnauthorized),
+		})
+		return false
+	}
+
+	return true
+}
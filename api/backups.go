@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"signing-service/domain"
+	"signing-service/logger"
+	"signing-service/service"
+
+	"github.com/go-playground/validator"
+)
+
+// swagger:route POST devices/{id}/backup
+// Export an encrypted backup of the device record, private key, signature counter and last signature
+//
+// Admin only, the request needs the admin bearer token. The backup is encrypted with
+// password or for recipient_public_key, a PEM encoded RSA or EC public key. It is
+// returned as a JSON document to be passed to device/RestoreSignatureDevice.
+//
+// responses:
+//
+//	405: Method not allowed
+//	403: Forbidden
+//	401: Unauthorized
+//	404: Not Found
+//	400: Bad Request
+//	200: Success
+func (s *Server) Backup(response http.ResponseWriter, request *http.Request, id string) {
+
+	if request.Method != http.MethodPost {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	if !s.authorizeAdmin(response, request) {
+		return
+	}
+
+	var backupPayload domain.BackupPayload
+	if err := json.NewDecoder(request.Body).Decode(&backupPayload); err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
+		})
+		return
+	}
+
+	validate := validator.New()
+	if validationErr := validate.Struct(backupPayload); validationErr != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			validationErr.Error(),
+		})
+		return
+	}
+	if backupPayload.Password != "" && backupPayload.RecipientPublicKey != "" {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"either password or recipient_public_key encrypts the backup, not both",
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	envelope, err := deviceService.ExportDeviceBackup(id, backupPayload)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	backup, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		WriteInternalError(response)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Header().Set("Content-Disposition", `attachment; filename="`+id+`.backup.json"`)
+	response.WriteHeader(http.StatusOK)
+	response.Write(backup)
+}
+
+// swagger:route POST device/RestoreSignatureDevice
+// Restore a device from an encrypted backup
+//
+// Admin only, the request needs the admin bearer token. The backup is decrypted with
+// password or with private_key, the PEM encoded recipient private key. A missing device
+// is created, a live device is replaced unless the backup is behind its signature chain
+// or the device is retired. The live device keeps its state.
+//
+// responses:
+//
+//	405: Method not allowed
+//	403: Forbidden
+//	401: Unauthorized
+//	409: Conflict
+//	400: Bad Request
+//	200: Success
+func (s *Server) RestoreBackup(response http.ResponseWriter, request *http.Request) {
+
+	if request.Method != http.MethodPost {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	if !s.authorizeAdmin(response, request) {
+		return
+	}
+
+	var restoreBackupPayload domain.RestoreBackupPayload
+	if err := json.NewDecoder(request.Body).Decode(&restoreBackupPayload); err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
+		})
+		return
+	}
+
+	validate := validator.New()
+	if validationErr := validate.Struct(restoreBackupPayload); validationErr != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			validationErr.Error(),
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	deviceResponse, err := deviceService.RestoreDeviceBackup(restoreBackupPayload)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, DeviceResponse(*deviceResponse))
+}
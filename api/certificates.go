@@ -0,0 +1,237 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"signing-service/domain"
+	"signing-service/logger"
+	"signing-service/service"
+	"strings"
+
+	"github.com/go-playground/validator"
+)
+
+// MaxCertificateChainSize is the largest PEM certificate chain accepted for upload, in bytes
+const MaxCertificateChainSize = 1 << 20
+
+type CertificateChainResponse service.CertificateChainResponse
+type CertificateRequestResponse service.CertificateRequestResponse
+
+// swagger:route GET devices/{id}/certificate
+// Get the device certificate chain, issued by the local CA or uploaded
+//
+// The chain starts with the device certificate and ends with the root. With
+// format=pem or the Accept header application/pem-certificate-chain it is
+// returned as concatenated PEM certificates.
+//
+// responses:
+//
+//	405: Method not allowed
+//	404: Not Found
+//	409: Conflict
+//	400: Bad Request
+//	200: Success
+func (s *Server) Certificate(response http.ResponseWriter, request *http.Request, id string) {
+
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	certificateChainResponse, err := deviceService.GetDeviceCertificateChain(id)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	accept := request.Header.Get("Accept")
+	switch format := request.URL.Query().Get("format"); {
+	case format == "pem" || (format == "" && strings.Contains(accept, "application/pem-certificate-chain")):
+		response.Header().Set("Content-Type", "application/pem-certificate-chain")
+		response.WriteHeader(http.StatusOK)
+		response.Write(certificateChainResponse.PEM())
+	case format == "":
+		WriteAPIResponse(response, http.StatusOK, CertificateChainResponse(*certificateChainResponse))
+	default:
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"unsupported certificate format " + format,
+		})
+	}
+}
+
+// swagger:route GET ca/certificate
+// Get the PEM encoded root certificate of the local CA, the trust anchor of all device certificates
+//
+// responses:
+//
+//	405: Method not allowed
+//	200: Success
+func (s *Server) CACertificate(response http.ResponseWriter, request *http.Request) {
+
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	if service.Authority == nil {
+		WriteInternalError(response)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/x-pem-file")
+	response.WriteHeader(http.StatusOK)
+	response.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: service.Authority.Root.Raw}))
+}
+
+// swagger:route GET ca/crl
+// Get the CRL of the local CA, revoking the certificates of retired devices
+//
+// The CRL is DER encoded (application/pkix-crl), format=pem returns it PEM encoded.
+//
+// responses:
+//
+//	405: Method not allowed
+//	400: Bad Request
+//	200: Success
+func (s *Server) CRL(response http.ResponseWriter, request *http.Request) {
+
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	format := request.URL.Query().Get("format")
+	if format != "" && format != "der" && format != "pem" {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"unsupported CRL format " + format,
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	crl, err := deviceService.GetCRL()
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	if format == "pem" {
+		response.Header().Set("Content-Type", "application/x-pem-file")
+		response.WriteHeader(http.StatusOK)
+		response.Write(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl}))
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/pkix-crl")
+	response.WriteHeader(http.StatusOK)
+	response.Write(crl)
+}
+
+// swagger:route PUT devices/{id}/certificate
+// Upload the certificate chain issued by an external CA for the device key
+//
+// The request body is the PEM encoded chain, device certificate first, followed
+// by the issuing CA certificates. It replaces the chain of the local CA.
+//
+// responses:
+//
+//	405: Method not allowed
+//	413: Request Entity Too Large
+//	409: Conflict
+//	404: Not Found
+//	400: Bad Request
+//	200: Success
+func (s *Server) UploadCertificate(response http.ResponseWriter, request *http.Request, id string) {
+
+	if request.Method != http.MethodPut {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	chainPEM, err := ioutil.ReadAll(http.MaxBytesReader(response, request.Body, MaxCertificateChainSize))
+	if err != nil {
+		WriteErrorResponse(response, http.StatusRequestEntityTooLarge, []string{
+			err.Error(),
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	certificateChainResponse, err := deviceService.UploadCertificateChain(id, chainPEM)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, CertificateChainResponse(*certificateChainResponse))
+}
+
+// swagger:route POST devices/{id}/csr
+// Create a PKCS#10 certificate request signed by the device key
+//
+// The request body sets the subject and subject alternative names. With the
+// Accept header application/pkcs10 the bare DER encoded request is returned.
+//
+// responses:
+//
+//	405: Method not allowed
+//	409: Conflict
+//	404: Not Found
+//	400: Bad Request
+//	200: Success
+func (s *Server) CertificateRequest(response http.ResponseWriter, request *http.Request, id string) {
+
+	if request.Method != http.MethodPost {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	var certificateRequestPayload domain.CertificateRequestPayload
+	if err := json.NewDecoder(request.Body).Decode(&certificateRequestPayload); err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
+		})
+		return
+	}
+
+	validate := validator.New()
+	if validationErr := validate.Struct(certificateRequestPayload); validationErr != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			validationErr.Error(),
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	certificateRequestResponse, err := deviceService.CreateCertificateRequest(id, certificateRequestPayload)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	if strings.Contains(request.Header.Get("Accept"), "application/pkcs10") {
+		response.Header().Set("Content-Type", "application/pkcs10")
+		response.WriteHeader(http.StatusOK)
+		response.Write(certificateRequestResponse.CSRDER)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, CertificateRequestResponse(*certificateRequestResponse))
+}
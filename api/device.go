@@ -1,14 +1,9 @@
 package api
 
 import (
-	"crypto"
-	"crypto/ecdsa"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"signing-service/domain"
@@ -16,28 +11,25 @@ import (
 	"signing-service/persistence"
 	"signing-service/service"
 	"signing-service/signingCrypto"
-	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator"
 )
 
-var DevicePayload domain.DevicePayload
-var DeviceInfo *persistence.DeviceInfo
-var SignTransactionPayload domain.SignTransactionPayload
-
 type ALGORITHM int
 
 const (
-	ECC ALGORITHM = 1
-	RSA ALGORITHM = 2
+	ECC     ALGORITHM = 1
+	RSA     ALGORITHM = 2
+	ED25519 ALGORITHM = 3
 )
 
 type CreateSignatureDeviceResponse service.CreateSignatureDeviceResponse
 type SignatureResponse service.SignatureResponse
+type VerifySignatureResponse service.VerifySignatureResponse
 type RSAKeyPair signingCrypto.RSAKeyPair
 type ECCKeyPair signingCrypto.ECCKeyPair
-
-var ECCKeyGeneratorService signingCrypto.ECCGenerator
+type Ed25519KeyPair signingCrypto.Ed25519KeyPair
 
 // swagger:route POST device/CreateSignatureDevice
 // Create new signature device
@@ -46,6 +38,7 @@ var ECCKeyGeneratorService signingCrypto.ECCGenerator
 //
 //	 405: Method not allowed
 //		400: Bad Request
+//		500: Internal Server Error
 //		200: Success
 //		201: Created
 func (s *Server) CreateSignatureDevice(response http.ResponseWriter, request *http.Request) {
@@ -64,28 +57,31 @@ func (s *Server) CreateSignatureDevice(response http.ResponseWriter, request *ht
 			err.Error(),
 		})
 	} else {
-		json.Unmarshal(reqBody, &DevicePayload)
+		var devicePayload domain.DevicePayload
+		json.Unmarshal(reqBody, &devicePayload)
 
 		deviceService := service.NewService(logger.Logger)
 
 		validate := validator.New()
 		//validate request payload
-		if validationErr := validate.Struct(DevicePayload); validationErr != nil {
+		if validationErr := validate.Struct(devicePayload); validationErr != nil {
 			WriteErrorResponse(response, http.StatusBadRequest, []string{
 				validationErr.Error(),
 			})
 		} else {
 
-			id := DevicePayload.Id
+			id := devicePayload.Id
 			//Check Requested device already exist or not
 			storedDevice, storedErr := deviceService.GetSignatureDeviceInfo(id)
-			if storedErr != nil && storedDevice == nil {
-				deviceInfo := DeviceInfo
-				deviceInfo = new(persistence.DeviceInfo)
+			if errors.Is(storedErr, persistence.ErrDeviceNotFound) {
+				deviceInfo := new(persistence.DeviceInfo)
 
-				deviceInfo.Id = DevicePayload.Id
-				deviceInfo.Algorithm = DevicePayload.Algorithm
-				deviceInfo.Label = DevicePayload.Label
+				deviceInfo.Id = devicePayload.Id
+				deviceInfo.Algorithm = devicePayload.Algorithm
+				deviceInfo.Label = devicePayload.Label
+				deviceInfo.Tenant = devicePayload.Tenant
+				deviceInfo.State = devicePayload.State
+				deviceInfo.KeyParameters = devicePayload.KeyParameters
 
 				//Will check key found or not
 				err := deviceService.CreateSignatureDevice(deviceInfo)
@@ -100,21 +96,18 @@ func (s *Server) CreateSignatureDevice(response http.ResponseWriter, request *ht
 						"Device Creation Failed, " + err.Error(),
 					})
 				}
+			} else if storedErr != nil {
+				//The stored device could not be read, creating it again would replace its key
+				WriteErrorResponse(response, http.StatusInternalServerError, []string{
+					"Device Info not parse, might be database issues",
+				})
 			} else {
-				if storedDevice == nil {
-					WriteErrorResponse(response, http.StatusBadRequest, []string{
-						"Device Info not parse, might be database issues",
-					})
-				} else {
-
-					//device already stored, just return device id
-					createSignatureDevice := CreateSignatureDeviceResponse{
-						DeviceId: storedDevice.Id,
-						Message:  "Already created",
-					}
-					WriteAPIResponse(response, http.StatusOK, createSignatureDevice)
+				//device already stored, just return device id
+				createSignatureDevice := CreateSignatureDeviceResponse{
+					DeviceId: storedDevice.Id,
+					Message:  "Already created",
 				}
-
+				WriteAPIResponse(response, http.StatusOK, createSignatureDevice)
 			}
 
 		}
@@ -122,6 +115,61 @@ func (s *Server) CreateSignatureDevice(response http.ResponseWriter, request *ht
 
 }
 
+// swagger:route POST device/ImportSignatureDevice
+// Import a signature device with the private key of another signing provider
+//
+// The PEM encoded PKCS#8, PKCS#1 or SEC1 private key may be password encrypted. The
+// device signature chain continues after signature_counter and last_signature, the
+// last link signed by the other provider.
+//
+// responses:
+//
+//	405: Method not allowed
+//	409: Conflict
+//	400: Bad Request
+//	201: Created
+func (s *Server) ImportSignatureDevice(response http.ResponseWriter, request *http.Request) {
+
+	if request.Method != http.MethodPost {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	var importDevicePayload domain.ImportDevicePayload
+	if err := json.NewDecoder(request.Body).Decode(&importDevicePayload); err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
+		})
+		return
+	}
+
+	validate := validator.New()
+	if validationErr := validate.Struct(importDevicePayload); validationErr != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			validationErr.Error(),
+		})
+		return
+	}
+	if importDevicePayload.SignatureCounter == 0 && importDevicePayload.LastSignature != "" {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"last_signature requires the signature_counter it was signed at",
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	deviceResponse, err := deviceService.ImportSignatureDevice(importDevicePayload)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusCreated, DeviceResponse(*deviceResponse))
+}
+
 // "signature": <signature_base64_encoded>,
 // "signed_data": "<signature_counter>_<data_to_be_signed>_<last_signature_base64_encoded>"
 /*For the signature creation, the client will have to provide data_to_be_signed through the API. In order to increase the security of the system, we will extend this raw data with the current signature_counter and the last_signature.
@@ -147,57 +195,35 @@ func (s *Server) SignTransaction(response http.ResponseWriter, request *http.Req
 
 	reqBody, err := ioutil.ReadAll(request.Body)
 	if err == nil {
-		json.Unmarshal(reqBody, &SignTransactionPayload)
+		var signTransactionPayload domain.SignTransactionPayload
+		json.Unmarshal(reqBody, &signTransactionPayload)
 
 		deviceService := service.NewService(logger.Logger)
 
 		validate := validator.New()
 		//validate request payload
-		if validationErr := validate.Struct(SignTransactionPayload); validationErr != nil {
+		if validationErr := validate.Struct(signTransactionPayload); validationErr != nil {
 			WriteErrorResponse(response, http.StatusBadRequest, []string{
 				validationErr.Error(),
 			})
 		} else {
-			//Valid request found
-			id := SignTransactionPayload.DeviceId
-			//Check Requested device already exist or not
-			storedDevice, storedErr := deviceService.GetSignatureDeviceInfo(id)
-			if storedDevice != nil {
-
-				//Get device signature counter
-				signatureCounter := deviceService.GetSignatureCounter()
-				signatureCounter++
-
-				last_signature_base64_encoded := deviceService.GetLastSignatureBase64()
-
-				if last_signature_base64_encoded == "" {
-					//Use device id base64 as last signature device
-					last_signature_base64_encoded = base64.StdEncoding.EncodeToString([]byte(id))
-				}
-
-				signature_byte, err := GetSignatureByte(storedDevice)
-
-				if err != nil {
-					WriteErrorResponse(response, http.StatusBadRequest, []string{
-						err.Error(),
-					})
-				}
-				signature_base64 := base64.StdEncoding.EncodeToString([]byte(signature_byte))
-				signatureResponse := SignatureResponse{
-					Signature:   signature_base64,
-					Signed_Data: strconv.Itoa(signatureCounter) + "_" + SignTransactionPayload.Data + "_" + last_signature_base64_encoded,
-					Message:     "Data Signature Successfully",
-				}
-				//Update signature counter, last_signature_base6
-				UpdateLastSignatureInformation(deviceService, signatureCounter, signature_base64)
-				WriteAPIResponse(response, http.StatusOK, signatureResponse)
+			//Valid request found, sign and advance the device signature chain
+			signatureResponse, err := deviceService.SignTransaction(signTransactionPayload.DeviceId, signTransactionPayload.Data, signTransactionPayload.Format)
+			if err != nil {
+				//Device not registered, not active or signing failed
+				WriteServiceError(response, err)
+				return
+			}
 
-			} else {
-				//Device not registered
-				WriteErrorResponse(response, http.StatusBadRequest, []string{
-					storedErr.Error(),
-				})
+			//Constrained clients may ask for the bare COSE_Sign1 message
+			if signatureResponse.COSE != nil && strings.Contains(request.Header.Get("Accept"), "application/cose") {
+				response.Header().Set("Content-Type", `application/cose; cose-type="cose-sign1"`)
+				response.WriteHeader(http.StatusOK)
+				response.Write(signatureResponse.COSE)
+				return
 			}
+
+			WriteAPIResponse(response, http.StatusOK, SignatureResponse(*signatureResponse))
 		}
 
 	} else {
@@ -207,54 +233,88 @@ func (s *Server) SignTransaction(response http.ResponseWriter, request *http.Req
 	}
 }
 
-func UpdateLastSignatureInformation(service *service.Service, signatureCounter int, last_signature_base64_encoded string) {
-	service.SaveSignatureCounter(signatureCounter)
-	service.SaveLastSignatureBase64(last_signature_base64_encoded)
-}
+// swagger:route POST device/VerifySignature
+// Verify a signature or COSE_Sign1 message returned by SignTransaction
+//
+// responses:
+//
+//	405: Method not allowed
+//	400: Bad Request
+//	200: Success
+func (s *Server) VerifySignature(response http.ResponseWriter, request *http.Request) {
 
-// Check signature algorithm and based on the algorithm will do the signature and return signature byte
-func GetSignatureByte(deviceInfo *persistence.DeviceInfo) ([]byte, error) {
+	if request.Method != http.MethodPost {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
 
-	var signature_byte []byte
-	//Will do the sign
-	if deviceInfo.Algorithm == "RSA" {
+	reqBody, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
+		})
+		return
+	}
 
-		signature_byte, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &deviceInfo.RSAKeyPair.Private.PublicKey, []byte(SignTransactionPayload.Data), nil)
-		if err != nil {
-			panic(err)
-		}
-		decryptedBytes, err := deviceInfo.RSAKeyPair.Private.Decrypt(nil, signature_byte, &rsa.OAEPOptions{
-			Hash:  crypto.SHA256,
-			Label: []byte{},
+	var verifySignaturePayload domain.VerifySignaturePayload
+	if err := json.Unmarshal(reqBody, &verifySignaturePayload); err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
 		})
-		if err != nil {
-			return nil, err
-		}
+		return
+	}
 
-		fmt.Println("RSA Decrypted Message: ", string(decryptedBytes))
-		return signature_byte, nil
-	} else {
-		eccKeyPair, err := ECCKeyGeneratorService.Generate()
-		if err != nil {
-			return nil, err
-		}
+	validate := validator.New()
+	//validate request payload
+	if validationErr := validate.Struct(verifySignaturePayload); validationErr != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			validationErr.Error(),
+		})
+		return
+	}
 
-		signature_byte = []byte(SignTransactionPayload.Data)
-		sig1, sig2, err := ecdsa.Sign(rand.Reader, eccKeyPair.Private, signature_byte)
+	deviceService := service.NewService(logger.Logger)
 
-		if err != nil {
-			return nil, err
-		}
+	storedDevice, storedErr := deviceService.GetSignatureDeviceInfo(verifySignaturePayload.DeviceId)
+	if storedDevice == nil {
+		//Device not registered
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			storedErr.Error(),
+		})
+		return
+	}
 
-		ret := ecdsa.Verify(eccKeyPair.Public, signature_byte, sig1, sig2)
+	verifySignatureResponse := VerifySignatureResponse{
+		DeviceId: storedDevice.Id,
+		Valid:    true,
+	}
+
+	if verifySignaturePayload.COSE != "" {
+		cose_byte, err := base64.StdEncoding.DecodeString(verifySignaturePayload.COSE)
 		if err != nil {
-			return nil, err
+			verifySignatureResponse.Valid = false
+			verifySignatureResponse.Reason = "cose is not valid base64"
+		} else if cose, err := deviceService.VerifyCOSE(storedDevice, cose_byte); err != nil {
+			verifySignatureResponse.Valid = false
+			verifySignatureResponse.Reason = err.Error()
+		} else {
+			verifySignatureResponse.SignatureCounter = cose.Header.SignatureCounter
 		}
 
-		fmt.Println("Is ECC Decryption Verified: ", ret)
-		fmt.Printf("message: %#v\n\nsig1: %#v\nsig2: %#v", string(signature_byte[:]), sig1, sig2)
+		WriteAPIResponse(response, http.StatusOK, verifySignatureResponse)
+		return
+	}
 
-		signature_byte = append(sig1.Bytes(), sig2.Bytes()...)
-		return signature_byte, nil
+	signature_byte, err := base64.StdEncoding.DecodeString(verifySignaturePayload.Signature)
+	if err != nil {
+		verifySignatureResponse.Valid = false
+		verifySignatureResponse.Reason = "signature is not valid base64"
+	} else if err := deviceService.VerifySignature(storedDevice, []byte(verifySignaturePayload.SignedData), signature_byte); err != nil {
+		verifySignatureResponse.Valid = false
+		verifySignatureResponse.Reason = err.Error()
 	}
+
+	WriteAPIResponse(response, http.StatusOK, verifySignatureResponse)
 }
@@ -0,0 +1,398 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"signing-service/domain"
+	"signing-service/logger"
+	"signing-service/persistence"
+	"signing-service/service"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// devicesPath is the prefix of all device resource routes
+const devicesPath = "/api/v1/devices/"
+
+type PublicKeyResponse service.PublicKeyResponse
+type DeviceResponse service.DeviceResponse
+type DeviceListResponse service.DeviceListResponse
+type SignatureHistoryResponse service.SignatureHistoryResponse
+type KeyRotationResponse service.KeyRotationResponse
+
+// swagger:route GET devices
+// List signature devices
+//
+// Devices are ordered by id. The cursor query parameter continues after the
+// next_cursor of the previous page, algorithm filters by exact algorithm and
+// label by case-insensitive substring. With rotation_due=true only devices whose
+// key is due for rotation are listed.
+//
+// responses:
+//
+//	405: Method not allowed
+//	400: Bad Request
+//	200: Success
+func (s *Server) ListDevices(response http.ResponseWriter, request *http.Request) {
+
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	query := request.URL.Query()
+
+	limit, err := service.ParsePageLimit(query.Get("limit"))
+	if err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
+		})
+		return
+	}
+
+	filter := persistence.DeviceFilter{
+		Algorithm: query.Get("algorithm"),
+		Label:     query.Get("label"),
+	}
+	if query.Get("rotation_due") == "true" {
+		filter.KeyCreatedBefore = time.Now().Add(-service.KeyRotationInterval())
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	deviceListResponse, err := deviceService.ListSignatureDevices(query.Get("cursor"), limit, filter)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, DeviceListResponse(*deviceListResponse))
+}
+
+// DeviceResource dispatches requests on /api/v1/devices/{id}/... to the handler of the sub resource.
+func (s *Server) DeviceResource(response http.ResponseWriter, request *http.Request) {
+
+	id, subResource := splitDevicePath(request.URL.Path)
+	if id == "" {
+		WriteErrorResponse(response, http.StatusNotFound, []string{
+			http.StatusText(http.StatusNotFound),
+		})
+		return
+	}
+
+	switch subResource {
+	case "":
+		s.Device(response, request, id)
+	case "public-key":
+		s.PublicKey(response, request, id)
+	case "signatures":
+		s.SignatureHistory(response, request, id)
+	case "verify-chain":
+		s.VerifyChain(response, request, id)
+	case "sign-document":
+		s.SignDocument(response, request, id)
+	case "verify-document":
+		s.VerifyDocument(response, request, id)
+	case "certificate":
+		if request.Method == http.MethodPut {
+			s.UploadCertificate(response, request, id)
+		} else {
+			s.Certificate(response, request, id)
+		}
+	case "rotate-key":
+		s.RotateKey(response, request, id)
+	case "csr":
+		s.CertificateRequest(response, request, id)
+	case "backup":
+		s.Backup(response, request, id)
+	case string(domain.Activate), string(domain.Suspend), string(domain.Resume), string(domain.Retire):
+		s.TransitionDevice(response, request, id, domain.DeviceTransition(subResource))
+	default:
+		WriteErrorResponse(response, http.StatusNotFound, []string{
+			http.StatusText(http.StatusNotFound),
+		})
+	}
+}
+
+// splitDevicePath splits /api/v1/devices/{id}/{subResource} into its device id and sub resource.
+func splitDevicePath(path string) (string, string) {
+	parts := strings.SplitN(strings.Trim(strings.TrimPrefix(path, devicesPath), "/"), "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// swagger:route GET devices/{id}
+// Get a signature device, never including its private key
+//
+// responses:
+//
+//	405: Method not allowed
+//	404: Not Found
+//	200: Success
+func (s *Server) Device(response http.ResponseWriter, request *http.Request, id string) {
+
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	deviceResponse, err := deviceService.GetSignatureDevice(id)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, DeviceResponse(*deviceResponse))
+}
+
+// swagger:route POST devices/{id}/{transition}
+// Move a device through its lifecycle: activate, suspend, resume or retire
+//
+// responses:
+//
+//	405: Method not allowed
+//	404: Not Found
+//	409: Conflict
+//	200: Success
+func (s *Server) TransitionDevice(response http.ResponseWriter, request *http.Request, id string, transition domain.DeviceTransition) {
+
+	if request.Method != http.MethodPost {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	deviceResponse, err := deviceService.TransitionSignatureDevice(id, transition)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, DeviceResponse(*deviceResponse))
+}
+
+// swagger:route POST devices/{id}/rotate-key
+// Rotate the device key, the signature chain continues with a new key version
+//
+// The rotation is a link of the signature chain signed with the previous key,
+// announcing the version and fingerprint of the new key.
+//
+// responses:
+//
+//	405: Method not allowed
+//	404: Not Found
+//	409: Conflict
+//	200: Success
+func (s *Server) RotateKey(response http.ResponseWriter, request *http.Request, id string) {
+
+	if request.Method != http.MethodPost {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	keyRotationResponse, err := deviceService.RotateDeviceKey(id)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, KeyRotationResponse(*keyRotationResponse))
+}
+
+// swagger:route GET devices/{id}/signatures
+// Get the signature history of a device
+//
+// Records are ordered by signature counter. The from and to query parameters select
+// an inclusive counter range, next_from continues with the following page. With
+// format=jsonl the whole range is exported as JSON Lines for offline verification.
+//
+// responses:
+//
+//	405: Method not allowed
+//	400: Bad Request
+//	404: Not Found
+//	200: Success
+func (s *Server) SignatureHistory(response http.ResponseWriter, request *http.Request, id string) {
+
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	query := request.URL.Query()
+
+	limit, err := service.ParsePageLimit(query.Get("limit"))
+	if err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
+		})
+		return
+	}
+
+	from, to, err := parseCounterRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	if request.URL.Query().Get("format") == "jsonl" {
+		// Check the device first, errors can no longer be reported once streaming started
+		if _, err := deviceService.GetSignatureDevice(id); err != nil {
+			WriteServiceError(response, err)
+			return
+		}
+
+		response.Header().Set("Content-Type", "application/x-ndjson")
+		response.WriteHeader(http.StatusOK)
+		if err := deviceService.ExportSignatureRecords(id, from, to, response); err != nil {
+			logger.Logger.Printf("export of device %s signatures failed: %v", id, err)
+		}
+		return
+	}
+
+	signatureHistoryResponse, err := deviceService.ListSignatureRecords(id, from, to, limit)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, SignatureHistoryResponse(*signatureHistoryResponse))
+}
+
+// parseCounterRange parses the from and to query parameters, from defaults to the first
+// signature and to of 0 means no upper bound
+func parseCounterRange(fromValue string, toValue string) (int, int, error) {
+	from, to := 1, 0
+	var err error
+
+	if fromValue != "" {
+		if from, err = strconv.Atoi(fromValue); err != nil || from < 1 {
+			return 0, 0, fmt.Errorf("from must be a signature counter of at least 1")
+		}
+	}
+
+	if toValue != "" {
+		if to, err = strconv.Atoi(toValue); err != nil || to < from {
+			return 0, 0, fmt.Errorf("to must be a signature counter not below from")
+		}
+	}
+
+	return from, to, nil
+}
+
+// swagger:route GET devices/{id}/verify-chain
+// Verify the integrity of the device signature chain
+//
+// responses:
+//
+//	405: Method not allowed
+//	404: Not Found
+//	200: Success
+func (s *Server) VerifyChain(response http.ResponseWriter, request *http.Request, id string) {
+
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	chainReport, err := deviceService.VerifySignatureChain(id)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, chainReport)
+}
+
+// swagger:route GET devices/{id}/public-key
+// Get the device public key as PEM (SPKI) or JWK
+//
+// The representation is selected by the format query parameter (pem, jwk)
+// or the Accept header (application/x-pem-file, application/jwk+json).
+// Without either, both are returned in the standard response container.
+// The version query parameter selects a previous key version.
+//
+// responses:
+//
+//	405: Method not allowed
+//	404: Not Found
+//	200: Success
+func (s *Server) PublicKey(response http.ResponseWriter, request *http.Request, id string) {
+
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	version := 0
+	if value := request.URL.Query().Get("version"); value != "" {
+		var err error
+		if version, err = strconv.Atoi(value); err != nil || version < 1 {
+			WriteErrorResponse(response, http.StatusBadRequest, []string{
+				"version must be a key version of at least 1",
+			})
+			return
+		}
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	publicKeyResponse, err := deviceService.GetPublicKey(id, version)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	accept := request.Header.Get("Accept")
+	switch format := request.URL.Query().Get("format"); {
+	case format == "pem" || (format == "" && strings.Contains(accept, "application/x-pem-file")):
+		response.Header().Set("Content-Type", "application/x-pem-file")
+		response.WriteHeader(http.StatusOK)
+		response.Write([]byte(publicKeyResponse.PublicKey))
+	case format == "jwk" || (format == "" && strings.Contains(accept, "application/jwk+json")):
+		bytes, err := json.Marshal(publicKeyResponse.JWK)
+		if err != nil {
+			WriteInternalError(response)
+			return
+		}
+		response.Header().Set("Content-Type", "application/jwk+json")
+		response.WriteHeader(http.StatusOK)
+		response.Write(bytes)
+	case format == "":
+		WriteAPIResponse(response, http.StatusOK, PublicKeyResponse(*publicKeyResponse))
+	default:
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"unsupported public key format " + format,
+		})
+	}
+}
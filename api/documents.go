@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"signing-service/domain"
+	"signing-service/logger"
+	"signing-service/service"
+	"strings"
+
+	"github.com/go-playground/validator"
+)
+
+// MaxDocumentSize is the largest document accepted for signing, in bytes
+const MaxDocumentSize = 32 << 20
+
+type DocumentSignatureResponse service.DocumentSignatureResponse
+
+// swagger:route POST devices/{id}/sign-document
+// Sign a document as detached CMS SignedData
+//
+// The request body is the document itself. The signature advances the device
+// signature chain with the SHA-256 digest of the document as data. With the
+// Accept header application/pkcs7-signature the bare DER encoded CMS is returned.
+//
+// responses:
+//
+//	405: Method not allowed
+//	413: Request Entity Too Large
+//	409: Conflict
+//	404: Not Found
+//	400: Bad Request
+//	200: Success
+func (s *Server) SignDocument(response http.ResponseWriter, request *http.Request, id string) {
+
+	if request.Method != http.MethodPost {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	document, err := ioutil.ReadAll(http.MaxBytesReader(response, request.Body, MaxDocumentSize))
+	if err != nil {
+		WriteErrorResponse(response, http.StatusRequestEntityTooLarge, []string{
+			err.Error(),
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	documentSignatureResponse, err := deviceService.SignDocument(id, document)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	if strings.Contains(request.Header.Get("Accept"), "application/pkcs7-signature") {
+		response.Header().Set("Content-Type", "application/pkcs7-signature")
+		response.WriteHeader(http.StatusOK)
+		response.Write(documentSignatureResponse.CMS)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, DocumentSignatureResponse(*documentSignatureResponse))
+}
+
+// swagger:route POST devices/{id}/verify-document
+// Verify a detached CMS signature of a document returned by SignDocument
+//
+// responses:
+//
+//	405: Method not allowed
+//	404: Not Found
+//	400: Bad Request
+//	200: Success
+func (s *Server) VerifyDocument(response http.ResponseWriter, request *http.Request, id string) {
+
+	if request.Method != http.MethodPost {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	reqBody, err := ioutil.ReadAll(http.MaxBytesReader(response, request.Body, 2*MaxDocumentSize))
+	if err != nil {
+		WriteErrorResponse(response, http.StatusRequestEntityTooLarge, []string{
+			err.Error(),
+		})
+		return
+	}
+
+	var verifyDocumentPayload domain.VerifyDocumentPayload
+	if err := json.Unmarshal(reqBody, &verifyDocumentPayload); err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
+		})
+		return
+	}
+
+	validate := validator.New()
+	//validate request payload
+	if validationErr := validate.Struct(verifyDocumentPayload); validationErr != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			validationErr.Error(),
+		})
+		return
+	}
+
+	document_byte, err := base64.StdEncoding.DecodeString(verifyDocumentPayload.Document)
+	if err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"document is not valid base64",
+		})
+		return
+	}
+
+	cms_byte, err := base64.StdEncoding.DecodeString(verifyDocumentPayload.CMS)
+	if err != nil {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"cms is not valid base64",
+		})
+		return
+	}
+
+	deviceService := service.NewService(logger.Logger)
+
+	storedDevice, err := deviceService.GetSignatureDeviceInfo(id)
+	if err != nil {
+		WriteServiceError(response, err)
+		return
+	}
+
+	verifySignatureResponse := VerifySignatureResponse{
+		DeviceId: storedDevice.Id,
+		Valid:    true,
+	}
+	if err := deviceService.VerifyDocument(storedDevice, document_byte, cms_byte); err != nil {
+		verifySignatureResponse.Valid = false
+		verifySignatureResponse.Reason = err.Error()
+	}
+
+	WriteAPIResponse(response, http.StatusOK, verifySignatureResponse)
+}
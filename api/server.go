@@ -1,9 +1,14 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"signing-service/domain"
+	"signing-service/persistence"
+	"signing-service/service"
 
 	"github.com/go-openapi/runtime/middleware"
 )
@@ -22,6 +27,8 @@ type ErrorResponse struct {
 type Server struct {
 	listenAddress string
 	log           *log.Logger
+	httpServer    *http.Server
+	adminToken    []byte
 }
 
 // NewServer is a factory to instantiate a new Server.
@@ -48,9 +55,30 @@ func (s *Server) Run() error {
 
 	// TODO: register further HandlerFuncs here ...
 	mux.Handle("/api/v1/device/create-signature-device", http.HandlerFunc(s.CreateSignatureDevice))
+	mux.Handle("/api/v1/device/import-signature-device", http.HandlerFunc(s.ImportSignatureDevice))
+	mux.Handle("/api/v1/device/restore-signature-device", http.HandlerFunc(s.RestoreBackup))
 	mux.Handle("/api/v1/device/sign-transaction", http.HandlerFunc(s.SignTransaction))
+	mux.Handle("/api/v1/device/verify-signature", http.HandlerFunc(s.VerifySignature))
+	mux.Handle("/api/v1/devices", http.HandlerFunc(s.ListDevices))
+	mux.Handle(devicesPath, http.HandlerFunc(s.DeviceResource))
+	mux.Handle("/api/v1/ca/certificate", http.HandlerFunc(s.CACertificate))
+	mux.Handle("/api/v1/ca/crl", http.HandlerFunc(s.CRL))
+
+	s.httpServer = &http.Server{
+		Addr:    s.listenAddress,
+		Handler: mux,
+	}
+
+	return s.httpServer.ListenAndServe()
+}
+
+// Shutdown stops accepting new requests and waits for the running ones to finish.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.httpServer == nil {
+		return nil
+	}
 
-	return http.ListenAndServe(s.listenAddress, mux)
+	return s.httpServer.Shutdown(ctx)
 }
 
 // WriteInternalError writes a default internal error message as an HTTP response.
@@ -76,6 +104,29 @@ func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
 	w.Write(bytes)
 }
 
+// WriteServiceError writes a service error as an HTTP error response, unknown devices
+// map to 404, requests conflicting with the device lifecycle, an existing device or its
+// signature chain to 409 and rejected certificate chains, private keys, key parameters
+// and backups to 400.
+func WriteServiceError(response http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, persistence.ErrDeviceNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, domain.ErrInvalidTransition), errors.Is(err, service.ErrDeviceNotActive),
+		errors.Is(err, persistence.ErrDeviceExists), errors.Is(err, service.ErrBackupConflict):
+		code = http.StatusConflict
+	case errors.Is(err, service.ErrInvalidCertificateChain), errors.Is(err, service.ErrInvalidPrivateKey),
+		errors.Is(err, domain.ErrInvalidKeyParameters), errors.Is(err, service.ErrInvalidBackup),
+		errors.Is(err, service.ErrInvalidSignData), errors.Is(err, service.ErrInvalidPage):
+		code = http.StatusBadRequest
+	}
+
+	WriteErrorResponse(response, code, []string{
+		err.Error(),
+	})
+}
+
 // WriteAPIResponse takes an HTTP status code and a generic data struct
 // and writes those as an HTTP response in a structured format.
 func WriteAPIResponse(w http.ResponseWriter, code int, data interface{}) {
@@ -0,0 +1,216 @@
+// Command verify checks an exported device signature chain offline.
+//
+// It reads the device public key (PEM encoded SubjectPublicKeyInfo, as served by
+// GET /api/v1/devices/{id}/public-key?format=pem) and a JSON Lines export of the
+// signature records (as served by GET /api/v1/devices/{id}/signatures?format=jsonl),
+// verifies every signature and chain link and exits non-zero if the chain is broken.
+// Devices created with a non default hash or RSA padding need -hash and -padding,
+// as listed in key_parameters of GET /api/v1/devices/{id}. Devices whose key was
+// rotated need the public key of every key version, oldest first, as served by
+// GET /api/v1/devices/{id}/public-key?format=pem&version=N. The chain switches to
+// the next key at each key rotation link. Devices imported from another signing
+// provider continue its chain, pass imported_signature_counter and
+// imported_last_signature of GET /api/v1/devices/{id} as -imported-counter and
+// -imported-signature.
+//
+//	go run ./cmd/verify -public-key device.pem -export signatures.jsonl
+//	go run ./cmd/verify -public-key device.pem -hash SHA-512 -padding PKCS1v15 -export signatures.jsonl
+//	go run ./cmd/verify -public-key v1.pem -public-key v2.pem -export signatures.jsonl
+//	go run ./cmd/verify -public-key device.pem -imported-counter 41 -imported-signature MEUCIQ... -export signatures.jsonl
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"signing-service/signingCrypto"
+	"strings"
+)
+
+const (
+	exitValid   = 0
+	exitInvalid = 1
+	exitUsage   = 2
+)
+
+// publicKeyPaths collects the repeated -public-key flags in order
+type publicKeyPaths []string
+
+func (p *publicKeyPaths) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *publicKeyPaths) Set(path string) error {
+	*p = append(*p, path)
+	return nil
+}
+
+// signatureRecord is one line of a signature history export
+type signatureRecord struct {
+	DeviceId string `json:"device_id"`
+	signingCrypto.ChainLink
+}
+
+func main() {
+	var publicKeyPaths publicKeyPaths
+	flag.Var(&publicKeyPaths, "public-key", "path of the PEM encoded device public key, repeated for every key version oldest first")
+	exportPath := flag.String("export", "-", "path of the JSON Lines signature export, - reads stdin")
+	deviceId := flag.String("device-id", "", "device id of the chain, defaults to the device_id of the first record")
+	expectedCounter := flag.Int("signature-counter", 0, "expected signature counter of the last record, 0 skips the check")
+	hashName := flag.String("hash", "", "signature hash SHA-256, SHA-384 or SHA-512, defaults to the key type default")
+	padding := flag.String("padding", "", "RSA signature padding PSS or PKCS1v15, defaults to PSS")
+	importedCounter := flag.Int("imported-counter", 0, "last signature counter of the external chain an imported device continues")
+	importedSignature := flag.String("imported-signature", "", "last signature of the external chain an imported device continues")
+	flag.Parse()
+
+	if len(publicKeyPaths) == 0 {
+		fmt.Fprintln(os.Stderr, "verify: -public-key is required")
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	if (*importedCounter > 0) != (*importedSignature != "") {
+		fmt.Fprintln(os.Stderr, "verify: -imported-counter and -imported-signature go together")
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	params, err := signingCrypto.ParseSignatureParameters(*hashName, *padding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	chainKeys, err := loadChainKeys(publicKeyPaths, params)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	export, err := openExport(*exportPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	defer export.Close()
+
+	report, err := verifyExport(export, chainKeys, *deviceId, *importedCounter, *importedSignature, *expectedCounter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	printReport(os.Stdout, report)
+	if !report.Valid {
+		os.Exit(exitInvalid)
+	}
+	os.Exit(exitValid)
+}
+
+// loadChainKeys reads the public keys of the key versions, the first path is version 1
+func loadChainKeys(paths []string, params signingCrypto.SignatureParameters) ([]signingCrypto.ChainKey, error) {
+	chainKeys := make([]signingCrypto.ChainKey, 0, len(paths))
+	for i, path := range paths {
+		publicKeyBytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		publicKey, err := signingCrypto.ParsePublicKey(publicKeyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read public key %s: %v", path, err)
+		}
+
+		chainKey := signingCrypto.ChainKey{Version: i + 1}
+		if chainKey.Fingerprint, err = signingCrypto.Fingerprint(publicKey); err != nil {
+			return nil, err
+		}
+		if chainKey.Verifier, err = signingCrypto.NewVerifier(publicKey, params); err != nil {
+			return nil, err
+		}
+		chainKeys = append(chainKeys, chainKey)
+	}
+
+	return chainKeys, nil
+}
+
+func openExport(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+
+	return os.Open(path)
+}
+
+// verifyExport feeds every record of the export to a ChainVerifier, continuing the imported
+// chain if importedCounter is set. Malformed input is returned as error, a broken chain is
+// reported in the ChainReport.
+func verifyExport(export io.Reader, chainKeys []signingCrypto.ChainKey, deviceId string, importedCounter int, importedSignature string, expectedCounter int) (signingCrypto.ChainReport, error) {
+	var chainVerifier *signingCrypto.ChainVerifier
+
+	scanner := bufio.NewScanner(export)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record signatureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return signingCrypto.ChainReport{}, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		if chainVerifier == nil {
+			if deviceId == "" {
+				deviceId = record.DeviceId
+			}
+			chainVerifier = signingCrypto.NewKeyedChainVerifier(deviceId, chainKeys)
+			if importedCounter > 0 {
+				chainVerifier.Continue(importedCounter, importedSignature)
+			}
+		}
+
+		if record.DeviceId != "" && record.DeviceId != deviceId {
+			return signingCrypto.ChainReport{}, fmt.Errorf("line %d: record of device %s in chain of device %s", line, record.DeviceId, deviceId)
+		}
+
+		if chainVerifier.Next(record.ChainLink) != nil {
+			return chainVerifier.Report(), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return signingCrypto.ChainReport{}, err
+	}
+
+	if chainVerifier == nil {
+		return signingCrypto.ChainReport{}, errors.New("export contains no signature records")
+	}
+
+	if expectedCounter > 0 {
+		chainVerifier.End(expectedCounter, "")
+	}
+
+	return chainVerifier.Report(), nil
+}
+
+func printReport(w io.Writer, report signingCrypto.ChainReport) {
+	fmt.Fprintf(w, "device:              %s\n", report.DeviceId)
+	fmt.Fprintf(w, "verified signatures: %d\n", report.VerifiedSignatures)
+	if report.ContinuedFrom > 0 {
+		fmt.Fprintf(w, "continued from:      %d\n", report.ContinuedFrom)
+	}
+
+	if report.Valid {
+		fmt.Fprintln(w, "result:              VALID")
+		return
+	}
+
+	fmt.Fprintln(w, "result:              BROKEN")
+	fmt.Fprintf(w, "broken at signature: %d\n", report.BrokenAt)
+	fmt.Fprintf(w, "reason:              %s\n", report.Reason)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"signing-service/config"
+	"signing-service/domain"
+	"signing-service/persistence"
+	"signing-service/service"
+	"signing-service/signingCrypto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var testLogger = log.New(ioutil.Discard, "", 0)
+
+// TestMain sets up the service like service.TestMain, with the database of the package
+// config.json, an in-memory database, so the tests verify real exports
+func TestMain(m *testing.M) {
+	if err := persistence.OpenDB(config.Env.Database); err != nil {
+		log.Fatalf("Could not open database, Error: %v", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal(err)
+	}
+	masterKey, err := persistence.NewMasterKey(key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	persistence.Keys = persistence.NewKeyring(masterKey)
+
+	if err := service.LoadCertificateAuthority(config.Env.CertificateAuthority, testLogger); err != nil {
+		log.Fatalf("Could not load certificate authority, Error: %v", err)
+	}
+
+	code := m.Run()
+	persistence.CloseDB()
+	os.Exit(code)
+}
+
+// signTransactions signs count transactions with the device
+func signTransactions(t *testing.T, id string, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		if _, err := service.NewService(testLogger).SignTransaction(id, "transaction", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// exportSignatures returns the JSON Lines export of the device signature history
+func exportSignatures(t *testing.T, id string) string {
+	t.Helper()
+
+	var export bytes.Buffer
+	if err := service.NewService(testLogger).ExportSignatureRecords(id, 1, 0, &export); err != nil {
+		t.Fatal(err)
+	}
+	return export.String()
+}
+
+// writePublicKeys writes the PEM public key of every key version of the device to a file
+// and returns the -public-key flags of the files, oldest version first
+func writePublicKeys(t *testing.T, id string, versions int) publicKeyPaths {
+	t.Helper()
+
+	var paths publicKeyPaths
+	dir := t.TempDir()
+	for version := 1; version <= versions; version++ {
+		publicKey, err := service.NewService(testLogger).GetPublicKey(id, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(dir, "v"+strconv.Itoa(version)+".pem")
+		if err := ioutil.WriteFile(path, []byte(publicKey.PublicKey), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := paths.Set(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+// verifyFlags runs verifyExport like main does for the flags
+func verifyFlags(t *testing.T, export string, paths []string, hashName string, padding string, importedCounter int, importedSignature string, expectedCounter int) (signingCrypto.ChainReport, error) {
+	t.Helper()
+
+	params, err := signingCrypto.ParseSignatureParameters(hashName, padding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainKeys, err := loadChainKeys(paths, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifyExport(strings.NewReader(export), chainKeys, "", importedCounter, importedSignature, expectedCounter)
+}
+
+func TestVerifyExport(t *testing.T) {
+	id := "verify-device"
+	if err := service.NewService(testLogger).CreateSignatureDevice(&persistence.DeviceInfo{Id: id, Algorithm: "ECC"}); err != nil {
+		t.Fatal(err)
+	}
+	signTransactions(t, id, 3)
+	export := exportSignatures(t, id)
+	paths := writePublicKeys(t, id, 1)
+
+	lines := strings.SplitAfter(export, "\n")
+	tampered := lines[0] + strings.Replace(lines[1], "_transaction_", "_tampered___", 1) + strings.Join(lines[2:], "")
+	dropped := lines[0] + strings.Join(lines[2:], "")
+
+	tests := []struct {
+		name            string
+		export          string
+		expectedCounter int
+		valid           bool
+		brokenAt        int
+	}{
+		{"export", export, 0, true, 0},
+		{"expected counter", export, 3, true, 0},
+		{"expected counter beyond the export", export, 4, false, 4},
+		{"export with blank lines", "\n" + strings.ReplaceAll(export, "\n", "\n\n"), 3, true, 0},
+		{"tampered line", tampered, 0, false, 2},
+		{"dropped line", dropped, 0, false, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := verifyFlags(t, test.export, paths, "", "", 0, "", test.expectedCounter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.DeviceId != id || report.Valid != test.valid || report.BrokenAt != test.brokenAt {
+				t.Errorf("got %+v, want valid %t broken at %d", report, test.valid, test.brokenAt)
+			}
+		})
+	}
+}
+
+// TestVerifyExportMalformed checks that input which is no signature export is an error, not a broken chain
+func TestVerifyExportMalformed(t *testing.T) {
+	id := "malformed-export-device"
+	if err := service.NewService(testLogger).CreateSignatureDevice(&persistence.DeviceInfo{Id: id, Algorithm: "ED25519"}); err != nil {
+		t.Fatal(err)
+	}
+	signTransactions(t, id, 2)
+	export := exportSignatures(t, id)
+	paths := writePublicKeys(t, id, 1)
+
+	tests := []struct {
+		name   string
+		export string
+		err    string
+	}{
+		{"empty export", "", "export contains no signature records"},
+		{"line not JSON", strings.Replace(export, "}\n", "\n", 1), "line 1"},
+		{"line of another device", export + strings.Replace(strings.SplitAfter(export, "\n")[0], id, "other-device", 1), "line 3: record of device other-device"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := verifyFlags(t, test.export, paths, "", "", 0, "", 0); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+// TestVerifyExportKeyParameters verifies the export of an RSA device with the -hash and -padding of its key parameters
+func TestVerifyExportKeyParameters(t *testing.T) {
+	id := "pkcs1-device"
+	deviceInfo := &persistence.DeviceInfo{Id: id, Algorithm: "RSA", KeyParameters: domain.KeyParameters{Hash: "SHA-512", Padding: "PKCS1v15"}}
+	if err := service.NewService(testLogger).CreateSignatureDevice(deviceInfo); err != nil {
+		t.Fatal(err)
+	}
+	signTransactions(t, id, 2)
+	export := exportSignatures(t, id)
+	paths := writePublicKeys(t, id, 1)
+
+	report, err := verifyFlags(t, export, paths, "SHA-512", "PKCS1v15", 0, "", 2)
+	if err != nil || !report.Valid || report.VerifiedSignatures != 2 {
+		t.Errorf("with the key parameters: %+v, %v", report, err)
+	}
+
+	//The default PSS padding does not verify PKCS #1 v1.5 signatures
+	report, err = verifyFlags(t, export, paths, "SHA-512", "", 0, "", 2)
+	if err != nil || report.Valid || report.BrokenAt != 1 {
+		t.Errorf("with the default padding: %+v, %v", report, err)
+	}
+}
+
+// TestVerifyExportRotatedKeys verifies a chain signed by three key versions, given by repeated -public-key flags
+func TestVerifyExportRotatedKeys(t *testing.T) {
+	id := "rotated-export-device"
+	if err := service.NewService(testLogger).CreateSignatureDevice(&persistence.DeviceInfo{Id: id, Algorithm: "ED25519"}); err != nil {
+		t.Fatal(err)
+	}
+	signTransactions(t, id, 2)
+	if _, err := service.NewService(testLogger).RotateDeviceKey(id); err != nil {
+		t.Fatal(err)
+	}
+	signTransactions(t, id, 2)
+	if _, err := service.NewService(testLogger).RotateDeviceKey(id); err != nil {
+		t.Fatal(err)
+	}
+	signTransactions(t, id, 1)
+	export := exportSignatures(t, id)
+	paths := writePublicKeys(t, id, 3)
+
+	if paths.String() != strings.Join(paths, ",") || len(paths) != 3 {
+		t.Fatalf("public key flags %q", paths.String())
+	}
+
+	tests := []struct {
+		name     string
+		paths    []string
+		valid    bool
+		brokenAt int
+		reason   string
+	}{
+		{"every key version", paths, true, 0, ""},
+		{"first key version only", paths[:1], false, 3, "chain rotates to key version 2, which is not known"},
+		{"key versions out of order", []string{paths[1], paths[0], paths[2]}, false, 1, ""},
+		{"last key version only", paths[2:], false, 1, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := verifyFlags(t, export, test.paths, "", "", 0, "", 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Valid != test.valid || report.BrokenAt != test.brokenAt {
+				t.Fatalf("got %+v, want valid %t broken at %d", report, test.valid, test.brokenAt)
+			}
+			if test.valid && report.VerifiedSignatures != 7 {
+				t.Errorf("verified %d signatures, want 7", report.VerifiedSignatures)
+			}
+			if test.reason != "" && report.Reason != test.reason {
+				t.Errorf("got reason %q, want %q", report.Reason, test.reason)
+			}
+		})
+	}
+}
+
+// TestVerifyExportImportedChain verifies the export of a device continuing the chain of another
+// signing provider with -imported-counter and -imported-signature
+func TestVerifyExportImportedChain(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := "imported-export-device"
+	importedSignature := "c2lnbmF0dXJlIDQx"
+	_, err = service.NewService(testLogger).ImportSignatureDevice(domain.ImportDevicePayload{
+		Id:               id,
+		PrivateKey:       string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		SignatureCounter: 41,
+		LastSignature:    importedSignature,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signTransactions(t, id, 3)
+	export := exportSignatures(t, id)
+	paths := writePublicKeys(t, id, 1)
+
+	tests := []struct {
+		name              string
+		importedCounter   int
+		importedSignature string
+		valid             bool
+		brokenAt          int
+	}{
+		{"imported chain", 41, importedSignature, true, 0},
+		{"without the imported chain", 0, "", false, 1},
+		{"wrong imported counter", 40, importedSignature, false, 41},
+		{"wrong imported signature", 41, "b3RoZXI=", false, 42},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := verifyFlags(t, export, paths, "SHA-256", "", test.importedCounter, test.importedSignature, 44)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Valid != test.valid || report.BrokenAt != test.brokenAt {
+				t.Fatalf("got %+v, want valid %t broken at %d", report, test.valid, test.brokenAt)
+			}
+			if test.valid && (report.ContinuedFrom != 41 || report.VerifiedSignatures != 3) {
+				t.Errorf("verified %d signatures continuing %d, want 3 continuing 41", report.VerifiedSignatures, report.ContinuedFrom)
+			}
+		})
+	}
+}
@@ -9,8 +9,61 @@ import (
 )
 
 type envConfig struct {
-	Port        string `json:"port"`
-	LogFileName string `json:"log_file_name"`
+	Port        string          `json:"port"`
+	LogFileName string          `json:"log_file_name"`
+	Database    DatabaseConfig  `json:"database"`
+	Encryption  MasterKeyConfig `json:"encryption"`
+	// CertificateAuthority configures the local CA issuing device certificates
+	CertificateAuthority CAConfig `json:"certificate_authority"`
+	// KeyRotationDays is the age after which a device key is due for rotation
+	KeyRotationDays int `json:"key_rotation_days"`
+	// Admin configures the admin endpoints, e.g. device key backups
+	Admin AdminConfig `json:"admin"`
+}
+
+// DatabaseConfig holds the settings of the Badger key-value store
+type DatabaseConfig struct {
+	// DataDir is the directory Badger keeps its LSM tree and value log in
+	DataDir string `json:"data_dir"`
+	// InMemory keeps all data in memory only, everything is lost on restart
+	InMemory bool `json:"in_memory"`
+	// SyncWrites syncs every write to disk before it is acknowledged
+	SyncWrites bool `json:"sync_writes"`
+	// ValueLogFileSizeMB is the maximum size of a single value log file
+	ValueLogFileSizeMB int64 `json:"value_log_file_size_mb"`
+	// ValueLogGCIntervalSeconds is the pause between value log garbage collection runs
+	ValueLogGCIntervalSeconds int `json:"value_log_gc_interval_seconds"`
+	// ValueLogGCDiscardRatio is the share of stale data a value log file needs to be rewritten
+	ValueLogGCDiscardRatio float64 `json:"value_log_gc_discard_ratio"`
+}
+
+// MasterKeyConfig holds the location of the master keys protecting device private keys at rest
+type MasterKeyConfig struct {
+	// MasterKeyFile holds the base64 encoded current master key, it is created if missing
+	MasterKeyFile string `json:"master_key_file"`
+	// RetiredMasterKeyFiles hold previous master keys, records wrapped with them are re-wrapped on start
+	RetiredMasterKeyFiles []string `json:"retired_master_key_files"`
+}
+
+// CAConfig holds the settings of the local certificate authority. Its root and intermediate
+// keys are created on first start and kept sealed in the database like device keys.
+type CAConfig struct {
+	// Organization is the organization name of the CA and device certificate subjects
+	Organization string `json:"organization"`
+	// ExtensionOID is the OID arc of the device certificate extensions, the algorithm
+	// extension is <arc>.1 and the tenant extension <arc>.2. The default is under the
+	// documentation enterprise number 32473 (RFC 5612), deployments set their own arc.
+	ExtensionOID string `json:"extension_oid"`
+	// DeviceCertificateValidityDays is the validity of issued device certificates
+	DeviceCertificateValidityDays int `json:"device_certificate_validity_days"`
+	// CRLValidityHours is the time until the next update announced in a CRL
+	CRLValidityHours int `json:"crl_validity_hours"`
+}
+
+// AdminConfig holds the credentials of the admin endpoints
+type AdminConfig struct {
+	// TokenFile holds the bearer token of the admin endpoints, they are disabled without a token
+	TokenFile string `json:"token_file"`
 }
 
 // Env variable has the config loaded in it on init()
@@ -39,6 +92,7 @@ func loadConfig() error {
 		return fmt.Errorf("Cannot convert file to bytes, Err: %v", err)
 	}
 
+	Env = defaultConfig()
 	err = json.Unmarshal(byteValue, &Env)
 	if err != nil {
 		return fmt.Errorf("Cannot decode config JSON, Err: %v", err)
@@ -46,3 +100,26 @@ func loadConfig() error {
 
 	return nil
 }
+
+// defaultConfig returns the values used for settings missing in config.json
+func defaultConfig() envConfig {
+	return envConfig{
+		Database: DatabaseConfig{
+			DataDir:                   "./data/badger",
+			SyncWrites:                true,
+			ValueLogFileSizeMB:        256,
+			ValueLogGCIntervalSeconds: 300,
+			ValueLogGCDiscardRatio:    0.5,
+		},
+		Encryption: MasterKeyConfig{
+			MasterKeyFile: "./data/master.key",
+		},
+		CertificateAuthority: CAConfig{
+			Organization:                  "signing-service",
+			ExtensionOID:                  "1.3.6.1.4.1.32473.1",
+			DeviceCertificateValidityDays: 825,
+			CRLValidityHours:              24,
+		},
+		KeyRotationDays: 365,
+	}
+}
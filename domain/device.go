@@ -1,21 +1,105 @@
 package domain
 
+import "encoding/json"
+
 // TODO: signature device domain model ...
 
 type DevicePayload struct {
-	Id        string `json:"id" validate:"required"`
-	Algorithm string `json:"algorithm" validate:"required"`
+	// Id is used in URL paths and store keys, so it must not contain a slash
+	Id        string `json:"id" validate:"required,excludesall=/"`
+	Algorithm string `json:"algorithm" validate:"required,oneof=RSA ECC ED25519"`
 	Label     string `json:"label"`
+	// Tenant optionally names the customer owning the device, it is certified with the device key
+	Tenant string `json:"tenant"`
+	// State is the initial lifecycle state, devices are created ACTIVE unless INACTIVE is requested
+	State DeviceState `json:"state" validate:"omitempty,oneof=ACTIVE INACTIVE"`
+	// KeyParameters optionally override the key size, curve, hash and padding of the algorithm
+	KeyParameters KeyParameters `json:"key_parameters"`
+}
+
+// ImportDevicePayload creates a device with the key of another signing provider. The
+// algorithm, RSA key size and curve are those of the key, the signature chain continues
+// after SignatureCounter with LastSignature.
+type ImportDevicePayload struct {
+	// Id is used in URL paths and store keys, so it must not contain a slash
+	Id string `json:"id" validate:"required,excludesall=/"`
+	// Algorithm optionally asserts the algorithm of the private key
+	Algorithm string      `json:"algorithm" validate:"omitempty,oneof=RSA ECC ED25519"`
+	Label     string      `json:"label"`
+	Tenant    string      `json:"tenant"`
+	State     DeviceState `json:"state" validate:"omitempty,oneof=ACTIVE INACTIVE"`
+	// PrivateKey is the PEM encoded PKCS#8, PKCS#1 or SEC1 private key
+	PrivateKey string `json:"private_key" validate:"required"`
+	// Password decrypts an encrypted private key
+	Password string `json:"password"`
+	// KeyParameters set the hash, padding and signature format the key signed with
+	KeyParameters KeyParameters `json:"key_parameters"`
+	// SignatureCounter and LastSignature are the last link of the chain signed by the other provider
+	SignatureCounter int    `json:"signature_counter" validate:"min=0"`
+	LastSignature    string `json:"last_signature" validate:"required_with=SignatureCounter,omitempty,base64"`
+}
+
+// BackupPayload encrypts a device key backup with a password or for the PEM encoded RSA or
+// EC public key of a recipient
+type BackupPayload struct {
+	Password           string `json:"password" validate:"required_without=RecipientPublicKey,omitempty,min=12"`
+	RecipientPublicKey string `json:"recipient_public_key" validate:"required_without=Password"`
+}
+
+// RestoreBackupPayload carries a device key backup with the password or the PEM encoded
+// recipient private key decrypting it
+type RestoreBackupPayload struct {
+	Backup     json.RawMessage `json:"backup" validate:"required"`
+	Password   string          `json:"password" validate:"required_without=PrivateKey"`
+	PrivateKey string          `json:"private_key" validate:"required_without=Password"`
+	// PrivateKeyPassword decrypts an encrypted recipient private key
+	PrivateKeyPassword string `json:"private_key_password"`
 }
 
 type SignTransactionPayload struct {
 	DeviceId string `json:"deviceId" validate:"required"`
 	Data     string `json:"data" validate:"required"`
+	// Format optionally requests the signature record in a standard envelope as well
+	Format string `json:"format" validate:"omitempty,oneof=JWS COSE"`
 }
 
-type ALGORITHM int
-
+// Envelope formats of SignTransactionPayload
 const (
-	ECC ALGORITHM = 1
-	RSA ALGORITHM = 2
+	FormatJWS  = "JWS"
+	FormatCOSE = "COSE"
 )
+
+// VerifySignaturePayload carries either a signature over signed data or a COSE_Sign1 message
+type VerifySignaturePayload struct {
+	DeviceId   string `json:"deviceId" validate:"required"`
+	SignedData string `json:"signed_data" validate:"required_without=COSE"`
+	Signature  string `json:"signature" validate:"required_without=COSE"`
+	// COSE is a base64 encoded COSE_Sign1 message returned by sign-transaction
+	COSE string `json:"cose"`
+}
+
+// VerifyDocumentPayload carries a document and its detached CMS signature, both base64 encoded
+type VerifyDocumentPayload struct {
+	Document string `json:"document" validate:"required"`
+	CMS      string `json:"cms" validate:"required"`
+}
+
+// CertificateRequestPayload is the subject and subject alternative names of a device CSR
+type CertificateRequestPayload struct {
+	Subject        CertificateSubject `json:"subject"`
+	DNSNames       []string           `json:"dns_names" validate:"omitempty,dive,required"`
+	EmailAddresses []string           `json:"email_addresses" validate:"omitempty,dive,email"`
+	IPAddresses    []string           `json:"ip_addresses" validate:"omitempty,dive,ip"`
+	URIs           []string           `json:"uris" validate:"omitempty,dive,uri"`
+}
+
+// CertificateSubject is the distinguished name requested for a device certificate
+type CertificateSubject struct {
+	CommonName         string   `json:"common_name" validate:"required"`
+	SerialNumber       string   `json:"serial_number"`
+	Organization       []string `json:"organization"`
+	OrganizationalUnit []string `json:"organizational_unit"`
+	Country            []string `json:"country" validate:"omitempty,dive,len=2"`
+	Province           []string `json:"province"`
+	Locality           []string `json:"locality"`
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidKeyParameters is returned when key parameters do not apply to the device algorithm
+var ErrInvalidKeyParameters = errors.New("invalid key parameters")
+
+// KeyParameters are the optional key and signature parameters of a device. The allowed
+// values are the allow-list of the validate tags, empty fields take the defaults of the
+// device algorithm, see WithDefaults.
+type KeyParameters struct {
+	// RSABits is the RSA modulus size, RSA only
+	RSABits int `json:"rsa_bits,omitempty" validate:"omitempty,oneof=2048 3072 4096"`
+	// Curve is the elliptic curve, ECC only
+	Curve string `json:"curve,omitempty" validate:"omitempty,oneof=P-256 P-384 P-521"`
+	// Hash is the digest signed by RSA and ECC devices, Ed25519 hashes the data itself
+	Hash string `json:"hash,omitempty" validate:"omitempty,oneof=SHA-256 SHA-384 SHA-512"`
+	// Padding is the RSA signature padding, RSA only
+	Padding string `json:"padding,omitempty" validate:"omitempty,oneof=PSS PKCS1v15"`
+	// Deterministic derives ECDSA nonces from the key and data (RFC 6979), ECC only
+	Deterministic bool `json:"deterministic,omitempty"`
+	// SignatureFormat is the ECDSA signature encoding, ASN.1 DER or fixed width r||s (IEEE P1363), ECC only
+	SignatureFormat string `json:"signature_format,omitempty" validate:"omitempty,oneof=DER P1363"`
+}
+
+const (
+	DefaultRSABits = 2048
+	DefaultCurve   = "P-384"
+	DefaultPadding = "PSS"
+	DefaultFormat  = "DER"
+)
+
+// defaultCurveHashes is the digest of each curve whose size matches the curve order
+var defaultCurveHashes = map[string]string{
+	"P-256": "SHA-256",
+	"P-384": "SHA-384",
+	"P-521": "SHA-512",
+}
+
+// Check returns ErrInvalidKeyParameters if a parameter is set that the algorithm does not use
+func (p KeyParameters) Check(algorithm string) error {
+	var unused []string
+
+	switch algorithm {
+	case "RSA":
+		if p.Curve != "" {
+			unused = append(unused, "curve")
+		}
+		if p.Deterministic {
+			unused = append(unused, "deterministic")
+		}
+		if p.SignatureFormat != "" {
+			unused = append(unused, "signature_format")
+		}
+	case "ECC":
+		if p.RSABits != 0 {
+			unused = append(unused, "rsa_bits")
+		}
+		if p.Padding != "" {
+			unused = append(unused, "padding")
+		}
+	case "ED25519":
+		if p != (KeyParameters{}) {
+			return fmt.Errorf("%w: %s does not take key parameters", ErrInvalidKeyParameters, algorithm)
+		}
+	}
+
+	if len(unused) > 0 {
+		return fmt.Errorf("%w: %s does not take %v parameters", ErrInvalidKeyParameters, algorithm, unused)
+	}
+
+	return nil
+}
+
+// WithDefaults returns the parameters with every empty field the algorithm uses set to its
+// default: RSA 2048 bits with PSS over SHA-256, ECC on P-384 with the digest matching the curve
+// and DER encoded signatures.
+func (p KeyParameters) WithDefaults(algorithm string) KeyParameters {
+	switch algorithm {
+	case "RSA":
+		if p.RSABits == 0 {
+			p.RSABits = DefaultRSABits
+		}
+		if p.Hash == "" {
+			p.Hash = "SHA-256"
+		}
+		if p.Padding == "" {
+			p.Padding = DefaultPadding
+		}
+	case "ECC":
+		if p.Curve == "" {
+			p.Curve = DefaultCurve
+		}
+		if p.Hash == "" {
+			p.Hash = defaultCurveHashes[p.Curve]
+		}
+		if p.SignatureFormat == "" {
+			p.SignatureFormat = DefaultFormat
+		}
+	}
+
+	return p
+}
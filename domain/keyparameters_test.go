@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKeyParametersCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		params    KeyParameters
+		valid     bool
+	}{
+		{"RSA defaults", "RSA", KeyParameters{}, true},
+		{"RSA every parameter", "RSA", KeyParameters{RSABits: 4096, Hash: "SHA-512", Padding: "PKCS1v15"}, true},
+		{"RSA with curve", "RSA", KeyParameters{Curve: "P-256"}, false},
+		{"RSA deterministic", "RSA", KeyParameters{Deterministic: true}, false},
+		{"RSA with signature format", "RSA", KeyParameters{SignatureFormat: "P1363"}, false},
+		{"RSA with curve and padding", "RSA", KeyParameters{Curve: "P-384", Padding: "PSS"}, false},
+
+		{"ECC defaults", "ECC", KeyParameters{}, true},
+		{"ECC every parameter", "ECC", KeyParameters{Curve: "P-521", Hash: "SHA-256", Deterministic: true, SignatureFormat: "P1363"}, true},
+		{"ECC with RSA bits", "ECC", KeyParameters{RSABits: 2048}, false},
+		{"ECC with padding", "ECC", KeyParameters{Padding: "PSS"}, false},
+		{"ECC with curve and RSA bits", "ECC", KeyParameters{Curve: "P-256", RSABits: 3072}, false},
+
+		{"ED25519 defaults", "ED25519", KeyParameters{}, true},
+		{"ED25519 with hash", "ED25519", KeyParameters{Hash: "SHA-512"}, false},
+		{"ED25519 with curve", "ED25519", KeyParameters{Curve: "P-256"}, false},
+		{"ED25519 deterministic", "ED25519", KeyParameters{Deterministic: true}, false},
+		{"ED25519 with RSA bits", "ED25519", KeyParameters{RSABits: 2048}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.params.Check(test.algorithm)
+			if test.valid && err != nil {
+				t.Errorf("Check(%s) = %v", test.algorithm, err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidKeyParameters) {
+				t.Errorf("Check(%s) = %v, want %v", test.algorithm, err, ErrInvalidKeyParameters)
+			}
+		})
+	}
+}
+
+func TestKeyParametersWithDefaults(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		params    KeyParameters
+		want      KeyParameters
+	}{
+		{"RSA", "RSA", KeyParameters{}, KeyParameters{RSABits: 2048, Hash: "SHA-256", Padding: "PSS"}},
+		{"RSA keeps set parameters", "RSA", KeyParameters{RSABits: 3072, Hash: "SHA-384", Padding: "PKCS1v15"}, KeyParameters{RSABits: 3072, Hash: "SHA-384", Padding: "PKCS1v15"}},
+		{"RSA with hash", "RSA", KeyParameters{Hash: "SHA-512"}, KeyParameters{RSABits: 2048, Hash: "SHA-512", Padding: "PSS"}},
+
+		{"ECC", "ECC", KeyParameters{}, KeyParameters{Curve: "P-384", Hash: "SHA-384", SignatureFormat: "DER"}},
+		{"ECC P-256", "ECC", KeyParameters{Curve: "P-256"}, KeyParameters{Curve: "P-256", Hash: "SHA-256", SignatureFormat: "DER"}},
+		{"ECC P-521", "ECC", KeyParameters{Curve: "P-521"}, KeyParameters{Curve: "P-521", Hash: "SHA-512", SignatureFormat: "DER"}},
+		{"ECC keeps set hash", "ECC", KeyParameters{Curve: "P-521", Hash: "SHA-256"}, KeyParameters{Curve: "P-521", Hash: "SHA-256", SignatureFormat: "DER"}},
+		{"ECC keeps deterministic and format", "ECC", KeyParameters{Deterministic: true, SignatureFormat: "P1363"}, KeyParameters{Curve: "P-384", Hash: "SHA-384", Deterministic: true, SignatureFormat: "P1363"}},
+
+		//Ed25519 has no parameters to default
+		{"ED25519", "ED25519", KeyParameters{}, KeyParameters{}},
+		{"unknown algorithm", "DSA", KeyParameters{}, KeyParameters{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.params.WithDefaults(test.algorithm); got != test.want {
+				t.Errorf("WithDefaults(%s) = %+v, want %+v", test.algorithm, got, test.want)
+			}
+		})
+	}
+}
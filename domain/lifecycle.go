@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTransition is returned when a lifecycle transition is not allowed from the current state
+var ErrInvalidTransition = errors.New("invalid device state transition")
+
+// DeviceState is the lifecycle state of a signature device. Only active devices sign,
+// retired devices keep their signature history and public key for verification.
+type DeviceState string
+
+const (
+	DeviceInactive  DeviceState = "INACTIVE"
+	DeviceActive    DeviceState = "ACTIVE"
+	DeviceSuspended DeviceState = "SUSPENDED"
+	DeviceRetired   DeviceState = "RETIRED"
+)
+
+// DeviceTransition moves a device from one lifecycle state to another.
+type DeviceTransition string
+
+const (
+	Activate DeviceTransition = "activate"
+	Suspend  DeviceTransition = "suspend"
+	Resume   DeviceTransition = "resume"
+	Retire   DeviceTransition = "retire"
+)
+
+// deviceTransitions maps each transition to the states it is allowed from and the state it leads to
+var deviceTransitions = map[DeviceTransition]struct {
+	from []DeviceState
+	to   DeviceState
+}{
+	Activate: {from: []DeviceState{DeviceInactive}, to: DeviceActive},
+	Suspend:  {from: []DeviceState{DeviceActive}, to: DeviceSuspended},
+	Resume:   {from: []DeviceState{DeviceSuspended}, to: DeviceActive},
+	Retire:   {from: []DeviceState{DeviceInactive, DeviceActive, DeviceSuspended}, to: DeviceRetired},
+}
+
+// ParseDeviceTransition returns the transition with the given name.
+func ParseDeviceTransition(name string) (DeviceTransition, bool) {
+	transition := DeviceTransition(name)
+	_, ok := deviceTransitions[transition]
+	return transition, ok
+}
+
+// Apply returns the state reached by the transition, or ErrInvalidTransition.
+func (s DeviceState) Apply(transition DeviceTransition) (DeviceState, error) {
+	rule, ok := deviceTransitions[transition]
+	if !ok {
+		return s, fmt.Errorf("%w: unknown transition %q", ErrInvalidTransition, transition)
+	}
+
+	for _, from := range rule.from {
+		if s == from {
+			return rule.to, nil
+		}
+	}
+
+	return s, fmt.Errorf("%w: cannot %s a device in state %s", ErrInvalidTransition, transition, s)
+}
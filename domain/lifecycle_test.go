@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeviceStateApply(t *testing.T) {
+	tests := []struct {
+		from       DeviceState
+		transition DeviceTransition
+		want       DeviceState
+		allowed    bool
+	}{
+		{DeviceInactive, Activate, DeviceActive, true},
+		{DeviceInactive, Suspend, DeviceInactive, false},
+		{DeviceInactive, Resume, DeviceInactive, false},
+		{DeviceInactive, Retire, DeviceRetired, true},
+
+		{DeviceActive, Activate, DeviceActive, false},
+		{DeviceActive, Suspend, DeviceSuspended, true},
+		{DeviceActive, Resume, DeviceActive, false},
+		{DeviceActive, Retire, DeviceRetired, true},
+
+		{DeviceSuspended, Activate, DeviceSuspended, false},
+		{DeviceSuspended, Suspend, DeviceSuspended, false},
+		{DeviceSuspended, Resume, DeviceActive, true},
+		{DeviceSuspended, Retire, DeviceRetired, true},
+
+		//Retired is final
+		{DeviceRetired, Activate, DeviceRetired, false},
+		{DeviceRetired, Suspend, DeviceRetired, false},
+		{DeviceRetired, Resume, DeviceRetired, false},
+		{DeviceRetired, Retire, DeviceRetired, false},
+
+		{DeviceActive, DeviceTransition("delete"), DeviceActive, false},
+		{DeviceActive, DeviceTransition(""), DeviceActive, false},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.from)+" "+string(test.transition), func(t *testing.T) {
+			state, err := test.from.Apply(test.transition)
+			if test.allowed && err != nil {
+				t.Fatalf("Apply(%q) = %v", test.transition, err)
+			}
+			if !test.allowed && !errors.Is(err, ErrInvalidTransition) {
+				t.Fatalf("Apply(%q) = %v, want %v", test.transition, err, ErrInvalidTransition)
+			}
+			if state != test.want {
+				t.Errorf("Apply(%q) = %s, want %s", test.transition, state, test.want)
+			}
+		})
+	}
+}
+
+func TestParseDeviceTransition(t *testing.T) {
+	tests := []struct {
+		name string
+		want DeviceTransition
+		ok   bool
+	}{
+		{"activate", Activate, true},
+		{"suspend", Suspend, true},
+		{"resume", Resume, true},
+		{"retire", Retire, true},
+		{"Retire", "", false},
+		{"delete", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		transition, ok := ParseDeviceTransition(test.name)
+		if ok != test.ok || (ok && transition != test.want) {
+			t.Errorf("ParseDeviceTransition(%q) = %q, %t, want %q, %t", test.name, transition, ok, test.want, test.ok)
+		}
+	}
+}
@@ -1,23 +1,89 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
 	"signing-service/api"
 	"signing-service/config"
+	"signing-service/logger"
+	"signing-service/persistence"
+	"signing-service/service"
+	"syscall"
+	"time"
 )
 
 const (
-// ListenAddress =
-// TODO: add further configuration parameters here ...
+	// ShutdownTimeout is how long running requests get to finish on shutdown
+	ShutdownTimeout = 10 * time.Second
 )
 
 func main() {
 
+	if err := persistence.OpenDB(config.Env.Database); err != nil {
+		log.Fatalf("Could not open database, Error: %v", err)
+	}
+	defer func() {
+		if err := persistence.CloseDB(); err != nil {
+			log.Printf("Could not close database, Error: %v", err)
+		}
+	}()
+
+	if err := persistence.LoadKeyring(config.Env.Encryption, logger.Logger); err != nil {
+		log.Fatalf("Could not load master key, Error: %v", err)
+	}
+	rewrapped, err := persistence.RewrapDeviceKeys(persistence.Keys)
+	if err != nil {
+		log.Fatalf("Could not re-wrap device keys with the current master key, Error: %v", err)
+	}
+	if rewrapped > 0 {
+		logger.Logger.Printf("Re-wrapped %d device keys with the current master key", rewrapped)
+	}
+	rewrapped, err = persistence.RewrapCAKeys(persistence.Keys)
+	if err != nil {
+		log.Fatalf("Could not re-wrap CA keys with the current master key, Error: %v", err)
+	}
+	if rewrapped > 0 {
+		logger.Logger.Printf("Re-wrapped %d CA keys with the current master key", rewrapped)
+	}
+
+	if err := service.LoadCertificateAuthority(config.Env.CertificateAuthority, logger.Logger); err != nil {
+		log.Fatalf("Could not load certificate authority, Error: %v", err)
+	}
+
+	stopGC := make(chan struct{})
+	defer close(stopGC)
+	go persistence.RunValueLogGC(config.Env.Database, logger.Logger, stopGC)
+
 	server := api.NewServer(fmt.Sprintf(":%s", config.Env.Port))
+	if err := server.LoadAdminToken(config.Env.Admin); err != nil {
+		log.Fatalf("Could not load admin token, Error: %v", err)
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Run()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Could not start server on %s, Error: %v", config.Env.Port, err)
+		}
+	case sig := <-signals:
+		log.Printf("Received %s, shutting down", sig)
 
-	if err := server.Run(); err != nil {
-		log.Fatal("Could not start server on ", config.Env.Port)
-		log.Printf("Error: ", err.Error())
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Could not shut down server gracefully, Error: %v", err)
+		}
 	}
 }
@@ -0,0 +1,202 @@
+package persistence
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+// caKeyPrefix namespaces certificate authority records in the key-value store
+const caKeyPrefix = "ca/"
+
+// Names of the certificate authority records
+const (
+	RootCAName         = "root"
+	IntermediateCAName = "intermediate"
+)
+
+// ErrCANotFound is returned when no certificate authority record is stored for the name
+var ErrCANotFound = errors.New("certificate authority not found")
+
+// ErrCAExists is returned when a certificate authority record is created twice
+var ErrCAExists = errors.New("certificate authority already exists")
+
+// CAInfo is a certificate authority key with its certificate
+type CAInfo struct {
+	Name        string
+	Certificate *x509.Certificate
+	PrivateKey  crypto.Signer
+}
+
+// caRecord is the stored form of a CAInfo, the private key is PKCS#8 PEM sealed with the Keyring
+type caRecord struct {
+	Certificate []byte     `json:"certificate"`
+	PrivateKey  *SealedKey `json:"private_key"`
+}
+
+type ICertificateAuthority interface {
+	CreateCertificateAuthority(caInfo *CAInfo) error
+	GetCertificateAuthority(name string) (*CAInfo, error)
+}
+
+type CADAO struct {
+	log    *log.Logger
+	dbConn *badger.DB
+	keys   *Keyring
+}
+
+// NewCA creates a CADAO on the shared database connection and keyring
+func NewCA(l *log.Logger) *CADAO {
+	return &CADAO{
+		log:    l,
+		dbConn: DBConn,
+		keys:   Keys,
+	}
+}
+
+// caKey returns the store key of the certificate authority record
+func caKey(name string) []byte {
+	return []byte(caKeyPrefix + name)
+}
+
+// CreateCertificateAuthority seals the CA private key and writes the record, an existing
+// record is never overwritten
+func (s *CADAO) CreateCertificateAuthority(caInfo *CAInfo) error {
+	privateKey, err := x509.MarshalPKCS8PrivateKey(caInfo.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	record := caRecord{Certificate: caInfo.Certificate.Raw}
+	record.PrivateKey, err = s.keys.Seal(pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privateKey,
+	}), caKey(caInfo.Name))
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return s.dbConn.Update(func(txn *badger.Txn) error {
+		_, err := txn.Get(caKey(caInfo.Name))
+		if err == nil {
+			return ErrCAExists
+		}
+		if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+
+		return txn.Set(caKey(caInfo.Name), value)
+	})
+}
+
+// GetCertificateAuthority reads the CA record and opens its sealed private key
+func (s *CADAO) GetCertificateAuthority(name string) (*CAInfo, error) {
+	var record caRecord
+
+	err := s.dbConn.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(caKey(name))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrCANotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(v []byte) error {
+			return json.Unmarshal(v, &record)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := x509.ParseCertificate(record.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("certificate authority %s: %v", name, err)
+	}
+
+	privateKeyPEM, err := s.keys.Open(record.PrivateKey, caKey(name))
+	if err != nil {
+		return nil, fmt.Errorf("certificate authority %s: %v", name, err)
+	}
+
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("certificate authority %s: no PEM block found in private key", name)
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("certificate authority %s: %v", name, err)
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("certificate authority %s: private key cannot sign", name)
+	}
+
+	return &CAInfo{
+		Name:        name,
+		Certificate: certificate,
+		PrivateKey:  signer,
+	}, nil
+}
+
+// RewrapCAKeys re-wraps the data keys of all CA records still wrapped with a retired
+// master key. It returns the number of updated records.
+func RewrapCAKeys(keys *Keyring) (int, error) {
+	updated := 0
+
+	err := DBConn.Update(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		updates := map[string][]byte{}
+		prefix := []byte(caKeyPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var record caRecord
+			err := it.Item().Value(func(v []byte) error {
+				return json.Unmarshal(v, &record)
+			})
+			if err != nil {
+				return err
+			}
+
+			if record.PrivateKey == nil {
+				return fmt.Errorf("certificate authority record %s holds no private key", it.Item().Key())
+			}
+			changed, err := keys.Rewrap(record.PrivateKey)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+
+			value, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			updates[string(it.Item().KeyCopy(nil))] = value
+		}
+
+		for key, value := range updates {
+			if err := txn.Set([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		updated = len(updates)
+		return nil
+	})
+
+	return updated, err
+}
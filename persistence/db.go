@@ -1,7 +1,10 @@
 package persistence
 
 import (
+	"errors"
 	"log"
+	"signing-service/config"
+	"time"
 
 	badger "github.com/dgraph-io/badger/v3"
 )
@@ -9,15 +12,64 @@ import (
 // DBConn is the connection for the database used - r DB
 var DBConn *badger.DB
 
-func init() {
-	DBConn = initDB()
-}
+// OpenDB opens the Badger database described by the config and makes it the DBConn
+func OpenDB(dbConfig config.DatabaseConfig) error {
+	var options badger.Options
+	if dbConfig.InMemory {
+		options = badger.DefaultOptions("").WithInMemory(true)
+	} else {
+		options = badger.DefaultOptions(dbConfig.DataDir).
+			WithSyncWrites(dbConfig.SyncWrites)
+	}
+
+	if dbConfig.ValueLogFileSizeMB > 0 {
+		options = options.WithValueLogFileSize(dbConfig.ValueLogFileSizeMB << 20)
+	}
 
-func initDB() *badger.DB {
-	dbConn, err := badger.Open(badger.DefaultOptions("").WithInMemory(true)) // badger.Open(badger.DefaultOptions("./tmp/badger").WithTruncate(true)) //badger.Open(badger.DefaultOptions("").WithInMemory(true))
+	dbConn, err := badger.Open(options)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	DBConn = dbConn
+	return nil
+}
+
+// CloseDB flushes pending writes and closes the DBConn
+func CloseDB() error {
+	if DBConn == nil {
+		return nil
 	}
 
-	return dbConn
+	return DBConn.Close()
+}
+
+// RunValueLogGC periodically reclaims value log space until stop is closed.
+// In-memory databases have no value log, so nothing is run for them.
+func RunValueLogGC(dbConfig config.DatabaseConfig, l *log.Logger, stop <-chan struct{}) {
+	if dbConfig.InMemory || dbConfig.ValueLogGCIntervalSeconds <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(dbConfig.ValueLogGCIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// One call rewrites at most one file, so repeat while files are being reclaimed
+			for {
+				err := DBConn.RunValueLogGC(dbConfig.ValueLogGCDiscardRatio)
+				if err == nil {
+					continue
+				}
+				if !errors.Is(err, badger.ErrNoRewrite) {
+					l.Printf("value log GC failed: %v", err)
+				}
+				break
+			}
+		}
+	}
 }
@@ -2,56 +2,161 @@ package persistence
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"signing-service/domain"
 	"signing-service/signingCrypto"
 	"strings"
+	"sync"
+	"time"
 
 	badger "github.com/dgraph-io/badger/v3"
 )
 
 type RSAKeyPair *signingCrypto.RSAKeyPair
 type ECCKeyPair *signingCrypto.ECCKeyPair
+type Ed25519KeyPair *signingCrypto.Ed25519KeyPair
+
+// deviceKeyPrefix namespaces device records in the key-value store
+const deviceKeyPrefix = "device/"
+
+// ErrDeviceNotFound is returned when no device record is stored for the id
+var ErrDeviceNotFound = errors.New("device not found")
+
+// ErrDeviceExists is returned when a device record is already stored for the id
+var ErrDeviceExists = errors.New("device already exists")
+
+// maxTxnRetries bounds how often a conflicting transaction is retried
+const maxTxnRetries = 10
+
+// deviceLocks serializes signature chain updates per device within this process
+var deviceLocks sync.Map
 
 type DeviceInfo struct {
-	Id         string     `json:"id"`
-	Algorithm  string     `json:"algorithm"`
-	Label      string     `json:"label"`
-	RSAKeyPair RSAKeyPair `json:"rsaKeyPair"`
-	ECCKeyPair ECCKeyPair `json:"eccKeyPair"`
+	Id                            string                  `json:"id"`
+	Algorithm                     string                  `json:"algorithm"`
+	Label                         string                  `json:"label"`
+	Tenant                        string                  `json:"tenant,omitempty"`
+	State                         domain.DeviceState      `json:"state"`
+	SignatureCounter              int                     `json:"signature_counter"`
+	Last_Signature_Base64_Encoded string                  `json:"last_signature_base64_encoded"`
+	CreatedAt                     time.Time               `json:"created_at"`
+	RetiredAt                     time.Time               `json:"retired_at"`
+	KeyParameters                 domain.KeyParameters    `json:"key_parameters"`
+	Certificate                   []byte                  `json:"certificate,omitempty"`
+	CertificateChain              [][]byte                `json:"certificate_chain,omitempty"`
+	SupersededCertificates        []SupersededCertificate `json:"superseded_certificates,omitempty"`
+	KeyCreatedAt                  time.Time               `json:"key_created_at"`
+	KeyVersions                   []KeyVersion            `json:"key_versions,omitempty"`
+	ImportedSignatureCounter      int                     `json:"imported_signature_counter,omitempty"`
+	ImportedLastSignature         string                  `json:"imported_last_signature,omitempty"`
+	SignatureGaps                 []SignatureGap          `json:"signature_gaps,omitempty"`
+	RSAKeyPair                    RSAKeyPair              `json:"-"`
+	ECCKeyPair                    ECCKeyPair              `json:"-"`
+	Ed25519KeyPair                Ed25519KeyPair          `json:"-"`
+}
+
+// SupersededCertificate is a certificate of the current device key that an uploaded
+// certificate replaced. It is revoked as of SupersededAt.
+type SupersededCertificate struct {
+	Certificate  []byte    `json:"certificate"`
+	SupersededAt time.Time `json:"superseded_at"`
+}
+
+// SignatureGap is a range of signature counters of the device chain the store holds no
+// history for, because a restored backup was ahead of the device. LastSignature is the
+// signature of counter To the chain continues with.
+type SignatureGap struct {
+	From          int    `json:"from"`
+	To            int    `json:"to"`
+	LastSignature string `json:"last_signature"`
+}
+
+// KeyVersion is a rotated key of a device. It signed the signature counters from
+// FirstSignature up to LastSignature, the key rotation link handing the chain over to
+// the next version. Only the public key is kept.
+type KeyVersion struct {
+	Version        int       `json:"version"`
+	PublicKey      string    `json:"public_key"`
+	FirstSignature int       `json:"first_signature"`
+	LastSignature  int       `json:"last_signature"`
+	CreatedAt      time.Time `json:"created_at"`
+	RotatedAt      time.Time `json:"rotated_at"`
+	// Certificate is the DER encoded certificate the key had when it was rotated
+	Certificate []byte `json:"certificate,omitempty"`
 }
 
 type IDevice interface {
 	CreateSignatureDevice(deviceInfo *DeviceInfo) error
 	GetSignatureDeviceInfo(id string) (*DeviceInfo, error)
-	SaveLastSignatureBase64(last_signature_base64_encoded string) error
-	GetLastSignatureBase64() string
-	SaveSignatureCounter(signature_counter int) error
-	GetSignatureCounter() int
+	ListSignatureDevices(cursor string, limit int, filter DeviceFilter) ([]*DeviceInfo, string, error)
+	UpdateSignatureDevice(id string, update func(deviceInfo *DeviceInfo) error) (*DeviceInfo, error)
+	AdvanceSignatureChain(id string, advance func(deviceInfo *DeviceInfo) (*SignatureRecord, error)) (*DeviceInfo, error)
+	ListSignatureRecords(id string, from int, to int, limit int) ([]*SignatureRecord, error)
+}
+
+// DeviceFilter selects the devices returned by ListSignatureDevices, empty fields match every device
+type DeviceFilter struct {
+	Algorithm string
+	Label     string
+	State     domain.DeviceState
+	// KeyCreatedBefore selects devices whose current key was created before the time
+	KeyCreatedBefore time.Time
+}
+
+// matches reports whether the device passes the filter, the label matches as case-insensitive substring
+func (f DeviceFilter) matches(deviceInfo *DeviceInfo) bool {
+	if f.Algorithm != "" && !strings.EqualFold(f.Algorithm, deviceInfo.Algorithm) {
+		return false
+	}
+	if f.State != "" && f.State != deviceInfo.State {
+		return false
+	}
+	if !f.KeyCreatedBefore.IsZero() && !deviceInfo.KeyCreatedAt.Before(f.KeyCreatedBefore) {
+		return false
+	}
+
+	return strings.Contains(strings.ToLower(deviceInfo.Label), strings.ToLower(f.Label))
 }
 
 type DeviceDAO struct {
 	log    *log.Logger
 	dbConn *badger.DB
+	keys   *Keyring
 }
 
 func New(l *log.Logger) *DeviceDAO {
 	return &DeviceDAO{
 		log:    l,
 		dbConn: DBConn,
+		keys:   Keys,
 	}
 }
 
-// Save last_signature_base64_encoded writes the key value to the db
+// deviceKey returns the store key of the device record
+func deviceKey(id string) []byte {
+	return []byte(deviceKeyPrefix + id)
+}
+
+// CreateSignatureDevice writes the device record to the db, an existing record is never overwritten
 func (s *DeviceDAO) CreateSignatureDevice(deviceInfo *DeviceInfo) error {
 
-	objJson, err := json.Marshal(deviceInfo)
+	objJson, err := encodeDeviceInfo(s.keys, deviceInfo)
 	if err == nil {
 
 		err := s.dbConn.Update(func(txn *badger.Txn) error {
 
-			err := txn.Set(
-				[]byte(deviceInfo.Id),
+			_, err := txn.Get(deviceKey(deviceInfo.Id))
+			if err == nil {
+				return fmt.Errorf("%w: %s", ErrDeviceExists, deviceInfo.Id)
+			}
+			if !errors.Is(err, badger.ErrKeyNotFound) {
+				return err
+			}
+
+			err = txn.Set(
+				deviceKey(deviceInfo.Id),
 				[]byte(objJson),
 			)
 			return err
@@ -61,133 +166,162 @@ func (s *DeviceDAO) CreateSignatureDevice(deviceInfo *DeviceInfo) error {
 
 	return err
 }
+
 func (s *DeviceDAO) GetSignatureDeviceInfo(id string) (*DeviceInfo, error) {
-	var deviceInfo_session *badger.Item
 	var deviceInfo *DeviceInfo
-	//var tmpDeviceInfo DeviceInfo
 
-	var deviceByte []byte
 	err := s.dbConn.View(func(txn *badger.Txn) error {
 		var err error
-		deviceInfo_session, err = txn.Get([]byte(id))
-		if err != nil {
-			return err
-		}
-
-		err = deviceInfo_session.Value(func(v []byte) error {
-
-			deviceByte = append([]byte{}, v...)
-
-			if err := json.Unmarshal(deviceByte, &deviceInfo); err != nil {
-				resolveUnmarshalErr(deviceByte, err)
-				return err
-			}
-			return err
-
-		})
+		deviceInfo, err = s.getDeviceInfo(txn, id)
 		return err
 	})
 
 	return deviceInfo, err
 }
 
-// Save last_signature_base64_encoded writes the key value to the db
-func (s *DeviceDAO) SaveLastSignatureBase64(last_signature_base64_encoded string) error {
-
-	objJson, err := json.Marshal(last_signature_base64_encoded)
-	if err == nil {
-		err := s.dbConn.Update(func(txn *badger.Txn) error {
-
-			err := txn.Set(
-				[]byte("last_signature_base64_encoded"),
-				[]byte(objJson),
-			)
-			return err
-		})
-		return err
-	}
-	return err
-}
-
-func (s *DeviceDAO) GetLastSignatureBase64() string {
-	var last_signature_base64_encoded_session *badger.Item
-	var last_signature_base64_encoded string
-
-	var last_signature_base64_encodedByte []byte
+// ListSignatureDevices returns up to limit devices ordered by id, starting after the
+// device id in cursor. Private keys are not decrypted, the returned devices only carry
+// their public keys. The returned cursor is empty when there are no further devices.
+func (s *DeviceDAO) ListSignatureDevices(cursor string, limit int, filter DeviceFilter) ([]*DeviceInfo, string, error) {
+	devices := []*DeviceInfo{}
+	nextCursor := ""
 
 	err := s.dbConn.View(func(txn *badger.Txn) error {
-		var err error
-		last_signature_base64_encoded_session, err = txn.Get([]byte("last_signature_base64_encoded"))
-		if err != nil {
-			return err
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(deviceKeyPrefix)
+		start := prefix
+		if cursor != "" {
+			// Seek to the first key after the cursor device
+			start = append(deviceKey(cursor), 0)
 		}
 
-		err = last_signature_base64_encoded_session.Value(func(v []byte) error {
-			last_signature_base64_encodedByte = append([]byte{}, v...)
-			if err := json.Unmarshal(last_signature_base64_encodedByte, &last_signature_base64_encoded); err != nil {
+		for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+			var deviceInfo *DeviceInfo
+			err := it.Item().Value(func(v []byte) error {
+				var err error
+				deviceInfo, err = decodeDevicePublicInfo(s.keys, v)
+				return err
+			})
+			if err != nil {
 				return err
 			}
-			return nil
-		})
 
-		return err
+			if !filter.matches(deviceInfo) {
+				continue
+			}
+
+			if len(devices) == limit {
+				nextCursor = devices[len(devices)-1].Id
+				break
+			}
+			devices = append(devices, deviceInfo)
+		}
+
+		return nil
 	})
 
-	if err != nil {
-		last_signature_base64_encoded = ""
-	}
-	return last_signature_base64_encoded
+	return devices, nextCursor, err
 }
 
-// Save Signature Counter writes the key value to the db
-func (s *DeviceDAO) SaveSignatureCounter(signature_counter int) error {
-
-	objJson, err := json.Marshal(signature_counter)
-	if err == nil {
-		err := s.dbConn.Update(func(txn *badger.Txn) error {
+// UpdateSignatureDevice reads the device record, lets update change it and stores the
+// result in a single transaction.
+func (s *DeviceDAO) UpdateSignatureDevice(id string, update func(deviceInfo *DeviceInfo) error) (*DeviceInfo, error) {
+	return s.updateDevice(id, func(txn *badger.Txn, deviceInfo *DeviceInfo) error {
+		return update(deviceInfo)
+	})
+}
 
-			err := txn.Set(
-				[]byte("signature_counter"),
-				[]byte(objJson),
-			)
+// AdvanceSignatureChain reads the device record and lets advance sign the next link of
+// the chain. The returned signature record is added to the device history and becomes
+// the new signature counter and last signature of the device, all in a single
+// transaction. Conflicting transactions are retried, so the counter stays strictly
+// increasing and gap-free under concurrent requests.
+func (s *DeviceDAO) AdvanceSignatureChain(id string, advance func(deviceInfo *DeviceInfo) (*SignatureRecord, error)) (*DeviceInfo, error) {
+	return s.updateDevice(id, func(txn *badger.Txn, deviceInfo *DeviceInfo) error {
+		record, err := advance(deviceInfo)
+		if err != nil {
 			return err
-		})
-		return err
-	}
-	return err
-}
+		}
 
-func (s *DeviceDAO) GetSignatureCounter() int {
-	var counterSession *badger.Item
-	var counterByte []byte
-	var counter int
+		if record.DeviceId != id || record.SignatureCounter != deviceInfo.SignatureCounter+1 {
+			return fmt.Errorf("signature record %d does not continue the chain of device %s at %d",
+				record.SignatureCounter, id, deviceInfo.SignatureCounter)
+		}
 
-	err := s.dbConn.View(func(txn *badger.Txn) error {
-		var err error
-		counterSession, err = txn.Get([]byte("signature_counter"))
-		if err != nil {
+		if err := setSignatureRecord(txn, record); err != nil {
 			return err
 		}
 
-		err = counterSession.Value(func(v []byte) error {
+		deviceInfo.SignatureCounter = record.SignatureCounter
+		deviceInfo.Last_Signature_Base64_Encoded = record.Signature
+		return nil
+	})
+}
 
-			//log.Printf("key=%s, value=%s\n", counterSession.Key(), v)
+// updateDevice runs a read-modify-write of the device record in one transaction.
+// Updates of a device are serialized and retried when the transaction conflicts.
+func (s *DeviceDAO) updateDevice(id string, update func(txn *badger.Txn, deviceInfo *DeviceInfo) error) (*DeviceInfo, error) {
+	lock, _ := deviceLocks.LoadOrStore(id, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
 
-			counterByte = append([]byte{}, v...)
-			if err := json.Unmarshal(counterByte, &counter); err != nil {
+	var deviceInfo *DeviceInfo
+	var err error
+
+	for attempt := 0; attempt < maxTxnRetries; attempt++ {
+		err = s.dbConn.Update(func(txn *badger.Txn) error {
+			var err error
+			deviceInfo, err = s.getDeviceInfo(txn, id)
+			if err != nil {
 				return err
 			}
-			return err
+
+			if err := update(txn, deviceInfo); err != nil {
+				return err
+			}
+
+			objJson, err := encodeDeviceInfo(s.keys, deviceInfo)
+			if err != nil {
+				return err
+			}
+
+			return txn.Set(deviceKey(id), objJson)
 		})
 
-		return err
-	})
+		if !errors.Is(err, badger.ErrConflict) {
+			break
+		}
+		s.log.Printf("update of device %s conflicted, retrying", id)
+	}
 
 	if err != nil {
-		counter = 0
+		return nil, err
 	}
 
-	return counter
+	return deviceInfo, nil
+}
+
+// getDeviceInfo reads and decodes the device record within the given transaction
+func (s *DeviceDAO) getDeviceInfo(txn *badger.Txn, id string) (*DeviceInfo, error) {
+	var deviceInfo *DeviceInfo
+
+	deviceInfo_session, err := txn.Get(deviceKey(id))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = deviceInfo_session.Value(func(v []byte) error {
+		var err error
+		deviceInfo, err = decodeDeviceInfo(s.keys, v)
+		return err
+	})
+
+	return deviceInfo, err
 }
 
 func resolveUnmarshalErr(data []byte, err error) string {
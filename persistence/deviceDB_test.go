@@ -0,0 +1,98 @@
+package persistence
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// createKeylessDevices stores devices without key pairs, listing does not need keys
+func createKeylessDevices(t *testing.T, devices ...*DeviceInfo) {
+	t.Helper()
+
+	for _, deviceInfo := range devices {
+		if err := New(testLogger).CreateSignatureDevice(deviceInfo); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func deviceIds(devices []*DeviceInfo) []string {
+	ids := []string{}
+	for _, deviceInfo := range devices {
+		ids = append(ids, deviceInfo.Id)
+	}
+	return ids
+}
+
+func TestListSignatureDevicesPages(t *testing.T) {
+	openTestDB(t)
+	useKeyring(t, NewKeyring(newTestMasterKey(t)))
+	for i := 1; i <= 5; i++ {
+		createKeylessDevices(t, &DeviceInfo{Id: fmt.Sprintf("device-%d", i), Algorithm: "ECC"})
+	}
+
+	tests := []struct {
+		name       string
+		cursor     string
+		limit      int
+		want       []string
+		nextCursor string
+	}{
+		{"first page", "", 2, []string{"device-1", "device-2"}, "device-2"},
+		{"middle page", "device-2", 2, []string{"device-3", "device-4"}, "device-4"},
+		{"last page", "device-4", 2, []string{"device-5"}, ""},
+		{"page of all devices", "", 5, []string{"device-1", "device-2", "device-3", "device-4", "device-5"}, ""},
+		{"one device short", "", 4, []string{"device-1", "device-2", "device-3", "device-4"}, "device-4"},
+		{"page of one", "device-1", 1, []string{"device-2"}, "device-2"},
+		{"cursor between devices", "device-3a", 5, []string{"device-4", "device-5"}, ""},
+		{"cursor before all devices", "a", 1, []string{"device-1"}, "device-1"},
+		{"cursor after all devices", "device-5", 5, []string{}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			devices, nextCursor, err := New(testLogger).ListSignatureDevices(test.cursor, test.limit, DeviceFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := deviceIds(devices); !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("got devices %v, want %v", ids, test.want)
+			}
+			if nextCursor != test.nextCursor {
+				t.Errorf("got next cursor %q, want %q", nextCursor, test.nextCursor)
+			}
+		})
+	}
+}
+
+// TestListSignatureDevicesFilterPages checks that the next cursor is only set if another
+// device passes the filter
+func TestListSignatureDevicesFilterPages(t *testing.T) {
+	openTestDB(t)
+	useKeyring(t, NewKeyring(newTestMasterKey(t)))
+	createKeylessDevices(t,
+		&DeviceInfo{Id: "a", Algorithm: "ECC", Label: "Till 1"},
+		&DeviceInfo{Id: "b", Algorithm: "RSA", Label: "Till 2"},
+		&DeviceInfo{Id: "c", Algorithm: "ECC", Label: "Kiosk"},
+		&DeviceInfo{Id: "d", Algorithm: "ECC", Label: "till 3"},
+		&DeviceInfo{Id: "e", Algorithm: "RSA", Label: "Kiosk"},
+	)
+
+	dao := New(testLogger)
+	devices, nextCursor, err := dao.ListSignatureDevices("", 1, DeviceFilter{Algorithm: "ecc", Label: "TILL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := deviceIds(devices); !reflect.DeepEqual(ids, []string{"a"}) || nextCursor != "a" {
+		t.Errorf("first page %v with cursor %q, want [a] with cursor a", ids, nextCursor)
+	}
+
+	devices, nextCursor, err = dao.ListSignatureDevices(nextCursor, 1, DeviceFilter{Algorithm: "ecc", Label: "TILL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := deviceIds(devices); !reflect.DeepEqual(ids, []string{"d"}) || nextCursor != "" {
+		t.Errorf("second page %v with cursor %q, want [d] without cursor", ids, nextCursor)
+	}
+}
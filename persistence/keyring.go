@@ -0,0 +1,260 @@
+package persistence
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"signing-service/config"
+	"strings"
+)
+
+// MasterKeyEnv is the environment variable holding the base64 encoded master key.
+// It takes precedence over the configured master key file.
+const MasterKeyEnv = "SIGNING_SERVICE_MASTER_KEY"
+
+// masterKeySize is the size of master and data keys, both are AES-256 keys
+const masterKeySize = 32
+
+// Keys is the keyring used to seal private keys at rest
+var Keys *Keyring
+
+// MasterKey is a key encryption key, it only ever encrypts data keys.
+type MasterKey struct {
+	Id  string
+	key []byte
+}
+
+// NewMasterKey creates a MasterKey, the id is derived from the key itself.
+func NewMasterKey(key []byte) (*MasterKey, error) {
+	if len(key) != masterKeySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", masterKeySize, len(key))
+	}
+
+	digest := sha256.Sum256(key)
+	return &MasterKey{
+		Id:  hex.EncodeToString(digest[:8]),
+		key: key,
+	}, nil
+}
+
+// Keyring holds the current master key and the retired ones still needed to unwrap old data keys.
+type Keyring struct {
+	current *MasterKey
+	keys    map[string]*MasterKey
+}
+
+// NewKeyring creates a Keyring that wraps new data keys with current.
+func NewKeyring(current *MasterKey, retired ...*MasterKey) *Keyring {
+	keyring := &Keyring{
+		current: current,
+		keys:    map[string]*MasterKey{current.Id: current},
+	}
+	for _, masterKey := range retired {
+		keyring.keys[masterKey.Id] = masterKey
+	}
+
+	return keyring
+}
+
+// SealedKey is an envelope encrypted secret. The secret is encrypted with a
+// random per-record data key, which itself is encrypted with a master key.
+type SealedKey struct {
+	MasterKeyId    string `json:"master_key_id"`
+	WrappedDataKey []byte `json:"wrapped_data_key"`
+	Ciphertext     []byte `json:"ciphertext"`
+}
+
+// Seal encrypts the plaintext with a fresh data key wrapped by the current master key.
+// The associated data binds the ciphertext to its record.
+func (k *Keyring) Seal(plaintext []byte, associatedData []byte) (*SealedKey, error) {
+	dataKey := make([]byte, masterKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := gcmSeal(dataKey, plaintext, associatedData)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedDataKey, err := gcmSeal(k.current.key, dataKey, []byte(k.current.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SealedKey{
+		MasterKeyId:    k.current.Id,
+		WrappedDataKey: wrappedDataKey,
+		Ciphertext:     ciphertext,
+	}, nil
+}
+
+// Open unwraps the data key of the sealed key and decrypts the secret.
+func (k *Keyring) Open(sealed *SealedKey, associatedData []byte) ([]byte, error) {
+	dataKey, err := k.unwrap(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcmOpen(dataKey, sealed.Ciphertext, associatedData)
+}
+
+// Rewrap wraps the data key of the sealed key with the current master key.
+// The encrypted secret is left untouched. It reports whether anything changed.
+func (k *Keyring) Rewrap(sealed *SealedKey) (bool, error) {
+	if sealed.MasterKeyId == k.current.Id {
+		return false, nil
+	}
+
+	dataKey, err := k.unwrap(sealed)
+	if err != nil {
+		return false, err
+	}
+
+	wrappedDataKey, err := gcmSeal(k.current.key, dataKey, []byte(k.current.Id))
+	if err != nil {
+		return false, err
+	}
+
+	sealed.MasterKeyId = k.current.Id
+	sealed.WrappedDataKey = wrappedDataKey
+	return true, nil
+}
+
+// unwrap decrypts the data key with the master key it was wrapped with
+func (k *Keyring) unwrap(sealed *SealedKey) ([]byte, error) {
+	masterKey, ok := k.keys[sealed.MasterKeyId]
+	if !ok {
+		return nil, fmt.Errorf("master key %s is not available", sealed.MasterKeyId)
+	}
+
+	return gcmOpen(masterKey.key, sealed.WrappedDataKey, []byte(masterKey.Id))
+}
+
+// gcmSeal encrypts with AES-GCM and prepends the random nonce to the ciphertext
+func gcmSeal(key []byte, plaintext []byte, associatedData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+// gcmOpen decrypts a ciphertext created by gcmSeal
+func gcmOpen(key []byte, ciphertext []byte, associatedData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, associatedData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// LoadKeyring loads the master keys described by the config and makes them the Keys.
+// The current master key is read from MasterKeyEnv or, if unset, from the master key
+// file, which is created with a random key on first start.
+func LoadKeyring(keyConfig config.MasterKeyConfig, l *log.Logger) error {
+	var current *MasterKey
+	var err error
+
+	if encoded := os.Getenv(MasterKeyEnv); encoded != "" {
+		current, err = decodeMasterKey([]byte(encoded))
+		if err != nil {
+			return fmt.Errorf("cannot read master key from %s: %v", MasterKeyEnv, err)
+		}
+	} else {
+		current, err = loadOrCreateMasterKeyFile(keyConfig.MasterKeyFile, l)
+		if err != nil {
+			return err
+		}
+	}
+
+	var retired []*MasterKey
+	for _, path := range keyConfig.RetiredMasterKeyFiles {
+		masterKey, err := loadMasterKeyFile(path)
+		if err != nil {
+			return err
+		}
+		retired = append(retired, masterKey)
+	}
+
+	Keys = NewKeyring(current, retired...)
+	return nil
+}
+
+func loadOrCreateMasterKeyFile(path string, l *log.Logger) (*MasterKey, error) {
+	masterKey, err := loadMasterKeyFile(path)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return masterKey, err
+	}
+
+	key := make([]byte, masterKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+	if err := ioutil.WriteFile(path, []byte(encoded), 0600); err != nil {
+		return nil, fmt.Errorf("cannot write master key file %s: %v", path, err)
+	}
+	l.Printf("Created new master key file %s", path)
+
+	return NewMasterKey(key)
+}
+
+func loadMasterKeyFile(path string) (*MasterKey, error) {
+	encoded, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read master key file %s: %w", path, err)
+	}
+
+	masterKey, err := decodeMasterKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read master key file %s: %v", path, err)
+	}
+
+	return masterKey, nil
+}
+
+func decodeMasterKey(encoded []byte) (*MasterKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMasterKey(key)
+}
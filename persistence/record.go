@@ -0,0 +1,338 @@
+package persistence
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"signing-service/domain"
+	"signing-service/signingCrypto"
+	"strings"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+const (
+	// schemaVersionJSONKeys records hold the key pairs as encoding/json of the crypto keys,
+	// either sealed or, before private keys were sealed, in plaintext. Records without
+	// schema_version are of this version.
+	schemaVersionJSONKeys = 1
+	// schemaVersionPEMKeys records hold the private key PEM encoded by the signingCrypto
+	// marshalers and sealed, plus the PEM encoded public key in plaintext.
+	schemaVersionPEMKeys = 2
+
+	// currentSchemaVersion is the version new records are written in
+	currentSchemaVersion = schemaVersionPEMKeys
+)
+
+// deviceRecord is the stored form of a DeviceInfo. The private key never reaches the
+// store in plaintext, it is sealed with the Keyring into PrivateKey.
+type deviceRecord struct {
+	SchemaVersion int `json:"schema_version"`
+	DeviceInfo
+	PublicKey  string     `json:"public_key,omitempty"`
+	PrivateKey *SealedKey `json:"private_key"`
+
+	// Records written before private keys were sealed carry the key pairs in plaintext
+	LegacyRSAKeyPair RSAKeyPair `json:"rsaKeyPair,omitempty"`
+	LegacyECCKeyPair ECCKeyPair `json:"eccKeyPair,omitempty"`
+}
+
+// legacyPrivateKeys is the plaintext sealed into schemaVersionJSONKeys records
+type legacyPrivateKeys struct {
+	RSAKeyPair RSAKeyPair `json:"rsaKeyPair"`
+	ECCKeyPair ECCKeyPair `json:"eccKeyPair"`
+}
+
+// encodeDeviceInfo seals the device private key and encodes the record to be written to the store
+func encodeDeviceInfo(keys *Keyring, deviceInfo *DeviceInfo) ([]byte, error) {
+	publicKey, privateKey, err := encodeKeyPair(deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	record := deviceRecord{
+		SchemaVersion: currentSchemaVersion,
+		DeviceInfo:    *deviceInfo,
+		PublicKey:     string(publicKey),
+	}
+
+	if privateKey != nil {
+		record.PrivateKey, err = keys.Seal(privateKey, []byte(deviceInfo.Id))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(record)
+}
+
+// decodeDeviceInfo decodes a stored record of any schema version and opens its sealed private key
+func decodeDeviceInfo(keys *Keyring, value []byte) (*DeviceInfo, error) {
+	record, err := unmarshalDeviceRecord(value)
+	if err != nil {
+		return nil, err
+	}
+	setDefaults(&record.DeviceInfo)
+
+	deviceInfo := record.DeviceInfo
+
+	switch record.SchemaVersion {
+	case schemaVersionJSONKeys:
+		legacyKeys := legacyPrivateKeys{
+			RSAKeyPair: record.LegacyRSAKeyPair,
+			ECCKeyPair: record.LegacyECCKeyPair,
+		}
+		if record.PrivateKey != nil {
+			privateKeys, err := keys.Open(record.PrivateKey, []byte(deviceInfo.Id))
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(privateKeys, &legacyKeys); err != nil && !isLegacyCurveError(err) {
+				return nil, errors.New(resolveUnmarshalErr(privateKeys, err))
+			}
+		}
+		deviceInfo.RSAKeyPair = legacyKeys.RSAKeyPair
+		deviceInfo.ECCKeyPair = legacyKeys.ECCKeyPair
+		restoreLegacyCurve(deviceInfo.ECCKeyPair)
+
+	case schemaVersionPEMKeys:
+		if record.PrivateKey == nil {
+			return &deviceInfo, nil
+		}
+		privateKey, err := keys.Open(record.PrivateKey, []byte(deviceInfo.Id))
+		if err != nil {
+			return nil, err
+		}
+		if err := decodeKeyPair(&deviceInfo, privateKey); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("device %s is stored in unknown schema version %d", deviceInfo.Id, record.SchemaVersion)
+	}
+
+	return &deviceInfo, nil
+}
+
+// decodeDevicePublicInfo decodes a stored record without opening its sealed private key.
+// The key pairs of the returned DeviceInfo only hold the public key.
+func decodeDevicePublicInfo(keys *Keyring, value []byte) (*DeviceInfo, error) {
+	record, err := unmarshalDeviceRecord(value)
+	if err != nil {
+		return nil, err
+	}
+
+	setDefaults(&record.DeviceInfo)
+	if record.SchemaVersion != schemaVersionPEMKeys {
+		deviceInfo, err := decodeDeviceInfo(keys, value)
+		if err != nil {
+			return nil, err
+		}
+		stripPrivateKeys(deviceInfo)
+		return deviceInfo, nil
+	}
+
+	deviceInfo := record.DeviceInfo
+	if record.PublicKey == "" {
+		return &deviceInfo, nil
+	}
+
+	block, _ := pem.Decode([]byte(record.PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("device %s has no valid public key", deviceInfo.Id)
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		deviceInfo.RSAKeyPair = &signingCrypto.RSAKeyPair{Public: key}
+	case *ecdsa.PublicKey:
+		deviceInfo.ECCKeyPair = &signingCrypto.ECCKeyPair{Public: key}
+	case ed25519.PublicKey:
+		deviceInfo.Ed25519KeyPair = &signingCrypto.Ed25519KeyPair{Public: key}
+	}
+
+	return &deviceInfo, nil
+}
+
+// setDefaults marks devices stored before the lifecycle existed as active, gives
+// devices stored before key parameters existed the parameters they were created with
+// and dates keys stored before key rotation existed to the device creation
+func setDefaults(deviceInfo *DeviceInfo) {
+	if deviceInfo.State == "" {
+		deviceInfo.State = domain.DeviceActive
+	}
+	if deviceInfo.KeyCreatedAt.IsZero() {
+		deviceInfo.KeyCreatedAt = deviceInfo.CreatedAt
+	}
+	deviceInfo.KeyParameters = deviceInfo.KeyParameters.WithDefaults(deviceInfo.Algorithm)
+}
+
+// stripPrivateKeys drops the private keys of the device, keeping the public keys
+func stripPrivateKeys(deviceInfo *DeviceInfo) {
+	if deviceInfo.RSAKeyPair != nil {
+		deviceInfo.RSAKeyPair = &signingCrypto.RSAKeyPair{Public: deviceInfo.RSAKeyPair.Public}
+	}
+	if deviceInfo.ECCKeyPair != nil {
+		deviceInfo.ECCKeyPair = &signingCrypto.ECCKeyPair{Public: deviceInfo.ECCKeyPair.Public}
+	}
+	if deviceInfo.Ed25519KeyPair != nil {
+		deviceInfo.Ed25519KeyPair = &signingCrypto.Ed25519KeyPair{Public: deviceInfo.Ed25519KeyPair.Public}
+	}
+}
+
+// encodeKeyPair PEM encodes the device key pair with the marshaler of the device algorithm
+func encodeKeyPair(deviceInfo *DeviceInfo) ([]byte, []byte, error) {
+	switch {
+	case deviceInfo.RSAKeyPair != nil:
+		rsaMarshaler := signingCrypto.NewRSAMarshaler()
+		return rsaMarshaler.Marshal(*deviceInfo.RSAKeyPair)
+	case deviceInfo.ECCKeyPair != nil:
+		return signingCrypto.NewECCMarshaler().Encode(*deviceInfo.ECCKeyPair)
+	case deviceInfo.Ed25519KeyPair != nil:
+		return signingCrypto.NewEd25519Marshaler().Encode(*deviceInfo.Ed25519KeyPair)
+	default:
+		return nil, nil, nil
+	}
+}
+
+// decodeKeyPair decodes the PEM encoded private key with the marshaler of the device algorithm
+func decodeKeyPair(deviceInfo *DeviceInfo, privateKey []byte) error {
+	switch deviceInfo.Algorithm {
+	case "RSA":
+		rsaMarshaler := signingCrypto.NewRSAMarshaler()
+		keyPair, err := rsaMarshaler.Unmarshal(privateKey)
+		if err != nil {
+			return err
+		}
+		deviceInfo.RSAKeyPair = keyPair
+	case "ECC":
+		keyPair, err := signingCrypto.NewECCMarshaler().Decode(privateKey)
+		if err != nil {
+			return err
+		}
+		deviceInfo.ECCKeyPair = keyPair
+	case "ED25519":
+		keyPair, err := signingCrypto.NewEd25519Marshaler().Decode(privateKey)
+		if err != nil {
+			return err
+		}
+		deviceInfo.Ed25519KeyPair = keyPair
+	default:
+		return fmt.Errorf("device %s has unsupported algorithm %q", deviceInfo.Id, deviceInfo.Algorithm)
+	}
+
+	return nil
+}
+
+// unmarshalDeviceRecord decodes a stored record without opening its sealed private key.
+// Plaintext ECC keys of schemaVersionJSONKeys records decode without their curve, see
+// restoreLegacyCurve. Records without schema_version get schemaVersionJSONKeys.
+func unmarshalDeviceRecord(value []byte) (*deviceRecord, error) {
+	var record deviceRecord
+	if err := json.Unmarshal(value, &record); err != nil && !isLegacyCurveError(err) {
+		return nil, errors.New(resolveUnmarshalErr(value, err))
+	}
+
+	if record.SchemaVersion == 0 {
+		record.SchemaVersion = schemaVersionJSONKeys
+	}
+	return &record, nil
+}
+
+// isLegacyCurveError reports whether err is encoding/json failing to decode the
+// elliptic.Curve interface of an ECDSA key, the rest of the key is still decoded.
+func isLegacyCurveError(err error) bool {
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &typeErr) && strings.HasSuffix(typeErr.Field, "Curve")
+}
+
+// restoreLegacyCurve sets the curve encoding/json could not restore on keys of
+// schemaVersionJSONKeys records. Those keys were always generated on P-384.
+func restoreLegacyCurve(keyPair *signingCrypto.ECCKeyPair) {
+	if keyPair == nil || keyPair.Private == nil {
+		return
+	}
+
+	keyPair.Private.Curve = elliptic.P384()
+	keyPair.Public = &keyPair.Private.PublicKey
+}
+
+// RewrapDeviceKeys re-wraps the data keys of all device records still wrapped with a
+// retired master key, the sealed private keys themselves are not decrypted. Records
+// of an older schema version are rewritten in the current one. It returns the number
+// of updated records.
+func RewrapDeviceKeys(keys *Keyring) (int, error) {
+	updates := map[string][]byte{}
+
+	err := DBConn.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(deviceKeyPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			record, err := unmarshalDeviceRecord(value)
+			if err != nil {
+				return err
+			}
+
+			if record.SchemaVersion != currentSchemaVersion {
+				deviceInfo, err := decodeDeviceInfo(keys, value)
+				if err != nil {
+					return err
+				}
+				if value, err = encodeDeviceInfo(keys, deviceInfo); err != nil {
+					return err
+				}
+			} else {
+				if record.PrivateKey == nil {
+					//Public key only records have no data key to re-wrap
+					continue
+				}
+				changed, err := keys.Rewrap(record.PrivateKey)
+				if err != nil {
+					return err
+				}
+				if !changed {
+					continue
+				}
+				if value, err = json.Marshal(record); err != nil {
+					return err
+				}
+			}
+
+			updates[string(it.Item().KeyCopy(nil))] = value
+		}
+
+		return nil
+	})
+	if err != nil || len(updates) == 0 {
+		return 0, err
+	}
+
+	batch := DBConn.NewWriteBatch()
+	defer batch.Cancel()
+
+	for key, value := range updates {
+		if err := batch.Set([]byte(key), value); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(updates), batch.Flush()
+}
@@ -0,0 +1,221 @@
+package persistence
+
+import (
+	"crypto"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"signing-service/config"
+	"signing-service/signingCrypto"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+var testLogger = log.New(ioutil.Discard, "", 0)
+
+// openTestDB opens a fresh database of the package config.json, an in-memory database
+func openTestDB(t *testing.T) {
+	t.Helper()
+
+	if err := OpenDB(config.Env.Database); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		CloseDB()
+	})
+}
+
+// useKeyring makes the keyring the Keys of the test
+func useKeyring(t *testing.T, keyring *Keyring) {
+	t.Helper()
+
+	previous := Keys
+	Keys = keyring
+	t.Cleanup(func() {
+		Keys = previous
+	})
+}
+
+// legacyDeviceRecord is a device record as written before records were versioned, with
+// the key pairs in plaintext or, once private keys were sealed, in PrivateKey
+type legacyDeviceRecord struct {
+	Id                            string     `json:"id"`
+	Algorithm                     string     `json:"algorithm"`
+	Label                         string     `json:"label"`
+	SignatureCounter              int        `json:"signature_counter"`
+	Last_Signature_Base64_Encoded string     `json:"last_signature_base64_encoded"`
+	RSAKeyPair                    RSAKeyPair `json:"rsaKeyPair,omitempty"`
+	ECCKeyPair                    ECCKeyPair `json:"eccKeyPair,omitempty"`
+	PrivateKey                    *SealedKey `json:"private_key,omitempty"`
+}
+
+func putRawRecord(t *testing.T, id string, record interface{}) {
+	t.Helper()
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DBConn.Update(func(txn *badger.Txn) error {
+		return txn.Set(deviceKey(id), value)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getRawRecord(t *testing.T, id string) []byte {
+	t.Helper()
+
+	var value []byte
+	err := DBConn.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(deviceKey(id))
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestRewrapDeviceKeysMigratesLegacyRecords(t *testing.T) {
+	openTestDB(t)
+	retiredMasterKey := newTestMasterKey(t)
+	currentMasterKey := newTestMasterKey(t)
+
+	rsaKeyPair, err := (&signingCrypto.RSAGenerator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Legacy ECC keys were always generated on P-384, the default of the generator
+	eccKeyPair, err := (&signingCrypto.ECCGenerator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealedKeyPair, err := (&signingCrypto.ECCGenerator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateKeys, err := json.Marshal(legacyPrivateKeys{ECCKeyPair: sealedKeyPair})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := NewKeyring(retiredMasterKey).Seal(privateKeys, []byte("legacy-sealed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	putRawRecord(t, "legacy-rsa", legacyDeviceRecord{Id: "legacy-rsa", Algorithm: "RSA", SignatureCounter: 3, Last_Signature_Base64_Encoded: "c2lnbmF0dXJl", RSAKeyPair: rsaKeyPair})
+	putRawRecord(t, "legacy-ecc", legacyDeviceRecord{Id: "legacy-ecc", Algorithm: "ECC", ECCKeyPair: eccKeyPair})
+	putRawRecord(t, "legacy-sealed", legacyDeviceRecord{Id: "legacy-sealed", Algorithm: "ECC", PrivateKey: sealed})
+
+	keyring := NewKeyring(currentMasterKey, retiredMasterKey)
+	useKeyring(t, keyring)
+	for _, id := range []string{"legacy-rsa", "legacy-ecc", "legacy-sealed"} {
+		if _, err := New(testLogger).GetSignatureDeviceInfo(id); err != nil {
+			t.Errorf("reading %s before the migration: %v", id, err)
+		}
+	}
+
+	updated, err := RewrapDeviceKeys(keyring)
+	if err != nil {
+		t.Fatalf("RewrapDeviceKeys: %v", err)
+	}
+	if updated != 3 {
+		t.Errorf("RewrapDeviceKeys updated %d records, want 3", updated)
+	}
+
+	//The migrated records open without the retired master key
+	currentKeyring := NewKeyring(currentMasterKey)
+	for id, want := range map[string]crypto.PrivateKey{
+		"legacy-rsa":    rsaKeyPair.Private,
+		"legacy-ecc":    eccKeyPair.Private,
+		"legacy-sealed": sealedKeyPair.Private,
+	} {
+		value := getRawRecord(t, id)
+
+		record, err := unmarshalDeviceRecord(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.SchemaVersion != currentSchemaVersion || record.PublicKey == "" {
+			t.Errorf("%s is stored in schema version %d with public key %q", id, record.SchemaVersion, record.PublicKey)
+		}
+		if record.LegacyRSAKeyPair != nil || record.LegacyECCKeyPair != nil {
+			t.Errorf("%s still holds a plaintext key pair", id)
+		}
+		if record.PrivateKey == nil || record.PrivateKey.MasterKeyId != currentMasterKey.Id {
+			t.Errorf("%s is not sealed with the current master key", id)
+		}
+
+		deviceInfo, err := decodeDeviceInfo(currentKeyring, value)
+		if err != nil {
+			t.Fatalf("decoding migrated %s: %v", id, err)
+		}
+		var privateKey interface{ Equal(crypto.PrivateKey) bool }
+		switch deviceInfo.Algorithm {
+		case "RSA":
+			privateKey = deviceInfo.RSAKeyPair.Private
+		case "ECC":
+			privateKey = deviceInfo.ECCKeyPair.Private
+		}
+		if !privateKey.Equal(want) {
+			t.Errorf("%s does not hold its private key after the migration", id)
+		}
+	}
+
+	rsaDevice, err := decodeDeviceInfo(currentKeyring, getRawRecord(t, "legacy-rsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsaDevice.SignatureCounter != 3 || rsaDevice.Last_Signature_Base64_Encoded != "c2lnbmF0dXJl" {
+		t.Errorf("migration lost the signature chain of legacy-rsa: %+v", *rsaDevice)
+	}
+
+	updated, err = RewrapDeviceKeys(keyring)
+	if err != nil || updated != 0 {
+		t.Errorf("second RewrapDeviceKeys updated %d records, %v", updated, err)
+	}
+}
+
+func TestRewrapDeviceKeysCurrentSchema(t *testing.T) {
+	openTestDB(t)
+	retiredMasterKey := newTestMasterKey(t)
+	currentMasterKey := newTestMasterKey(t)
+
+	keyPair, err := (&signingCrypto.Ed25519Generator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	useKeyring(t, NewKeyring(retiredMasterKey))
+	if err := New(testLogger).CreateSignatureDevice(&DeviceInfo{Id: "sealed", Algorithm: "ED25519", Ed25519KeyPair: keyPair}); err != nil {
+		t.Fatal(err)
+	}
+	//Records of devices without a key pair hold no sealed key to re-wrap
+	if err := New(testLogger).CreateSignatureDevice(&DeviceInfo{Id: "keyless", Algorithm: "ED25519"}); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := NewKeyring(currentMasterKey, retiredMasterKey)
+	updated, err := RewrapDeviceKeys(keyring)
+	if err != nil {
+		t.Fatalf("RewrapDeviceKeys: %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("RewrapDeviceKeys updated %d records, want 1", updated)
+	}
+
+	deviceInfo, err := decodeDeviceInfo(NewKeyring(currentMasterKey), getRawRecord(t, "sealed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deviceInfo.Ed25519KeyPair.Private.Equal(keyPair.Private) {
+		t.Error("re-wrapped record does not hold its private key")
+	}
+}
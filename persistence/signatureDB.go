@@ -0,0 +1,81 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+// signatureKeyPrefix namespaces signature records in the key-value store
+const signatureKeyPrefix = "signature/"
+
+// SignatureRecord is one link of a device signature chain.
+type SignatureRecord struct {
+	DeviceId         string    `json:"device_id"`
+	SignatureCounter int       `json:"signature_counter"`
+	SignedData       string    `json:"signed_data"`
+	Signature        string    `json:"signature"`
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// signaturePrefix returns the key prefix of all signature records of a device
+func signaturePrefix(id string) []byte {
+	return []byte(signatureKeyPrefix + id + "/")
+}
+
+// signatureKey returns the store key of a signature record. The counter is zero
+// padded, so the records of a device iterate in counter order.
+func signatureKey(id string, signature_counter int) []byte {
+	return []byte(fmt.Sprintf("%s%s/%020d", signatureKeyPrefix, id, signature_counter))
+}
+
+// ListSignatureRecords returns up to limit signature records of the device with a
+// signature counter in [from, to], ordered by counter. A to of 0 has no upper bound.
+func (s *DeviceDAO) ListSignatureRecords(id string, from int, to int, limit int) ([]*SignatureRecord, error) {
+	records := []*SignatureRecord{}
+
+	err := s.dbConn.View(func(txn *badger.Txn) error {
+		if _, err := txn.Get(deviceKey(id)); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return ErrDeviceNotFound
+			}
+			return err
+		}
+
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := signaturePrefix(id)
+		for it.Seek(signatureKey(id, from)); it.ValidForPrefix(prefix) && len(records) < limit; it.Next() {
+			var record SignatureRecord
+			err := it.Item().Value(func(v []byte) error {
+				return json.Unmarshal(v, &record)
+			})
+			if err != nil {
+				return err
+			}
+
+			if to > 0 && record.SignatureCounter > to {
+				break
+			}
+			records = append(records, &record)
+		}
+
+		return nil
+	})
+
+	return records, err
+}
+
+// setSignatureRecord writes the signature record within the given transaction
+func setSignatureRecord(txn *badger.Txn, record *SignatureRecord) error {
+	objJson, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return txn.Set(signatureKey(record.DeviceId, record.SignatureCounter), objJson)
+}
@@ -0,0 +1,97 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// appendSignatureRecords advances the chain of the device by count records
+func appendSignatureRecords(t *testing.T, id string, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		_, err := New(testLogger).AdvanceSignatureChain(id, func(deviceInfo *DeviceInfo) (*SignatureRecord, error) {
+			counter := deviceInfo.SignatureCounter + 1
+			return &SignatureRecord{
+				DeviceId:         id,
+				SignatureCounter: counter,
+				SignedData:       fmt.Sprintf("%d_data", counter),
+				Signature:        fmt.Sprintf("signature-%d", counter),
+			}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func signatureCounters(records []*SignatureRecord) []int {
+	counters := []int{}
+	for _, record := range records {
+		counters = append(counters, record.SignatureCounter)
+	}
+	return counters
+}
+
+func TestListSignatureRecordsRanges(t *testing.T) {
+	openTestDB(t)
+	useKeyring(t, NewKeyring(newTestMasterKey(t)))
+	//device-10 shares the id prefix of device-1, its records must not be listed
+	createKeylessDevices(t,
+		&DeviceInfo{Id: "device-1", Algorithm: "ECC"},
+		&DeviceInfo{Id: "device-10", Algorithm: "ECC"},
+		&DeviceInfo{Id: "device-2", Algorithm: "ECC"},
+	)
+	appendSignatureRecords(t, "device-1", 12)
+	appendSignatureRecords(t, "device-10", 3)
+
+	tests := []struct {
+		name  string
+		from  int
+		to    int
+		limit int
+		want  []int
+	}{
+		{"whole history", 1, 0, 50, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}},
+		{"first page", 1, 0, 3, []int{1, 2, 3}},
+		{"page from counter", 4, 0, 3, []int{4, 5, 6}},
+		{"last page", 10, 0, 5, []int{10, 11, 12}},
+		{"closed range", 3, 5, 50, []int{3, 4, 5}},
+		{"range limited by page", 3, 9, 2, []int{3, 4}},
+		{"single counter", 9, 9, 50, []int{9}},
+		//Counters are zero padded, 10 and 11 sort after 9
+		{"range across digit count", 8, 11, 50, []int{8, 9, 10, 11}},
+		{"to beyond the chain", 11, 100, 50, []int{11, 12}},
+		{"from beyond the chain", 13, 0, 50, []int{}},
+		{"range beyond the chain", 20, 30, 50, []int{}},
+		{"from before the first counter", 0, 2, 50, []int{1, 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records, err := New(testLogger).ListSignatureRecords("device-1", test.from, test.to, test.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counters := signatureCounters(records); !reflect.DeepEqual(counters, test.want) {
+				t.Errorf("got counters %v, want %v", counters, test.want)
+			}
+			for _, record := range records {
+				if record.DeviceId != "device-1" || record.Signature != fmt.Sprintf("signature-%d", record.SignatureCounter) {
+					t.Errorf("record %d is %+v", record.SignatureCounter, *record)
+				}
+			}
+		})
+	}
+
+	records, err := New(testLogger).ListSignatureRecords("device-2", 1, 0, 50)
+	if err != nil || len(records) != 0 {
+		t.Errorf("device without signatures lists %v, %v", signatureCounters(records), err)
+	}
+
+	if _, err := New(testLogger).ListSignatureRecords("device-3", 1, 0, 50); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("missing device: %v, want %v", err, ErrDeviceNotFound)
+	}
+}
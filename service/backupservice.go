@@ -0,0 +1,226 @@
+package service
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"signing-service/domain"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+)
+
+// ErrInvalidBackup is returned when a backup cannot be decrypted or does not hold a device
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// ErrBackupConflict is returned when restoring a backup would fork the signature chain of the
+// live device, because the backup is behind it or holds another chain
+var ErrBackupConflict = errors.New("backup conflicts with the device")
+
+// deviceBackup is the plaintext of a backup envelope
+type deviceBackup struct {
+	Device *persistence.DeviceInfo `json:"device"`
+	// PrivateKey is the PEM encoded PKCS#8 private key of the current key version
+	PrivateKey       string `json:"private_key"`
+	SignatureCounter int    `json:"signature_counter"`
+	LastSignature    string `json:"last_signature"`
+}
+
+// ExportDeviceBackup returns an encrypted backup of the device record with its private key,
+// signature counter and last signature. It is encrypted with the payload password or for
+// the payload recipient public key. The signature history is not part of the backup.
+func (s Service) ExportDeviceBackup(id string, payload domain.BackupPayload) (*signingCrypto.BackupEnvelope, error) {
+	s.log.Println(">> [deviceService][ExportDeviceBackup][Received]")
+
+	deviceInfo, err := s.queryer.GetSignatureDeviceInfo(id)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := DevicePrivateKey(deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(deviceBackup{
+		Device:           deviceInfo,
+		PrivateKey:       string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBytes})),
+		SignatureCounter: deviceInfo.SignatureCounter,
+		LastSignature:    deviceInfo.Last_Signature_Base64_Encoded,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.RecipientPublicKey != "" {
+		recipient, err := signingCrypto.ParsePublicKey([]byte(payload.RecipientPublicKey))
+		if err != nil {
+			return nil, fmt.Errorf("%w: recipient public key: %v", ErrInvalidBackup, err)
+		}
+		envelope, err := signingCrypto.EncryptBackupForRecipient(deviceInfo.Id, plaintext, recipient)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		return envelope, nil
+	}
+
+	return signingCrypto.EncryptBackupWithPassword(deviceInfo.Id, plaintext, []byte(payload.Password))
+}
+
+// RestoreDeviceBackup decrypts a backup and restores the device it holds. A missing device is
+// created, a live device is replaced unless the backup is behind its signature chain: an older
+// signature counter, another last signature at the same counter or a key the live device never
+// had would fork the chain. A retired device is never restored and the live device keeps its
+// lifecycle state, a backup must not revoke a retirement or suspension.
+// The signatures up to the backed up counter are not in the backup, a restored chain the store
+// holds no history for continues from the backed up counter and last signature like an import.
+// A backup ahead of the live device keeps the history of the device, the signatures from the
+// live counter up to the backed up one are recorded as signature gap.
+func (s Service) RestoreDeviceBackup(payload domain.RestoreBackupPayload) (*DeviceResponse, error) {
+	s.log.Println(">> [deviceService][RestoreDeviceBackup][Received]")
+
+	backup, err := openDeviceBackup(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := signingCrypto.ParsePrivateKey([]byte(backup.PrivateKey), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	restored := backup.Device
+	algorithm := restored.Algorithm
+	if err := importDeviceKey(restored, privateKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if restored.Algorithm != algorithm {
+		return nil, fmt.Errorf("%w: the private key is an %s key, the device is %s", ErrInvalidBackup, restored.Algorithm, algorithm)
+	}
+
+	deviceInfo, err := s.queryer.GetSignatureDeviceInfo(restored.Id)
+	switch {
+	case errors.Is(err, persistence.ErrDeviceNotFound):
+		continueBackupChain(restored)
+		deviceInfo, err = restored, s.queryer.CreateSignatureDevice(restored)
+	case err == nil:
+		deviceInfo, err = s.queryer.UpdateSignatureDevice(restored.Id, func(live *persistence.DeviceInfo) error {
+			if live.State == domain.DeviceRetired {
+				return fmt.Errorf("%w: device %s is retired", ErrBackupConflict, live.Id)
+			}
+			if err := checkBackupContinues(live, restored); err != nil {
+				return err
+			}
+
+			device := *restored
+			device.State = live.State
+			device.RetiredAt = live.RetiredAt
+			//The store holds the history of the live device, the chain keeps its start
+			device.ImportedSignatureCounter = live.ImportedSignatureCounter
+			device.ImportedLastSignature = live.ImportedLastSignature
+			device.SignatureGaps = live.SignatureGaps
+			if device.SignatureCounter > live.SignatureCounter {
+				//The signatures the backup is ahead by are not in the store
+				device.SignatureGaps = append(device.SignatureGaps, persistence.SignatureGap{
+					From:          live.SignatureCounter + 1,
+					To:            device.SignatureCounter,
+					LastSignature: device.Last_Signature_Base64_Encoded,
+				})
+			}
+
+			*live = device
+			return nil
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	deviceResponse, err := newDeviceResponse(deviceInfo)
+	return &deviceResponse, err
+}
+
+// continueBackupChain makes the chain of a restored device continue from its backed up signature
+// counter and last signature, the signatures before are not in the store
+func continueBackupChain(deviceInfo *persistence.DeviceInfo) {
+	deviceInfo.ImportedSignatureCounter = deviceInfo.SignatureCounter
+	deviceInfo.ImportedLastSignature = deviceInfo.Last_Signature_Base64_Encoded
+}
+
+// openDeviceBackup decrypts the backup of the payload and checks it holds a consistent device
+func openDeviceBackup(payload domain.RestoreBackupPayload) (*deviceBackup, error) {
+	var envelope signingCrypto.BackupEnvelope
+	if err := json.Unmarshal(payload.Backup, &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+
+	var plaintext []byte
+	var err error
+	if payload.PrivateKey != "" {
+		privateKey, keyErr := signingCrypto.ParsePrivateKey([]byte(payload.PrivateKey), []byte(payload.PrivateKeyPassword))
+		if keyErr != nil {
+			return nil, fmt.Errorf("%w: recipient private key: %v", ErrInvalidBackup, keyErr)
+		}
+		plaintext, err = envelope.DecryptWithKey(privateKey)
+	} else {
+		plaintext, err = envelope.DecryptWithPassword([]byte(payload.Password))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+
+	var backup deviceBackup
+	if err := json.Unmarshal(plaintext, &backup); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	switch {
+	case backup.Device == nil || backup.Device.Id == "":
+		return nil, fmt.Errorf("%w: the backup holds no device", ErrInvalidBackup)
+	case backup.Device.Id != envelope.DeviceId:
+		return nil, fmt.Errorf("%w: the backup of device %s holds device %s", ErrInvalidBackup, envelope.DeviceId, backup.Device.Id)
+	case backup.Device.SignatureCounter != backup.SignatureCounter || backup.Device.Last_Signature_Base64_Encoded != backup.LastSignature:
+		return nil, fmt.Errorf("%w: the device record does not match the backed up signature counter", ErrInvalidBackup)
+	}
+
+	return &backup, nil
+}
+
+// checkBackupContinues returns ErrBackupConflict unless the backed up device is at or ahead of
+// the live device on the same signature chain
+func checkBackupContinues(live *persistence.DeviceInfo, backup *persistence.DeviceInfo) error {
+	if backup.SignatureCounter < live.SignatureCounter {
+		return fmt.Errorf("%w: the backup is at signature %d, device %s at %d", ErrBackupConflict, backup.SignatureCounter, live.Id, live.SignatureCounter)
+	}
+	if backup.SignatureCounter == live.SignatureCounter && backup.Last_Signature_Base64_Encoded != live.Last_Signature_Base64_Encoded {
+		return fmt.Errorf("%w: the backup and device %s signed different signatures %d", ErrBackupConflict, live.Id, live.SignatureCounter)
+	}
+
+	//The live key must be the backed up key or one it was rotated to
+	livePublicKey, err := DevicePublicKey(live)
+	if err != nil {
+		return err
+	}
+	liveFingerprint, err := signingCrypto.Fingerprint(livePublicKey)
+	if err != nil {
+		return err
+	}
+	for version := 1; version <= DeviceKeyVersion(backup); version++ {
+		publicKey, err := DeviceKeyVersionPublicKey(backup, version)
+		if err != nil {
+			return err
+		}
+		fingerprint, err := signingCrypto.Fingerprint(publicKey)
+		if err != nil {
+			return err
+		}
+		if fingerprint == liveFingerprint {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: the backup does not hold the key of device %s", ErrBackupConflict, live.Id)
+}
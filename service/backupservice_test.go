@@ -0,0 +1,245 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"signing-service/domain"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+const testBackupPassword = "backup password"
+
+// backupTestDevice returns the password encrypted backup of the device
+func backupTestDevice(t *testing.T, id string) domain.RestoreBackupPayload {
+	t.Helper()
+
+	envelope, err := NewService(testLogger).ExportDeviceBackup(id, domain.BackupPayload{Password: testBackupPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return domain.RestoreBackupPayload{Backup: backup, Password: testBackupPassword}
+}
+
+// signTestTransactions signs count transactions with the device and returns the last signature
+func signTestTransactions(t *testing.T, id string, count int) string {
+	t.Helper()
+
+	var signature string
+	for i := 0; i < count; i++ {
+		response, err := NewService(testLogger).SignTransaction(id, "transaction", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = response.Signature
+	}
+	return signature
+}
+
+// deleteDeviceRecord removes the device record, its signature records are kept
+func deleteDeviceRecord(t *testing.T, id string) {
+	t.Helper()
+
+	err := persistence.DBConn.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte("device/" + id))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func deviceFingerprint(t *testing.T, deviceInfo *persistence.DeviceInfo) string {
+	t.Helper()
+
+	publicKey, err := DevicePublicKey(deviceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := signingCrypto.Fingerprint(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fingerprint
+}
+
+func TestRestoreDeviceBackupConflicts(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup returns the backup to restore over the live device
+		setup func(t *testing.T, id string) domain.RestoreBackupPayload
+	}{
+		{
+			name: "retired device",
+			setup: func(t *testing.T, id string) domain.RestoreBackupPayload {
+				createTestDevice(t, id, "ED25519")
+				signTestTransactions(t, id, 1)
+				backup := backupTestDevice(t, id)
+				if _, err := NewService(testLogger).TransitionSignatureDevice(id, domain.Retire); err != nil {
+					t.Fatal(err)
+				}
+				return backup
+			},
+		},
+		{
+			name: "backup behind the device",
+			setup: func(t *testing.T, id string) domain.RestoreBackupPayload {
+				createTestDevice(t, id, "ECC")
+				signTestTransactions(t, id, 1)
+				backup := backupTestDevice(t, id)
+				signTestTransactions(t, id, 1)
+				return backup
+			},
+		},
+		{
+			name: "backup behind a key rotation",
+			setup: func(t *testing.T, id string) domain.RestoreBackupPayload {
+				createTestDevice(t, id, "ED25519")
+				backup := backupTestDevice(t, id)
+				if _, err := NewService(testLogger).RotateDeviceKey(id); err != nil {
+					t.Fatal(err)
+				}
+				return backup
+			},
+		},
+		{
+			name: "another key",
+			setup: func(t *testing.T, id string) domain.RestoreBackupPayload {
+				createTestDevice(t, id, "ED25519")
+				backup := backupTestDevice(t, id)
+				deleteDeviceRecord(t, id)
+				createTestDevice(t, id, "ED25519")
+				return backup
+			},
+		},
+		{
+			name: "another algorithm",
+			setup: func(t *testing.T, id string) domain.RestoreBackupPayload {
+				createTestDevice(t, id, "ED25519")
+				backup := backupTestDevice(t, id)
+				deleteDeviceRecord(t, id)
+				createTestDevice(t, id, "RSA")
+				return backup
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := "backup-conflict-" + test.name
+			backup := test.setup(t, id)
+
+			deviceService := NewService(testLogger)
+			live, err := deviceService.GetSignatureDeviceInfo(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := deviceService.RestoreDeviceBackup(backup); !errors.Is(err, ErrBackupConflict) {
+				t.Fatalf("got %v, want %v", err, ErrBackupConflict)
+			}
+
+			deviceInfo, err := deviceService.GetSignatureDeviceInfo(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deviceInfo.SignatureCounter != live.SignatureCounter || deviceInfo.Last_Signature_Base64_Encoded != live.Last_Signature_Base64_Encoded ||
+				deviceInfo.State != live.State || deviceFingerprint(t, deviceInfo) != deviceFingerprint(t, live) {
+				t.Error("rejected backup changed the device")
+			}
+		})
+	}
+}
+
+func TestRestoreDeviceBackupEqual(t *testing.T) {
+	id := "backup-equal-device"
+	createTestDevice(t, id, "ECC")
+	signTestTransactions(t, id, 2)
+	backup := backupTestDevice(t, id)
+	if _, err := NewService(testLogger).TransitionSignatureDevice(id, domain.Suspend); err != nil {
+		t.Fatal(err)
+	}
+
+	deviceService := NewService(testLogger)
+	deviceResponse, err := deviceService.RestoreDeviceBackup(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//The backup does not revoke the suspension
+	if deviceResponse.State != string(domain.DeviceSuspended) || deviceResponse.SignatureCounter != 2 {
+		t.Errorf("restored device is %s at signature %d", deviceResponse.State, deviceResponse.SignatureCounter)
+	}
+	if deviceResponse.ImportedSignatureCounter != 0 || len(deviceResponse.SignatureGaps) != 0 {
+		t.Errorf("restored device continues %d with gaps %v, the store holds its whole history", deviceResponse.ImportedSignatureCounter, deviceResponse.SignatureGaps)
+	}
+
+	report, err := deviceService.VerifySignatureChain(id)
+	if err != nil || !report.Valid || report.VerifiedSignatures != 2 || len(report.Gaps) != 0 {
+		t.Errorf("chain of the restored device: %+v, %v", report, err)
+	}
+}
+
+// TestRestoreDeviceBackupAhead restores a backup that signed on after the live device, e.g. on
+// another instance. The device keeps its history and the signatures it misses are a gap.
+func TestRestoreDeviceBackupAhead(t *testing.T) {
+	id := "backup-ahead-device"
+	createTestDevice(t, id, "ED25519")
+	liveSignature := signTestTransactions(t, id, 2)
+	backupSignature := signTestTransactions(t, id, 3)
+	backup := backupTestDevice(t, id)
+
+	//The live device never saw signatures 3 to 5
+	for counter := 3; counter <= 5; counter++ {
+		dropSignatureRecord(t, id, counter)
+	}
+	_, err := persistence.New(testLogger).UpdateSignatureDevice(id, func(deviceInfo *persistence.DeviceInfo) error {
+		deviceInfo.SignatureCounter = 2
+		deviceInfo.Last_Signature_Base64_Encoded = liveSignature
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deviceService := NewService(testLogger)
+	deviceResponse, err := deviceService.RestoreDeviceBackup(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantGaps := []persistence.SignatureGap{{From: 3, To: 5, LastSignature: backupSignature}}
+	if deviceResponse.SignatureCounter != 5 || deviceResponse.ImportedSignatureCounter != 0 || !reflect.DeepEqual(deviceResponse.SignatureGaps, wantGaps) {
+		t.Fatalf("restored device at signature %d continues %d with gaps %v, want 5 continuing 0 with gaps %v",
+			deviceResponse.SignatureCounter, deviceResponse.ImportedSignatureCounter, deviceResponse.SignatureGaps, wantGaps)
+	}
+
+	//The history up to the live counter is still verified
+	wantReportGaps := []signingCrypto.ChainGap{{From: 3, To: 5}}
+	report, err := deviceService.VerifySignatureChain(id)
+	if err != nil || !report.Valid || report.VerifiedSignatures != 2 || report.ContinuedFrom != 0 || !reflect.DeepEqual(report.Gaps, wantReportGaps) {
+		t.Errorf("chain after the restore: %+v, %v", report, err)
+	}
+
+	//The chain continues after the gap
+	signTestTransactions(t, id, 1)
+	report, err = deviceService.VerifySignatureChain(id)
+	if err != nil || !report.Valid || report.VerifiedSignatures != 3 || !reflect.DeepEqual(report.Gaps, wantReportGaps) {
+		t.Errorf("chain signed on after the restore: %+v, %v", report, err)
+	}
+
+	//The gap does not hide a missing signature before it
+	dropSignatureRecord(t, id, 2)
+	report, err = deviceService.VerifySignatureChain(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid || report.BrokenAt != 2 || report.Reason != "expected signature counter 2, found gap 3 to 5" {
+		t.Errorf("chain without signature 2: %+v", *report)
+	}
+}
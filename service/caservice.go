@@ -0,0 +1,355 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"signing-service/config"
+	"signing-service/domain"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// rootCAValidity is the validity of the root CA certificate created on first start
+	rootCAValidity = 20 * 365 * 24 * time.Hour
+	// intermediateCAValidity is the validity of the intermediate CA certificate created on first start
+	intermediateCAValidity = 10 * 365 * 24 * time.Hour
+	// crlPageLimit is the page size used to collect retired devices for the CRL
+	crlPageLimit = 500
+)
+
+// Authority is the local CA issuing device certificates, it is set by LoadCertificateAuthority
+var Authority *signingCrypto.CertificateAuthority
+
+// authorityConfig holds the settings of Authority with the extension OIDs parsed
+var authorityConfig struct {
+	organization        string
+	algorithmOID        asn1.ObjectIdentifier
+	tenantOID           asn1.ObjectIdentifier
+	certificateValidity time.Duration
+	crlValidity         time.Duration
+}
+
+type CertificateChainResponse struct {
+	DeviceId string `json:"deviceId"`
+	// Certificates are the DER encoded device certificate followed by the CA certificates
+	Certificates [][]byte `json:"certificates"`
+}
+
+// PEM returns the certificate chain as concatenated PEM blocks, device certificate first
+func (c CertificateChainResponse) PEM() []byte {
+	var chain []byte
+	for _, certificate := range c.Certificates {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate})...)
+	}
+	return chain
+}
+
+// LoadCertificateAuthority loads the root and intermediate CA from the database, both are
+// created with P-384 keys on first start.
+func LoadCertificateAuthority(caConfig config.CAConfig, l *log.Logger) error {
+	arc, err := parseObjectIdentifier(caConfig.ExtensionOID)
+	if err != nil {
+		return fmt.Errorf("invalid certificate extension OID %q: %v", caConfig.ExtensionOID, err)
+	}
+	authorityConfig.organization = caConfig.Organization
+	authorityConfig.algorithmOID = append(append(asn1.ObjectIdentifier{}, arc...), 1)
+	authorityConfig.tenantOID = append(append(asn1.ObjectIdentifier{}, arc...), 2)
+	authorityConfig.certificateValidity = time.Duration(caConfig.DeviceCertificateValidityDays) * 24 * time.Hour
+	authorityConfig.crlValidity = time.Duration(caConfig.CRLValidityHours) * time.Hour
+
+	caDAO := persistence.NewCA(l)
+
+	root, err := caDAO.GetCertificateAuthority(persistence.RootCAName)
+	if errors.Is(err, persistence.ErrCANotFound) {
+		root, err = createCA(caDAO, persistence.RootCAName, caConfig.Organization+" Root CA", nil)
+		if err == nil {
+			l.Printf("Created root CA %s", root.Certificate.Subject)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	intermediate, err := caDAO.GetCertificateAuthority(persistence.IntermediateCAName)
+	if errors.Is(err, persistence.ErrCANotFound) {
+		intermediate, err = createCA(caDAO, persistence.IntermediateCAName, caConfig.Organization+" Device CA", root)
+		if err == nil {
+			l.Printf("Created intermediate CA %s", intermediate.Certificate.Subject)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	Authority, err = signingCrypto.NewCertificateAuthority(root.Certificate, intermediate.Certificate, intermediate.PrivateKey)
+	return err
+}
+
+// createCA generates a CA key and certificate and stores them, the certificate is
+// self-signed unless an issuer is given
+func createCA(caDAO *persistence.CADAO, name string, commonName string, issuer *persistence.CAInfo) (*persistence.CAInfo, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := pkix.Name{CommonName: commonName}
+	if authorityConfig.organization != "" {
+		subject.Organization = []string{authorityConfig.organization}
+	}
+	notBefore := time.Now().UTC()
+
+	var certificate *x509.Certificate
+	if issuer == nil {
+		certificate, err = signingCrypto.NewRootCertificate(key, subject, notBefore, notBefore.Add(rootCAValidity))
+	} else {
+		certificate, err = signingCrypto.NewIntermediateCertificate(issuer.Certificate, issuer.PrivateKey,
+			key.Public(), subject, notBefore, notBefore.Add(intermediateCAValidity))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	caInfo := &persistence.CAInfo{
+		Name:        name,
+		Certificate: certificate,
+		PrivateKey:  key,
+	}
+	return caInfo, caDAO.CreateCertificateAuthority(caInfo)
+}
+
+// parseObjectIdentifier parses a dotted OID like 1.3.6.1.4.1.32473.1
+func parseObjectIdentifier(value string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) < 2 {
+		return nil, errors.New("an OID needs at least two arcs")
+	}
+
+	oid := make(asn1.ObjectIdentifier, 0, len(parts))
+	for _, part := range parts {
+		arc, err := strconv.Atoi(part)
+		if err != nil || arc < 0 {
+			return nil, fmt.Errorf("invalid arc %q", part)
+		}
+		oid = append(oid, arc)
+	}
+
+	return oid, nil
+}
+
+// issueDeviceCertificate issues the CA certificate of the device key and stores it DER
+// encoded in deviceInfo.Certificate. The subject is the device id as common name and the
+// label as organizational unit, the algorithm and tenant are carried as UTF8String
+// extensions under the configured OID arc.
+func issueDeviceCertificate(deviceInfo *persistence.DeviceInfo) (*x509.Certificate, error) {
+	if Authority == nil {
+		return nil, errors.New("certificate authority is not loaded")
+	}
+
+	publicKey, err := DevicePublicKey(deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := pkix.Name{CommonName: deviceInfo.Id}
+	if authorityConfig.organization != "" {
+		subject.Organization = []string{authorityConfig.organization}
+	}
+	if deviceInfo.Label != "" {
+		subject.OrganizationalUnit = []string{deviceInfo.Label}
+	}
+
+	extensions := []pkix.Extension{}
+	algorithm, err := asn1.MarshalWithParams(deviceInfo.Algorithm, "utf8")
+	if err != nil {
+		return nil, err
+	}
+	extensions = append(extensions, pkix.Extension{Id: authorityConfig.algorithmOID, Value: algorithm})
+	if deviceInfo.Tenant != "" {
+		tenant, err := asn1.MarshalWithParams(deviceInfo.Tenant, "utf8")
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: authorityConfig.tenantOID, Value: tenant})
+	}
+
+	notBefore := time.Now().UTC()
+	notAfter := notBefore.Add(authorityConfig.certificateValidity)
+	//A certificate must not outlive its issuer
+	if notAfter.After(Authority.Intermediate.NotAfter) {
+		notAfter = Authority.Intermediate.NotAfter
+	}
+
+	certificate, err := Authority.IssueCertificate(publicKey, subject, extensions, notBefore, notAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceInfo.Certificate = certificate.Raw
+	return certificate, nil
+}
+
+// DeviceCertificate returns the certificate of the device key, an uploaded one or the one
+// issued by the local CA. Devices created before the CA existed are issued one on first
+// use, the caller has to store deviceInfo.Certificate then. Retired devices are not
+// certified anymore.
+func DeviceCertificate(deviceInfo *persistence.DeviceInfo) (*x509.Certificate, error) {
+	if len(deviceInfo.Certificate) != 0 {
+		return x509.ParseCertificate(deviceInfo.Certificate)
+	}
+
+	if deviceInfo.State == domain.DeviceRetired {
+		return nil, fmt.Errorf("%w: device %s is %s and has no certificate", ErrDeviceNotActive, deviceInfo.Id, deviceInfo.State)
+	}
+
+	return issueDeviceCertificate(deviceInfo)
+}
+
+// Get the certificate chain of the device, from the device certificate up to the root
+func (s Service) GetDeviceCertificateChain(id string) (*CertificateChainResponse, error) {
+	s.log.Println(">> [deviceService][GetDeviceCertificateChain][Received]")
+	deviceInfo, err := s.queryer.GetSignatureDeviceInfo(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(deviceInfo.Certificate) == 0 {
+		deviceInfo, err = s.queryer.UpdateSignatureDevice(id, func(deviceInfo *persistence.DeviceInfo) error {
+			_, err := DeviceCertificate(deviceInfo)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newCertificateChainResponse(deviceInfo)
+}
+
+func newCertificateChainResponse(deviceInfo *persistence.DeviceInfo) (*CertificateChainResponse, error) {
+	certificateChainResponse := CertificateChainResponse{
+		DeviceId:     deviceInfo.Id,
+		Certificates: [][]byte{deviceInfo.Certificate},
+	}
+
+	//An uploaded chain replaces the one of the local CA
+	if len(deviceInfo.CertificateChain) != 0 {
+		certificateChainResponse.Certificates = append(certificateChainResponse.Certificates, deviceInfo.CertificateChain...)
+		return &certificateChainResponse, nil
+	}
+
+	if Authority == nil {
+		return nil, errors.New("certificate authority is not loaded")
+	}
+	for _, certificate := range Authority.Chain() {
+		certificateChainResponse.Certificates = append(certificateChainResponse.Certificates, certificate.Raw)
+	}
+
+	return &certificateChainResponse, nil
+}
+
+// Get the DER encoded CRL of the local CA, revoking the certificates of all retired devices
+// as of their retirement, the certificates of rotated keys as of their rotation and the
+// certificates replaced by uploaded ones as of their upload
+func (s Service) GetCRL() ([]byte, error) {
+	s.log.Println(">> [deviceService][GetCRL][Received]")
+	if Authority == nil {
+		return nil, errors.New("certificate authority is not loaded")
+	}
+
+	revoked := []pkix.RevokedCertificate{}
+	revoke := func(deviceInfo *persistence.DeviceInfo, der []byte, revocationTime time.Time) error {
+		if len(der) == 0 {
+			return nil
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("certificate of device %s: %v", deviceInfo.Id, err)
+		}
+		//Only certificates of this CA belong into its CRL
+		if !bytes.Equal(certificate.RawIssuer, Authority.Intermediate.RawSubject) {
+			return nil
+		}
+
+		if revocationTime.IsZero() {
+			revocationTime = certificate.NotBefore
+		}
+		revoked = append(revoked, pkix.RevokedCertificate{
+			SerialNumber:   certificate.SerialNumber,
+			RevocationTime: revocationTime,
+		})
+		return nil
+	}
+
+	cursor := ""
+	for {
+		devices, nextCursor, err := s.queryer.ListSignatureDevices(cursor, crlPageLimit, persistence.DeviceFilter{})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, deviceInfo := range devices {
+			for _, keyVersion := range deviceInfo.KeyVersions {
+				if err := revoke(deviceInfo, keyVersion.Certificate, keyVersion.RotatedAt); err != nil {
+					return nil, err
+				}
+			}
+			for _, superseded := range deviceInfo.SupersededCertificates {
+				if err := revoke(deviceInfo, superseded.Certificate, superseded.SupersededAt); err != nil {
+					return nil, err
+				}
+			}
+			if deviceInfo.State != domain.DeviceRetired {
+				continue
+			}
+			if err := revoke(deviceInfo, deviceInfo.Certificate, deviceInfo.RetiredAt); err != nil {
+				return nil, err
+			}
+		}
+
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+
+	thisUpdate := time.Now().UTC()
+	//The CRL number has to increase with every CRL, the issue time does
+	return Authority.CreateCRL(revoked, big.NewInt(thisUpdate.UnixNano()), thisUpdate, thisUpdate.Add(authorityConfig.crlValidity))
+}
+
+// deviceCertificateChain returns the CA certificates to embed with a device certificate, the
+// uploaded chain or the intermediate of the local CA
+func deviceCertificateChain(deviceInfo *persistence.DeviceInfo) ([]*x509.Certificate, error) {
+	if len(deviceInfo.CertificateChain) != 0 {
+		chain := make([]*x509.Certificate, 0, len(deviceInfo.CertificateChain))
+		for _, der := range deviceInfo.CertificateChain {
+			certificate, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("certificate chain of device %s: %v", deviceInfo.Id, err)
+			}
+			chain = append(chain, certificate)
+		}
+		return chain, nil
+	}
+
+	if Authority == nil {
+		return nil, nil
+	}
+
+	return []*x509.Certificate{Authority.Intermediate}, nil
+}
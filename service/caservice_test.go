@@ -0,0 +1,196 @@
+package service
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"signing-service/domain"
+	"signing-service/persistence"
+	"testing"
+	"time"
+)
+
+// certificateExtension returns the UTF8String value of the certificate extension, if present
+func certificateExtension(t *testing.T, certificate *x509.Certificate, id asn1.ObjectIdentifier) (string, bool) {
+	t.Helper()
+
+	for _, extension := range certificate.Extensions {
+		if extension.Id.Equal(id) {
+			var value string
+			if _, err := asn1.UnmarshalWithParams(extension.Value, &value, "utf8"); err != nil {
+				t.Fatal(err)
+			}
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func TestGetDeviceCertificateChain(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		tenant    string
+	}{
+		{"RSA", "tenant-a"},
+		{"ECC", ""},
+		{"ED25519", "tenant-b"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.algorithm, func(t *testing.T) {
+			id := "certified-" + test.algorithm
+			deviceService := NewService(testLogger)
+			if err := deviceService.CreateSignatureDevice(&persistence.DeviceInfo{Id: id, Algorithm: test.algorithm, Label: "Till 1", Tenant: test.tenant}); err != nil {
+				t.Fatal(err)
+			}
+
+			chainResponse, err := deviceService.GetDeviceCertificateChain(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chainResponse.Certificates) != 3 {
+				t.Fatalf("chain has %d certificates, want device, intermediate and root", len(chainResponse.Certificates))
+			}
+
+			var chain []*x509.Certificate
+			for _, der := range chainResponse.Certificates {
+				certificate, err := x509.ParseCertificate(der)
+				if err != nil {
+					t.Fatal(err)
+				}
+				chain = append(chain, certificate)
+			}
+			if !chain[1].Equal(Authority.Intermediate) || !chain[2].Equal(Authority.Root) {
+				t.Fatal("chain does not end with the intermediate and root of the CA")
+			}
+
+			roots := x509.NewCertPool()
+			roots.AddCert(chain[2])
+			intermediates := x509.NewCertPool()
+			intermediates.AddCert(chain[1])
+			if _, err := chain[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+				t.Errorf("device certificate does not chain to the CA: %v", err)
+			}
+
+			certificate := chain[0]
+			subject := certificate.Subject
+			if subject.CommonName != id || len(subject.OrganizationalUnit) != 1 || subject.OrganizationalUnit[0] != "Till 1" ||
+				len(subject.Organization) != 1 || subject.Organization[0] != authorityConfig.organization {
+				t.Errorf("device certificate subject is %s", subject)
+			}
+
+			deviceInfo, err := deviceService.GetSignatureDeviceInfo(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			publicKey, err := DevicePublicKey(deviceInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !publicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(certificate.PublicKey) {
+				t.Error("device certificate does not certify the device key")
+			}
+
+			if algorithm, ok := certificateExtension(t, certificate, authorityConfig.algorithmOID); !ok || algorithm != test.algorithm {
+				t.Errorf("algorithm extension is %q", algorithm)
+			}
+			tenant, ok := certificateExtension(t, certificate, authorityConfig.tenantOID)
+			if ok != (test.tenant != "") || tenant != test.tenant {
+				t.Errorf("tenant extension is %q", tenant)
+			}
+		})
+	}
+}
+
+// TestGetCRL checks that the CRL revokes the certificates of retired devices and rotated keys only
+func TestGetCRL(t *testing.T) {
+	deviceService := NewService(testLogger)
+
+	certificate := func(id string) *x509.Certificate {
+		deviceInfo, err := deviceService.GetSignatureDeviceInfo(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certificate, err := x509.ParseCertificate(deviceInfo.Certificate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return certificate
+	}
+
+	createTestDevice(t, "crl-active", "ED25519")
+	active := certificate("crl-active")
+
+	createTestDevice(t, "crl-suspended", "ED25519")
+	if _, err := deviceService.TransitionSignatureDevice("crl-suspended", domain.Suspend); err != nil {
+		t.Fatal(err)
+	}
+	suspended := certificate("crl-suspended")
+
+	createTestDevice(t, "crl-retired", "ECC")
+	retired := certificate("crl-retired")
+	if _, err := deviceService.TransitionSignatureDevice("crl-retired", domain.Retire); err != nil {
+		t.Fatal(err)
+	}
+
+	createTestDevice(t, "crl-rotated", "RSA")
+	rotated := certificate("crl-rotated")
+	if _, err := deviceService.RotateDeviceKey("crl-rotated"); err != nil {
+		t.Fatal(err)
+	}
+	current := certificate("crl-rotated")
+
+	der, err := deviceService.GetCRL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(Authority.Intermediate); err != nil {
+		t.Errorf("CRL is not signed by the intermediate CA: %v", err)
+	}
+	if !crl.NextUpdate.After(crl.ThisUpdate) {
+		t.Errorf("CRL next update %s is not after %s", crl.NextUpdate, crl.ThisUpdate)
+	}
+
+	revocationTimes := map[string]time.Time{}
+	for _, revoked := range crl.RevokedCertificates {
+		revocationTimes[revoked.SerialNumber.String()] = revoked.RevocationTime
+	}
+
+	retiredInfo, err := deviceService.GetSignatureDeviceInfo("crl-retired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotatedInfo, err := deviceService.GetSignatureDeviceInfo("crl-rotated")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		certificate    *x509.Certificate
+		revoked        bool
+		revocationTime time.Time
+	}{
+		{"active device", active, false, time.Time{}},
+		{"suspended device", suspended, false, time.Time{}},
+		{"retired device", retired, true, retiredInfo.RetiredAt},
+		{"rotated key", rotated, true, rotatedInfo.KeyVersions[0].RotatedAt},
+		{"key after rotation", current, false, time.Time{}},
+	}
+
+	for _, test := range tests {
+		revocationTime, revoked := revocationTimes[test.certificate.SerialNumber.String()]
+		if revoked != test.revoked {
+			t.Errorf("%s: revoked %t, want %t", test.name, revoked, test.revoked)
+			continue
+		}
+		//CRL times have a precision of seconds
+		if revoked && !revocationTime.Equal(test.revocationTime.Truncate(time.Second)) {
+			t.Errorf("%s: revoked as of %s, want %s", test.name, revocationTime, test.revocationTime)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"errors"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+)
+
+// NewDeviceCOSE signs the signature record as tagged COSE_Sign1 message with the device key. The
+// protected header carries the COSE algorithm of the device, the kid of its public key JWK and the
+// signature counter.
+func NewDeviceCOSE(deviceInfo *persistence.DeviceInfo, payload signingCrypto.COSEPayload) ([]byte, error) {
+	jwk, signer, err := newDeviceEnvelopeSigner(deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	alg, err := signingCrypto.COSEAlgorithm(jwk.Alg)
+	if err != nil {
+		return nil, err
+	}
+
+	return signingCrypto.SignCOSESign1(signer, signingCrypto.COSEHeader{
+		Alg:              alg,
+		Kid:              []byte(jwk.Kid),
+		SignatureCounter: payload.SignatureCounter,
+	}, payload)
+}
+
+// VerifyCOSE checks that the COSE_Sign1 message was signed by the device key version of its
+// signature counter. It returns the decoded message, or an error describing why it does not verify.
+func (s Service) VerifyCOSE(deviceInfo *persistence.DeviceInfo, message []byte) (*signingCrypto.COSESign1, error) {
+	s.log.Println(">> [deviceService][VerifyCOSE][Received]")
+
+	cose, err := signingCrypto.ParseCOSESign1(message)
+	if err != nil {
+		return nil, err
+	}
+
+	version := deviceKeyVersionForCounter(deviceInfo, cose.Header.SignatureCounter)
+	jwk, _, err := deviceJWK(deviceInfo, version)
+	if err != nil {
+		return cose, err
+	}
+
+	alg, err := signingCrypto.COSEAlgorithm(jwk.Alg)
+	if err != nil {
+		return cose, err
+	}
+	if cose.Header.Alg != alg {
+		return cose, errors.New("cose: algorithm does not match the device")
+	}
+	if !cose.HasKid([]byte(jwk.Kid)) {
+		return cose, errors.New("cose: kid does not match the device public key")
+	}
+
+	verifier, err := NewDeviceKeyVerifier(deviceInfo, version)
+	if err != nil {
+		return cose, err
+	}
+
+	return cose, cose.Verify(verifier)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"signing-service/domain"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+	"time"
+)
+
+// ErrInvalidCertificateChain is returned when an uploaded certificate chain does not certify the device key
+var ErrInvalidCertificateChain = errors.New("invalid certificate chain")
+
+type CertificateRequestResponse struct {
+	DeviceId string `json:"deviceId"`
+	// CSR is the PEM encoded PKCS#10 certificate request
+	CSR string `json:"csr"`
+	// CSRDER is the DER encoded certificate request, it is not part of the JSON response
+	CSRDER []byte `json:"-"`
+}
+
+// CreateCertificateRequest returns a PKCS#10 certificate request for the device key with the
+// requested subject and subject alternative names, signed by the device key so an external
+// CA can certify it. The signature does not advance the device signature chain.
+func (s Service) CreateCertificateRequest(id string, payload domain.CertificateRequestPayload) (*CertificateRequestResponse, error) {
+	s.log.Println(">> [deviceService][CreateCertificateRequest][Received]")
+
+	deviceInfo, err := s.queryer.GetSignatureDeviceInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	if deviceInfo.State == domain.DeviceRetired {
+		return nil, fmt.Errorf("%w: device %s is %s", ErrDeviceNotActive, deviceInfo.Id, deviceInfo.State)
+	}
+
+	template := x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:         payload.Subject.CommonName,
+			SerialNumber:       payload.Subject.SerialNumber,
+			Organization:       payload.Subject.Organization,
+			OrganizationalUnit: payload.Subject.OrganizationalUnit,
+			Country:            payload.Subject.Country,
+			Province:           payload.Subject.Province,
+			Locality:           payload.Subject.Locality,
+		},
+		DNSNames:       payload.DNSNames,
+		EmailAddresses: payload.EmailAddresses,
+	}
+	for _, address := range payload.IPAddresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", address)
+		}
+		template.IPAddresses = append(template.IPAddresses, ip)
+	}
+	for _, uri := range payload.URIs {
+		parsed, err := url.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URI %q: %v", uri, err)
+		}
+		template.URIs = append(template.URIs, parsed)
+	}
+
+	privateKey, err := DevicePrivateKey(deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := DeviceSignatureParameters(deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := signingCrypto.NewCertificateRequest(privateKey, params, template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CertificateRequestResponse{
+		DeviceId: deviceInfo.Id,
+		CSR:      string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		CSRDER:   csr,
+	}, nil
+}
+
+// UploadCertificateChain stores a certificate chain issued by an external CA with the device.
+// The first certificate must certify the device key and every certificate must be issued by
+// the next one, the chain then replaces the one of the local CA. The replaced device
+// certificate is kept and listed in the CRL.
+func (s Service) UploadCertificateChain(id string, chainPEM []byte) (*CertificateChainResponse, error) {
+	s.log.Println(">> [deviceService][UploadCertificateChain][Received]")
+
+	chain, err := signingCrypto.ParseCertificateChain(chainPEM)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCertificateChain, err)
+	}
+	if len(chain) < 2 {
+		return nil, fmt.Errorf("%w: the chain must include the certificate of the issuing CA", ErrInvalidCertificateChain)
+	}
+
+	deviceInfo, err := s.queryer.UpdateSignatureDevice(id, func(deviceInfo *persistence.DeviceInfo) error {
+		if deviceInfo.State == domain.DeviceRetired {
+			return fmt.Errorf("%w: device %s is %s", ErrDeviceNotActive, deviceInfo.Id, deviceInfo.State)
+		}
+
+		publicKey, err := DevicePublicKey(deviceInfo)
+		if err != nil {
+			return err
+		}
+
+		if err := signingCrypto.VerifyCertificateChain(chain, publicKey, time.Now()); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCertificateChain, err)
+		}
+
+		//The replaced certificate is revoked like the one of a rotated key
+		if len(deviceInfo.Certificate) != 0 && !bytes.Equal(deviceInfo.Certificate, chain[0].Raw) {
+			deviceInfo.SupersededCertificates = append(deviceInfo.SupersededCertificates, persistence.SupersededCertificate{
+				Certificate:  deviceInfo.Certificate,
+				SupersededAt: time.Now().UTC(),
+			})
+		}
+		deviceInfo.Certificate = chain[0].Raw
+		deviceInfo.CertificateChain = nil
+		for _, certificate := range chain[1:] {
+			deviceInfo.CertificateChain = append(deviceInfo.CertificateChain, certificate.Raw)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newCertificateChainResponse(deviceInfo)
+}
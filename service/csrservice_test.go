@@ -0,0 +1,203 @@
+package service
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"signing-service/domain"
+	"signing-service/signingCrypto"
+	"testing"
+	"time"
+)
+
+// newExternalCA creates the root and intermediate of a CA other than the local one
+func newExternalCA(t *testing.T, name string) *signingCrypto.CertificateAuthority {
+	t.Helper()
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := notBefore.Add(24 * time.Hour)
+	root, err := signingCrypto.NewRootCertificate(rootKey, pkix.Name{CommonName: name + " Root CA"}, notBefore, notAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, err := signingCrypto.NewIntermediateCertificate(root, rootKey, intermediateKey.Public(), pkix.Name{CommonName: name + " Device CA"}, notBefore, notAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := signingCrypto.NewCertificateAuthority(root, intermediate, intermediateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+// issueExternalCertificate issues a certificate for the public key valid from notBefore to notAfter
+func issueExternalCertificate(t *testing.T, ca *signingCrypto.CertificateAuthority, publicKey crypto.PublicKey, notBefore time.Time, notAfter time.Time) *x509.Certificate {
+	t.Helper()
+
+	certificate, err := ca.IssueCertificate(publicKey, pkix.Name{CommonName: "external device"}, nil, notBefore, notAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+func encodeCertificateChain(chain ...*x509.Certificate) []byte {
+	var chainPEM []byte
+	for _, certificate := range chain {
+		chainPEM = append(chainPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})...)
+	}
+	return chainPEM
+}
+
+func TestUploadCertificateChainRejected(t *testing.T) {
+	id := "upload-rejected-device"
+	deviceService := createTestDevice(t, id, "ECC")
+	deviceInfo, err := deviceService.GetSignatureDeviceInfo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := DevicePublicKey(deviceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	external := newExternalCA(t, "External")
+	otherCA := newExternalCA(t, "Other")
+	now := time.Now()
+	certificate := issueExternalCertificate(t, external, publicKey, now.Add(-time.Hour), now.Add(time.Hour))
+	expired := issueExternalCertificate(t, external, publicKey, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	notYetValid := issueExternalCertificate(t, external, publicKey, now.Add(time.Hour), now.Add(2*time.Hour))
+	otherKeyCertificate := issueExternalCertificate(t, external, otherKey.Public(), now.Add(-time.Hour), now.Add(time.Hour))
+
+	tests := []struct {
+		name  string
+		chain []byte
+	}{
+		{"no certificate", []byte("not a certificate")},
+		{"chain too short", encodeCertificateChain(certificate)},
+		{"mismatched public key", encodeCertificateChain(otherKeyCertificate, external.Intermediate, external.Root)},
+		{"expired certificate", encodeCertificateChain(expired, external.Intermediate, external.Root)},
+		{"certificate not yet valid", encodeCertificateChain(notYetValid, external.Intermediate)},
+		{"broken issuer link", encodeCertificateChain(certificate, otherCA.Intermediate, otherCA.Root)},
+		{"broken link to the root", encodeCertificateChain(certificate, external.Intermediate, otherCA.Root)},
+		{"issuer is no CA", encodeCertificateChain(certificate, otherKeyCertificate)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := deviceService.UploadCertificateChain(id, test.chain); !errors.Is(err, ErrInvalidCertificateChain) {
+				t.Errorf("got %v, want %v", err, ErrInvalidCertificateChain)
+			}
+		})
+	}
+
+	stored, err := deviceService.GetSignatureDeviceInfo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored.Certificate, deviceInfo.Certificate) || len(stored.CertificateChain) != 0 || len(stored.SupersededCertificates) != 0 {
+		t.Error("rejected chains changed the device certificate")
+	}
+
+	if _, err := deviceService.TransitionSignatureDevice(id, domain.Retire); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := deviceService.UploadCertificateChain(id, encodeCertificateChain(certificate, external.Intermediate)); !errors.Is(err, ErrDeviceNotActive) {
+		t.Errorf("upload for a retired device: %v, want %v", err, ErrDeviceNotActive)
+	}
+}
+
+// TestUploadCertificateChainRevokesSuperseded checks that the certificate of the local CA replaced
+// by an uploaded chain is kept and revoked
+func TestUploadCertificateChainRevokesSuperseded(t *testing.T) {
+	id := "upload-device"
+	deviceService := createTestDevice(t, id, "ED25519")
+	deviceInfo, err := deviceService.GetSignatureDeviceInfo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localCertificate, err := x509.ParseCertificate(deviceInfo.Certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := DevicePublicKey(deviceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	external := newExternalCA(t, "External")
+	now := time.Now()
+	certificate := issueExternalCertificate(t, external, publicKey, now.Add(-time.Hour), now.Add(time.Hour))
+	chainPEM := encodeCertificateChain(certificate, external.Intermediate, external.Root)
+
+	chainResponse, err := deviceService.UploadCertificateChain(id, chainPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chainResponse.PEM(), chainPEM) {
+		t.Error("certificate chain of the device is not the uploaded one")
+	}
+	//Uploading the same chain again supersedes nothing
+	if _, err := deviceService.UploadCertificateChain(id, chainPEM); err != nil {
+		t.Fatal(err)
+	}
+
+	deviceInfo, err = deviceService.GetSignatureDeviceInfo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deviceInfo.SupersededCertificates) != 1 || !bytes.Equal(deviceInfo.SupersededCertificates[0].Certificate, localCertificate.Raw) {
+		t.Fatalf("device keeps %d superseded certificates, want the one of the local CA", len(deviceInfo.SupersededCertificates))
+	}
+	supersededAt := deviceInfo.SupersededCertificates[0].SupersededAt
+
+	der, err := deviceService.GetCRL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var revokedLocal, revokedExternal bool
+	for _, revoked := range crl.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(localCertificate.SerialNumber) == 0 {
+			revokedLocal = true
+			if !revoked.RevocationTime.Equal(supersededAt.Truncate(time.Second)) {
+				t.Errorf("superseded certificate revoked as of %s, want %s", revoked.RevocationTime, supersededAt)
+			}
+		}
+		if revoked.SerialNumber.Cmp(certificate.SerialNumber) == 0 {
+			revokedExternal = true
+		}
+	}
+	if !revokedLocal {
+		t.Error("CRL does not revoke the superseded certificate")
+	}
+	//The uploaded certificate is not issued by the local CA
+	if revokedExternal {
+		t.Error("CRL revokes the uploaded certificate")
+	}
+}
@@ -1,13 +1,31 @@
 package service
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
+	"signing-service/domain"
 	"signing-service/persistence"
 	"signing-service/signingCrypto"
+	"strconv"
+	"time"
 )
 
-var ECCKeyGeneratorService signingCrypto.ECCGenerator
-var RSAKeyGeneratorService signingCrypto.RSAGenerator
+const (
+	// DefaultPageLimit is the page size used when the request sets no limit
+	DefaultPageLimit = 50
+	// MaxPageLimit caps the page size a request can ask for
+	MaxPageLimit = 500
+)
+
+// ErrDeviceNotActive is returned when a device that is not active is asked to sign
+var ErrDeviceNotActive = errors.New("device is not active")
+
+// ErrInvalidPage is returned when a page is requested with an invalid cursor or limit
+var ErrInvalidPage = errors.New("invalid page")
+
+var Ed25519KeyGeneratorService signingCrypto.Ed25519Generator
 
 type CreateSignatureDeviceResponse struct {
 	DeviceId string `json:"deviceId"`
@@ -17,7 +35,54 @@ type CreateSignatureDeviceResponse struct {
 type SignatureResponse struct {
 	Signature   string `json:"signature"`
 	Signed_Data string `json:"signed_data"`
-	Message     string `json:"message"`
+	// SignatureFormat is the encoding of ECDSA signatures, DER or P1363
+	SignatureFormat string `json:"signature_format,omitempty"`
+	// JWS is the compact JWS of the signature record, if requested
+	JWS string `json:"jws,omitempty"`
+	// COSE is the tagged COSE_Sign1 message of the signature record, if requested
+	COSE    []byte `json:"cose,omitempty"`
+	Message string `json:"message"`
+}
+
+type VerifySignatureResponse struct {
+	DeviceId         string `json:"deviceId"`
+	Valid            bool   `json:"valid"`
+	SignatureCounter int    `json:"signature_counter,omitempty"`
+	Reason           string `json:"reason,omitempty"`
+}
+
+type DeviceResponse struct {
+	Id                   string               `json:"id"`
+	Label                string               `json:"label"`
+	Tenant               string               `json:"tenant,omitempty"`
+	Algorithm            string               `json:"algorithm"`
+	State                string               `json:"state"`
+	SignatureCounter     int                  `json:"signature_counter"`
+	CreatedAt            time.Time            `json:"created_at"`
+	PublicKeyFingerprint string               `json:"public_key_fingerprint"`
+	KeyParameters        domain.KeyParameters `json:"key_parameters"`
+	KeyVersion           int                  `json:"key_version"`
+	KeyCreatedAt         time.Time            `json:"key_created_at"`
+	KeyRotationDue       bool                 `json:"key_rotation_due"`
+	KeyVersions          []KeyVersionResponse `json:"key_versions"`
+	// ImportedSignatureCounter and ImportedLastSignature are the end of the chain of another
+	// signing provider the device continues, the history starts after them
+	ImportedSignatureCounter int    `json:"imported_signature_counter,omitempty"`
+	ImportedLastSignature    string `json:"imported_last_signature,omitempty"`
+	// SignatureGaps are the signatures a restored backup was ahead of the device by, the
+	// history does not hold them
+	SignatureGaps []persistence.SignatureGap `json:"signature_gaps,omitempty"`
+}
+
+type DeviceListResponse struct {
+	Devices    []DeviceResponse `json:"devices"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+type SignatureHistoryResponse struct {
+	DeviceId   string                         `json:"deviceId"`
+	Signatures []*persistence.SignatureRecord `json:"signatures"`
+	NextFrom   int                            `json:"next_from,omitempty"`
 }
 
 // Service struct is returned by the NewService function
@@ -38,29 +103,69 @@ func NewService(logger *log.Logger) *Service {
 func (s Service) CreateSignatureDevice(deviceInfo *persistence.DeviceInfo) error {
 
 	s.log.Println(">> [deviceService][CreateSignatureDeviceResponse][Received]")
-	//We have to generate Key-pair
+	deviceInfo.CreatedAt = time.Now().UTC()
+	if deviceInfo.State == "" {
+		deviceInfo.State = domain.DeviceActive
+	}
+	if err := deviceInfo.KeyParameters.Check(deviceInfo.Algorithm); err != nil {
+		return err
+	}
+	deviceInfo.KeyParameters = deviceInfo.KeyParameters.WithDefaults(deviceInfo.Algorithm)
+	if err := generateDeviceKey(deviceInfo); err != nil {
+		return err
+	}
+	deviceInfo.KeyCreatedAt = deviceInfo.CreatedAt
+	//Certify the new key with the local CA
+	if _, err := issueDeviceCertificate(deviceInfo); err != nil {
+		return err
+	}
+	err := s.queryer.CreateSignatureDevice(deviceInfo)
+	return err
+}
+
+// generateDeviceKey generates a key pair of the device algorithm and key parameters
+func generateDeviceKey(deviceInfo *persistence.DeviceInfo) error {
 	if deviceInfo.Algorithm == "RSA" {
-		rsaKeyPair, err := RSAKeyGeneratorService.Generate()
+		rsaKeyGenerator := signingCrypto.RSAGenerator{Bits: deviceInfo.KeyParameters.RSABits}
+		rsaKeyPair, err := rsaKeyGenerator.Generate()
 		if err != nil {
 			return err
 		} else {
 
 			deviceInfo.RSAKeyPair = rsaKeyPair
 			deviceInfo.ECCKeyPair = nil
+			deviceInfo.Ed25519KeyPair = nil
 
 		}
 	} else if deviceInfo.Algorithm == "ECC" {
-		eccKeyPair, err := ECCKeyGeneratorService.Generate()
+		curve, err := signingCrypto.ParseCurve(deviceInfo.KeyParameters.Curve)
+		if err != nil {
+			return err
+		}
+		eccKeyGenerator := signingCrypto.ECCGenerator{Curve: curve}
+		eccKeyPair, err := eccKeyGenerator.Generate()
 		if err != nil {
 			return err
 		} else {
 			deviceInfo.ECCKeyPair = eccKeyPair
 			deviceInfo.RSAKeyPair = nil
+			deviceInfo.Ed25519KeyPair = nil
+
+		}
+	} else if deviceInfo.Algorithm == "ED25519" {
+		ed25519KeyPair, err := Ed25519KeyGeneratorService.Generate()
+		if err != nil {
+			return err
+		} else {
+			deviceInfo.Ed25519KeyPair = ed25519KeyPair
+			deviceInfo.RSAKeyPair = nil
+			deviceInfo.ECCKeyPair = nil
 
 		}
+	} else {
+		return fmt.Errorf("unsupported signature algorithm %q", deviceInfo.Algorithm)
 	}
-	err := s.queryer.CreateSignatureDevice(deviceInfo)
-	return err
+	return nil
 }
 
 // Get stored device info
@@ -70,30 +175,127 @@ func (s Service) GetSignatureDeviceInfo(id string) (*persistence.DeviceInfo, err
 	return deviceInfo, err
 }
 
-// Save last_signature_base64_encoded writes the key value to the db
-func (s Service) SaveLastSignatureBase64(last_signature_base64_encoded string) error {
-	s.log.Println(">> [deviceService][SaveLastSignatureBase64][Received]")
-	err := s.queryer.SaveLastSignatureBase64(last_signature_base64_encoded)
-	return err
+// Get device details for the inventory, without any private key material
+func (s Service) GetSignatureDevice(id string) (*DeviceResponse, error) {
+	s.log.Println(">> [deviceService][GetSignatureDevice][Received]")
+	deviceInfo, err := s.queryer.GetSignatureDeviceInfo(id)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceResponse, err := newDeviceResponse(deviceInfo)
+	return &deviceResponse, err
 }
 
-func (s Service) GetLastSignatureBase64() string {
-	s.log.Println(">> [deviceService][GetSaveLastSignatureBase64][Received]")
-	last_signature_base64_encoded := s.queryer.GetLastSignatureBase64()
+// List a page of devices ordered by id. The cursor is the next_cursor of the previous page,
+// the base64url encoded id of its last device, the first page has no cursor.
+func (s Service) ListSignatureDevices(cursor string, limit int, filter persistence.DeviceFilter) (*DeviceListResponse, error) {
+	s.log.Println(">> [deviceService][ListSignatureDevices][Received]")
+	if limit < 1 || limit > MaxPageLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidPage, MaxPageLimit)
+	}
+
+	after, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidPage)
+	}
+
+	devices, nextCursor, err := s.queryer.ListSignatureDevices(string(after), limit, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceListResponse := DeviceListResponse{
+		Devices:    make([]DeviceResponse, 0, len(devices)),
+		NextCursor: base64.RawURLEncoding.EncodeToString([]byte(nextCursor)),
+	}
+	for _, deviceInfo := range devices {
+		deviceResponse, err := newDeviceResponse(deviceInfo)
+		if err != nil {
+			return nil, err
+		}
+		deviceListResponse.Devices = append(deviceListResponse.Devices, deviceResponse)
+	}
 
-	return last_signature_base64_encoded
+	return &deviceListResponse, nil
 }
 
-// Save Signature Counter writes the key value to the db
-func (s Service) SaveSignatureCounter(signature_counter int) error {
-	s.log.Println(">> [deviceService][SaveSignatureCounter][Received]")
-	err := s.queryer.SaveSignatureCounter(signature_counter)
-	return err
+// ParsePageLimit parses the limit of a page request, falling back to DefaultPageLimit
+func ParsePageLimit(value string) (int, error) {
+	if value == "" {
+		return DefaultPageLimit, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > MaxPageLimit {
+		return 0, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidPage, MaxPageLimit)
+	}
+
+	return limit, nil
 }
 
-// Get signature counter
-func (s Service) GetSignatureCounter() int {
-	s.log.Println(">> [deviceService][GetSignatureCounter][Received]")
-	counter := s.queryer.GetSignatureCounter()
-	return counter
+// Move the device through its lifecycle, e.g. suspend or retire it
+func (s Service) TransitionSignatureDevice(id string, transition domain.DeviceTransition) (*DeviceResponse, error) {
+	s.log.Println(">> [deviceService][TransitionSignatureDevice][Received]")
+	deviceInfo, err := s.queryer.UpdateSignatureDevice(id, func(deviceInfo *persistence.DeviceInfo) error {
+		state, err := deviceInfo.State.Apply(transition)
+		if err != nil {
+			return err
+		}
+
+		deviceInfo.State = state
+		if state == domain.DeviceRetired {
+			//The device certificate is revoked as of now
+			deviceInfo.RetiredAt = time.Now().UTC()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deviceResponse, err := newDeviceResponse(deviceInfo)
+	return &deviceResponse, err
+}
+
+// checkDeviceActive returns ErrDeviceNotActive unless the device may sign
+func checkDeviceActive(deviceInfo *persistence.DeviceInfo) error {
+	if deviceInfo.State != domain.DeviceActive {
+		return fmt.Errorf("%w: device %s is %s", ErrDeviceNotActive, deviceInfo.Id, deviceInfo.State)
+	}
+
+	return nil
+}
+
+func newDeviceResponse(deviceInfo *persistence.DeviceInfo) (DeviceResponse, error) {
+	deviceResponse := DeviceResponse{
+		Id:               deviceInfo.Id,
+		Label:            deviceInfo.Label,
+		Tenant:           deviceInfo.Tenant,
+		Algorithm:        deviceInfo.Algorithm,
+		State:            string(deviceInfo.State),
+		SignatureCounter: deviceInfo.SignatureCounter,
+		CreatedAt:        deviceInfo.CreatedAt,
+		KeyParameters:    deviceInfo.KeyParameters,
+		KeyVersion:       DeviceKeyVersion(deviceInfo),
+		KeyCreatedAt:     deviceInfo.KeyCreatedAt,
+		KeyRotationDue:   keyRotationDue(deviceInfo),
+
+		ImportedSignatureCounter: deviceInfo.ImportedSignatureCounter,
+		ImportedLastSignature:    deviceInfo.ImportedLastSignature,
+		SignatureGaps:            deviceInfo.SignatureGaps,
+	}
+
+	publicKey, err := DevicePublicKey(deviceInfo)
+	if err != nil {
+		return deviceResponse, err
+	}
+
+	deviceResponse.PublicKeyFingerprint, err = signingCrypto.Fingerprint(publicKey)
+	if err != nil {
+		return deviceResponse, err
+	}
+
+	deviceResponse.KeyVersions, err = deviceKeyVersions(deviceInfo)
+	return deviceResponse, err
 }
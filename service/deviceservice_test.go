@@ -0,0 +1,195 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"signing-service/domain"
+	"signing-service/persistence"
+	"strings"
+	"testing"
+)
+
+func TestParsePageLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		err   bool
+	}{
+		{"", DefaultPageLimit, false},
+		{"1", 1, false},
+		{"50", 50, false},
+		{"500", 500, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"501", 0, true},
+		{"ten", 0, true},
+		{"1.5", 0, true},
+	}
+
+	for _, test := range tests {
+		limit, err := ParsePageLimit(test.value)
+		if test.err {
+			if !errors.Is(err, ErrInvalidPage) {
+				t.Errorf("ParsePageLimit(%q) = %d, %v, want %v", test.value, limit, err, ErrInvalidPage)
+			}
+			continue
+		}
+		if err != nil || limit != test.want {
+			t.Errorf("ParsePageLimit(%q) = %d, %v, want %d", test.value, limit, err, test.want)
+		}
+	}
+}
+
+func TestListSignatureDevicesRejectsInvalidPage(t *testing.T) {
+	deviceService := NewService(testLogger)
+
+	tests := []struct {
+		name   string
+		cursor string
+		limit  int
+	}{
+		{"limit zero", "", 0},
+		{"limit above maximum", "", MaxPageLimit + 1},
+		{"cursor not base64url", "ZGV2aWNl+/==", 10},
+		{"cursor with padding", "ZGV2aWNlLTE=", 10},
+		{"cursor of a raw id", "device!", 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := deviceService.ListSignatureDevices(test.cursor, test.limit, persistence.DeviceFilter{}); !errors.Is(err, ErrInvalidPage) {
+				t.Errorf("got %v, want %v", err, ErrInvalidPage)
+			}
+		})
+	}
+}
+
+// TestListSignatureDevicesCursor pages through devices with the encoded next cursor
+func TestListSignatureDevicesCursor(t *testing.T) {
+	ids := []string{"page-device-1", "page-device-2", "page-device-3"}
+	for _, id := range ids {
+		createTestDevice(t, id, "ED25519")
+	}
+
+	deviceService := NewService(testLogger)
+	filter := persistence.DeviceFilter{Label: "page-device-"}
+
+	var listed []string
+	cursor := ""
+	for page := 1; ; page++ {
+		deviceList, err := deviceService.ListSignatureDevices(cursor, 2, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, device := range deviceList.Devices {
+			listed = append(listed, device.Id)
+		}
+
+		if deviceList.NextCursor == "" {
+			break
+		}
+		if page == 1 && deviceList.NextCursor != base64.RawURLEncoding.EncodeToString([]byte("page-device-2")) {
+			t.Errorf("next cursor %q is not the encoded id of the last device", deviceList.NextCursor)
+		}
+		if page > len(ids) {
+			t.Fatal("paging does not end")
+		}
+		cursor = deviceList.NextCursor
+	}
+
+	if len(listed) != len(ids) {
+		t.Fatalf("listed %v, want %v", listed, ids)
+	}
+	for i := range ids {
+		if listed[i] != ids[i] {
+			t.Errorf("listed %v, want %v", listed, ids)
+			break
+		}
+	}
+}
+
+// TestSignInDeviceState signs in every lifecycle state, only active devices sign
+func TestSignInDeviceState(t *testing.T) {
+	tests := []struct {
+		name        string
+		initial     domain.DeviceState
+		transitions []domain.DeviceTransition
+		state       domain.DeviceState
+		signs       bool
+	}{
+		{"active", "", nil, domain.DeviceActive, true},
+		{"inactive", domain.DeviceInactive, nil, domain.DeviceInactive, false},
+		{"activated", domain.DeviceInactive, []domain.DeviceTransition{domain.Activate}, domain.DeviceActive, true},
+		{"suspended", "", []domain.DeviceTransition{domain.Suspend}, domain.DeviceSuspended, false},
+		{"resumed", "", []domain.DeviceTransition{domain.Suspend, domain.Resume}, domain.DeviceActive, true},
+		{"retired", "", []domain.DeviceTransition{domain.Retire}, domain.DeviceRetired, false},
+		{"retired while suspended", "", []domain.DeviceTransition{domain.Suspend, domain.Retire}, domain.DeviceRetired, false},
+		{"retired while inactive", domain.DeviceInactive, []domain.DeviceTransition{domain.Retire}, domain.DeviceRetired, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := "state-device-" + strings.ReplaceAll(test.name, " ", "-")
+			deviceService := NewService(testLogger)
+			if err := deviceService.CreateSignatureDevice(&persistence.DeviceInfo{Id: id, Algorithm: "ED25519", State: test.initial}); err != nil {
+				t.Fatal(err)
+			}
+			for _, transition := range test.transitions {
+				if _, err := deviceService.TransitionSignatureDevice(id, transition); err != nil {
+					t.Fatalf("%s: %v", transition, err)
+				}
+			}
+
+			_, signErr := deviceService.SignTransaction(id, "transaction", "")
+			_, documentErr := deviceService.SignDocument(id, []byte("document"))
+			deviceInfo, err := deviceService.GetSignatureDeviceInfo(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deviceInfo.State != test.state {
+				t.Fatalf("device is %s, want %s", deviceInfo.State, test.state)
+			}
+
+			if test.signs {
+				if signErr != nil || documentErr != nil {
+					t.Fatalf("signing: %v, %v", signErr, documentErr)
+				}
+				if deviceInfo.SignatureCounter != 2 {
+					t.Errorf("device is at signature %d, want 2", deviceInfo.SignatureCounter)
+				}
+				return
+			}
+			if !errors.Is(signErr, ErrDeviceNotActive) || !errors.Is(documentErr, ErrDeviceNotActive) {
+				t.Errorf("signing: %v, %v, want %v", signErr, documentErr, ErrDeviceNotActive)
+			}
+			if deviceInfo.SignatureCounter != 0 {
+				t.Errorf("rejected signatures advanced the device to %d", deviceInfo.SignatureCounter)
+			}
+		})
+	}
+}
+
+func TestTransitionSignatureDeviceRejected(t *testing.T) {
+	id := "retired-transition-device"
+	deviceService := createTestDevice(t, id, "ED25519")
+	if _, err := deviceService.TransitionSignatureDevice(id, domain.Retire); err != nil {
+		t.Fatal(err)
+	}
+
+	deviceInfo, err := deviceService.GetSignatureDeviceInfo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deviceInfo.RetiredAt.IsZero() {
+		t.Error("retired device has no retirement time")
+	}
+
+	for _, transition := range []domain.DeviceTransition{domain.Activate, domain.Resume, domain.Suspend, domain.Retire} {
+		if _, err := deviceService.TransitionSignatureDevice(id, transition); !errors.Is(err, domain.ErrInvalidTransition) {
+			t.Errorf("%s of a retired device: %v, want %v", transition, err, domain.ErrInvalidTransition)
+		}
+	}
+	if _, err := deviceService.TransitionSignatureDevice("missing-device", domain.Suspend); !errors.Is(err, persistence.ErrDeviceNotFound) {
+		t.Errorf("transition of a missing device: %v, want %v", err, persistence.ErrDeviceNotFound)
+	}
+}
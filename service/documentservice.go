@@ -0,0 +1,108 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+)
+
+type DocumentSignatureResponse struct {
+	DeviceId         string `json:"deviceId"`
+	SignatureCounter int    `json:"signature_counter"`
+	DocumentDigest   string `json:"document_digest"`
+	Signed_Data      string `json:"signed_data"`
+	Signature        string `json:"signature"`
+	// CMS is the DER encoded detached CMS SignedData of the document
+	CMS []byte `json:"cms"`
+}
+
+// SignDocument signs the document as detached CMS SignedData with the device key and
+// its CA certificate. The signature is a link of the device signature chain like SignTransaction,
+// its data being the hex encoded SHA-256 digest of the document.
+func (s Service) SignDocument(id string, document []byte) (*DocumentSignatureResponse, error) {
+	s.log.Println(">> [deviceService][SignDocument][Received]")
+
+	var documentSignatureResponse DocumentSignatureResponse
+
+	digest := sha256.Sum256(document)
+	documentDigest := hex.EncodeToString(digest[:])
+
+	_, err := s.queryer.AdvanceSignatureChain(id, func(deviceInfo *persistence.DeviceInfo) (*persistence.SignatureRecord, error) {
+		record, _, err := newSignatureRecord(deviceInfo, documentDigest)
+		if err != nil {
+			return nil, err
+		}
+
+		certificate, err := DeviceCertificate(deviceInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		chain, err := deviceCertificateChain(deviceInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		params, err := DeviceSignatureParameters(deviceInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		//CMS carries ECDSA signatures DER encoded
+		params.Format = signingCrypto.ECDSAFormatDER
+		signer, err := newDeviceSigner(deviceInfo, params)
+		if err != nil {
+			return nil, err
+		}
+
+		cms, err := signingCrypto.SignDetachedCMS(signer, params, certificate, chain, document, record.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		documentSignatureResponse = DocumentSignatureResponse{
+			DeviceId:         deviceInfo.Id,
+			SignatureCounter: record.SignatureCounter,
+			DocumentDigest:   documentDigest,
+			Signed_Data:      record.SignedData,
+			Signature:        record.Signature,
+			CMS:              cms,
+		}
+		return record, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &documentSignatureResponse, nil
+}
+
+// VerifyDocument checks that the detached CMS signature covers the document and was made
+// with a key version of the device. It returns an error describing why it does not verify.
+func (s Service) VerifyDocument(deviceInfo *persistence.DeviceInfo, document []byte, cms []byte) error {
+	s.log.Println(">> [deviceService][VerifyDocument][Received]")
+
+	cmsSignature, err := signingCrypto.ParseDetachedCMS(cms)
+	if err != nil {
+		return err
+	}
+
+	signerFingerprint, err := signingCrypto.Fingerprint(cmsSignature.Certificate.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	keyVersions, err := deviceKeyVersions(deviceInfo)
+	if err != nil {
+		return err
+	}
+	for _, keyVersion := range keyVersions {
+		if keyVersion.PublicKeyFingerprint == signerFingerprint {
+			return cmsSignature.Verify(document)
+		}
+	}
+
+	return errors.New("cms: signer certificate is not a certificate of a device key")
+}
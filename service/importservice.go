@@ -0,0 +1,153 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"signing-service/domain"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+	"time"
+)
+
+// ErrInvalidPrivateKey is returned when an imported private key cannot become a device key
+var ErrInvalidPrivateKey = errors.New("invalid private key")
+
+// importedRSABits are the RSA key sizes accepted for import, the sizes devices are created with
+var importedRSABits = map[int]bool{2048: true, 3072: true, 4096: true}
+
+// ImportSignatureDevice creates a device with the private key of another signing provider.
+// The algorithm, RSA key size and curve of the device are those of the key. The device
+// signature chain continues the chain of the other provider: the next signature has the
+// counter after the imported one and embeds the imported last signature.
+func (s Service) ImportSignatureDevice(payload domain.ImportDevicePayload) (*DeviceResponse, error) {
+	s.log.Println(">> [deviceService][ImportSignatureDevice][Received]")
+
+	privateKey, err := signingCrypto.ParsePrivateKey([]byte(payload.PrivateKey), []byte(payload.Password))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+	}
+
+	deviceInfo := &persistence.DeviceInfo{
+		Id:                            payload.Id,
+		Label:                         payload.Label,
+		Tenant:                        payload.Tenant,
+		State:                         payload.State,
+		SignatureCounter:              payload.SignatureCounter,
+		Last_Signature_Base64_Encoded: payload.LastSignature,
+		CreatedAt:                     time.Now().UTC(),
+		KeyParameters:                 payload.KeyParameters,
+		ImportedSignatureCounter:      payload.SignatureCounter,
+		ImportedLastSignature:         payload.LastSignature,
+	}
+	if deviceInfo.State == "" {
+		deviceInfo.State = domain.DeviceActive
+	}
+
+	if err := importDeviceKey(deviceInfo, privateKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+	}
+	if payload.Algorithm != "" && payload.Algorithm != deviceInfo.Algorithm {
+		return nil, fmt.Errorf("%w: the private key is an %s key, not %s", ErrInvalidPrivateKey, deviceInfo.Algorithm, payload.Algorithm)
+	}
+	deviceInfo.KeyParameters = deviceInfo.KeyParameters.WithDefaults(deviceInfo.Algorithm)
+	deviceInfo.KeyCreatedAt = deviceInfo.CreatedAt
+
+	//Certify the imported key with the local CA
+	if _, err := issueDeviceCertificate(deviceInfo); err != nil {
+		return nil, err
+	}
+	if err := s.queryer.CreateSignatureDevice(deviceInfo); err != nil {
+		return nil, err
+	}
+
+	deviceResponse, err := newDeviceResponse(deviceInfo)
+	return &deviceResponse, err
+}
+
+// importDeviceKey makes the private key the device key and sets the device algorithm, RSA key
+// size and curve from it. The key passes the marshaler of its algorithm, so it is stored just
+// like a generated key.
+func importDeviceKey(deviceInfo *persistence.DeviceInfo, privateKey crypto.Signer) error {
+	params := &deviceInfo.KeyParameters
+
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if err := params.Check("RSA"); err != nil {
+			return err
+		}
+		if err := key.Validate(); err != nil {
+			return err
+		}
+		bits := key.N.BitLen()
+		if !importedRSABits[bits] {
+			return fmt.Errorf("RSA keys need 2048, 3072 or 4096 bits, the key has %d", bits)
+		}
+		if params.RSABits != 0 && params.RSABits != bits {
+			return fmt.Errorf("the key has %d bits, not %d", bits, params.RSABits)
+		}
+
+		rsaMarshaler := signingCrypto.NewRSAMarshaler()
+		_, privateKeyPEM, err := rsaMarshaler.Marshal(signingCrypto.RSAKeyPair{Public: &key.PublicKey, Private: key})
+		if err != nil {
+			return err
+		}
+		rsaKeyPair, err := rsaMarshaler.Unmarshal(privateKeyPEM)
+		if err != nil {
+			return err
+		}
+
+		deviceInfo.Algorithm = "RSA"
+		params.RSABits = bits
+		deviceInfo.RSAKeyPair = rsaKeyPair
+	case *ecdsa.PrivateKey:
+		if err := params.Check("ECC"); err != nil {
+			return err
+		}
+		curve := key.Curve.Params().Name
+		if _, err := signingCrypto.ParseCurve(curve); err != nil {
+			return err
+		}
+		if params.Curve != "" && params.Curve != curve {
+			return fmt.Errorf("the key is on curve %s, not %s", curve, params.Curve)
+		}
+
+		eccMarshaler := signingCrypto.NewECCMarshaler()
+		_, privateKeyPEM, err := eccMarshaler.Encode(signingCrypto.ECCKeyPair{Public: &key.PublicKey, Private: key})
+		if err != nil {
+			return err
+		}
+		eccKeyPair, err := eccMarshaler.Decode(privateKeyPEM)
+		if err != nil {
+			return err
+		}
+
+		deviceInfo.Algorithm = "ECC"
+		params.Curve = curve
+		deviceInfo.ECCKeyPair = eccKeyPair
+	case ed25519.PrivateKey:
+		if err := params.Check("ED25519"); err != nil {
+			return err
+		}
+
+		ed25519Marshaler := signingCrypto.NewEd25519Marshaler()
+		_, privateKeyPEM, err := ed25519Marshaler.Encode(signingCrypto.Ed25519KeyPair{Public: key.Public().(ed25519.PublicKey), Private: key})
+		if err != nil {
+			return err
+		}
+		ed25519KeyPair, err := ed25519Marshaler.Decode(privateKeyPEM)
+		if err != nil {
+			return err
+		}
+
+		deviceInfo.Algorithm = "ED25519"
+		deviceInfo.Ed25519KeyPair = ed25519KeyPair
+	default:
+		return fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+
+	return nil
+}
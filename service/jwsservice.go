@@ -0,0 +1,75 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+)
+
+// JWSPayload is the payload of the JWS of a signature record
+type JWSPayload struct {
+	SignatureCounter int    `json:"signature_counter"`
+	Data             string `json:"data"`
+	LastSignature    string `json:"last_signature"`
+}
+
+// NewDeviceJWS signs the payload as compact JWS with the device key. The header carries the
+// JWS algorithm of the device (RS256, PS256, ES384, EdDSA, ...) and the kid of its public key JWK.
+func NewDeviceJWS(deviceInfo *persistence.DeviceInfo, payload JWSPayload) (string, error) {
+	jwk, signer, err := newDeviceEnvelopeSigner(deviceInfo)
+	if err != nil {
+		return "", err
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return signingCrypto.SignJWS(signer, signingCrypto.JWSHeader{
+		Alg: jwk.Alg,
+		Kid: jwk.Kid,
+	}, payloadBytes)
+}
+
+// newDeviceEnvelopeSigner returns the public key JWK of the device and a signer producing
+// signatures as JWS and COSE expect them, ECDSA signatures as r||s
+func newDeviceEnvelopeSigner(deviceInfo *persistence.DeviceInfo) (*signingCrypto.JWK, signingCrypto.Signer, error) {
+	jwk, params, err := deviceJWK(deviceInfo, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params.Format = signingCrypto.ECDSAFormatP1363
+	signer, err := newDeviceSigner(deviceInfo, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return jwk, signer, nil
+}
+
+// deviceJWK returns the public key JWK of a device key version and the signature parameters of
+// the device, the JWK must name the JWS algorithm of the device
+func deviceJWK(deviceInfo *persistence.DeviceInfo, version int) (*signingCrypto.JWK, signingCrypto.SignatureParameters, error) {
+	publicKey, err := DeviceKeyVersionPublicKey(deviceInfo, version)
+	if err != nil {
+		return nil, signingCrypto.SignatureParameters{}, err
+	}
+
+	params, err := DeviceSignatureParameters(deviceInfo)
+	if err != nil {
+		return nil, params, err
+	}
+
+	jwk, err := signingCrypto.NewJWK(publicKey, params)
+	if err != nil {
+		return nil, params, err
+	}
+	if jwk.Alg == "" {
+		return nil, params, fmt.Errorf("device %s has no JWS algorithm for its key parameters", deviceInfo.Id)
+	}
+
+	return jwk, params, nil
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"signing-service/domain"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+	"strings"
+	"testing"
+)
+
+// jwsHashes is the digest of each JWS algorithm number suffix
+var jwsHashes = map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+
+// jwsCurves is the curve of each EC JWK crv
+var jwsCurves = map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+
+func decodeJWSPart(t *testing.T, part string) []byte {
+	t.Helper()
+
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		t.Fatalf("invalid base64url %q", part)
+	}
+	return b
+}
+
+// verifyJWK verifies the signature of the signing input with the public key of the JWK as
+// RFC 7518 defines its algorithm, independent of the signers of the service
+func verifyJWK(t *testing.T, jwk *signingCrypto.JWK, signingInput string, signature []byte) error {
+	t.Helper()
+
+	alg := jwk.Alg
+	if alg == "EdDSA" {
+		if !ed25519.Verify(ed25519.PublicKey(decodeJWSPart(t, jwk.X)), []byte(signingInput), signature) {
+			return signingCrypto.ErrInvalidSignature
+		}
+		return nil
+	}
+
+	hash, ok := jwsHashes[alg[2:]]
+	if !ok {
+		t.Fatalf("unknown JWS algorithm %s", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		publicKey := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(decodeJWSPart(t, jwk.N)),
+			E: int(new(big.Int).SetBytes(decodeJWSPart(t, jwk.E)).Int64()),
+		}
+		if alg[:2] == "RS" {
+			return rsa.VerifyPKCS1v15(publicKey, hash, digest, signature)
+		}
+		return rsa.VerifyPSS(publicKey, hash, digest, signature, nil)
+	case "ES":
+		publicKey := &ecdsa.PublicKey{
+			Curve: jwsCurves[jwk.Crv],
+			X:     new(big.Int).SetBytes(decodeJWSPart(t, jwk.X)),
+			Y:     new(big.Int).SetBytes(decodeJWSPart(t, jwk.Y)),
+		}
+		//JWS ECDSA signatures are r||s of the curve size
+		size := len(signature) / 2
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(publicKey, digest, r, s) {
+			return signingCrypto.ErrInvalidSignature
+		}
+		return nil
+	}
+
+	t.Fatalf("unknown JWS algorithm %s", alg)
+	return nil
+}
+
+// TestSignTransactionJWS checks that the compact JWS of a signature verifies with the
+// device JWK and that its header names the device algorithm and key
+func TestSignTransactionJWS(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		params    domain.KeyParameters
+		alg       string
+	}{
+		{"RSA", "RSA", domain.KeyParameters{}, "PS256"},
+		{"RSA PKCS1v15", "RSA", domain.KeyParameters{Hash: "SHA-512", Padding: "PKCS1v15"}, "RS512"},
+		{"ECC", "ECC", domain.KeyParameters{}, "ES384"},
+		{"ECC P-256", "ECC", domain.KeyParameters{Curve: "P-256", Deterministic: true}, "ES256"},
+		{"ECC P-521", "ECC", domain.KeyParameters{Curve: "P-521"}, "ES512"},
+		//The device signs DER, its JWS still carries r||s
+		{"ECC P1363", "ECC", domain.KeyParameters{Curve: "P-256", SignatureFormat: "P1363"}, "ES256"},
+		{"ED25519", "ED25519", domain.KeyParameters{}, "EdDSA"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := "jws-device-" + strings.ReplaceAll(test.name, " ", "-")
+			deviceService := NewService(testLogger)
+			if err := deviceService.CreateSignatureDevice(&persistence.DeviceInfo{Id: id, Algorithm: test.algorithm, KeyParameters: test.params}); err != nil {
+				t.Fatal(err)
+			}
+
+			first, err := deviceService.SignTransaction(id, "first", domain.FormatJWS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response, err := deviceService.SignTransaction(id, "second", domain.FormatJWS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			publicKey, err := deviceService.GetPublicKey(id, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			jwk := publicKey.JWK
+
+			parts := strings.Split(response.JWS, ".")
+			if len(parts) != 3 {
+				t.Fatalf("JWS %q is not in compact serialization", response.JWS)
+			}
+
+			var header signingCrypto.JWSHeader
+			if err := json.Unmarshal(decodeJWSPart(t, parts[0]), &header); err != nil {
+				t.Fatal(err)
+			}
+			if header.Alg != test.alg || header.Alg != jwk.Alg {
+				t.Errorf("header alg %s, JWK alg %s, want %s", header.Alg, jwk.Alg, test.alg)
+			}
+			if header.Kid != jwk.Kid || header.Kid != jwk.Thumbprint() {
+				t.Errorf("header kid %s is not the JWK thumbprint %s", header.Kid, jwk.Thumbprint())
+			}
+
+			var payload JWSPayload
+			if err := json.Unmarshal(decodeJWSPart(t, parts[1]), &payload); err != nil {
+				t.Fatal(err)
+			}
+			if payload.SignatureCounter != 2 || payload.Data != "second" || payload.LastSignature != first.Signature {
+				t.Errorf("payload %+v is not the second link of the chain", payload)
+			}
+
+			signature := decodeJWSPart(t, parts[2])
+			if err := verifyJWK(t, jwk, parts[0]+"."+parts[1], signature); err != nil {
+				t.Errorf("JWS does not verify with the device JWK: %v", err)
+			}
+
+			tamperedPayload := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(decodeJWSPart(t, parts[1])), "second", "forged", 1)))
+			if err := verifyJWK(t, jwk, parts[0]+"."+tamperedPayload, signature); err == nil {
+				t.Error("JWS with a tampered payload verifies")
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"crypto"
+	"fmt"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+)
+
+type PublicKeyResponse struct {
+	DeviceId   string             `json:"deviceId"`
+	Algorithm  string             `json:"algorithm"`
+	KeyVersion int                `json:"key_version"`
+	Kid        string             `json:"kid"`
+	PublicKey  string             `json:"public_key"`
+	JWK        *signingCrypto.JWK `json:"jwk"`
+}
+
+// GetPublicKey returns the public key of a device key version as PEM encoded SubjectPublicKeyInfo
+// and as JWK, a version of 0 returns the current key
+func (s Service) GetPublicKey(id string, version int) (*PublicKeyResponse, error) {
+	s.log.Println(">> [deviceService][GetPublicKey][Received]")
+
+	deviceInfo, err := s.queryer.GetSignatureDeviceInfo(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == 0 {
+		version = DeviceKeyVersion(deviceInfo)
+	}
+	publicKey, err := DeviceKeyVersionPublicKey(deviceInfo, version)
+	if err != nil {
+		return nil, err
+	}
+
+	var publicKeyPEM []byte
+	if version == DeviceKeyVersion(deviceInfo) {
+		publicKeyPEM, err = EncodeDevicePublicKey(deviceInfo)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		publicKeyPEM = []byte(deviceInfo.KeyVersions[version-1].PublicKey)
+	}
+
+	params, err := DeviceSignatureParameters(deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk, err := signingCrypto.NewJWK(publicKey, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublicKeyResponse{
+		DeviceId:   deviceInfo.Id,
+		Algorithm:  deviceInfo.Algorithm,
+		KeyVersion: version,
+		Kid:        jwk.Kid,
+		PublicKey:  string(publicKeyPEM),
+		JWK:        jwk,
+	}, nil
+}
+
+// DevicePublicKey returns the public key matching the device algorithm
+func DevicePublicKey(deviceInfo *persistence.DeviceInfo) (crypto.PublicKey, error) {
+	switch deviceInfo.Algorithm {
+	case "RSA":
+		if deviceInfo.RSAKeyPair == nil || deviceInfo.RSAKeyPair.Public == nil {
+			return nil, fmt.Errorf("device %s has no RSA key", deviceInfo.Id)
+		}
+		return deviceInfo.RSAKeyPair.Public, nil
+	case "ECC":
+		if deviceInfo.ECCKeyPair == nil || deviceInfo.ECCKeyPair.Public == nil {
+			return nil, fmt.Errorf("device %s has no ECC key", deviceInfo.Id)
+		}
+		return deviceInfo.ECCKeyPair.Public, nil
+	case "ED25519":
+		if deviceInfo.Ed25519KeyPair == nil || deviceInfo.Ed25519KeyPair.Public == nil {
+			return nil, fmt.Errorf("device %s has no Ed25519 key", deviceInfo.Id)
+		}
+		return deviceInfo.Ed25519KeyPair.Public, nil
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm %q", deviceInfo.Algorithm)
+	}
+}
+
+// DeviceSignatureParameters returns the digest, RSA padding, ECDSA nonce mode and ECDSA encoding the device signs with
+func DeviceSignatureParameters(deviceInfo *persistence.DeviceInfo) (signingCrypto.SignatureParameters, error) {
+	keyParameters := deviceInfo.KeyParameters.WithDefaults(deviceInfo.Algorithm)
+	params, err := signingCrypto.ParseSignatureParameters(keyParameters.Hash, keyParameters.Padding)
+	params.Deterministic = keyParameters.Deterministic
+	params.Format = signingCrypto.ECDSAFormat(keyParameters.SignatureFormat)
+	return params, err
+}
+
+// EncodeDevicePublicKey encodes the device public key with the marshaler of the device algorithm
+func EncodeDevicePublicKey(deviceInfo *persistence.DeviceInfo) ([]byte, error) {
+	switch deviceInfo.Algorithm {
+	case "RSA":
+		if deviceInfo.RSAKeyPair == nil {
+			return nil, fmt.Errorf("device %s has no RSA key", deviceInfo.Id)
+		}
+		rsaMarshaler := signingCrypto.NewRSAMarshaler()
+		return rsaMarshaler.MarshalPublic(deviceInfo.RSAKeyPair.Public)
+	case "ECC":
+		if deviceInfo.ECCKeyPair == nil {
+			return nil, fmt.Errorf("device %s has no ECC key", deviceInfo.Id)
+		}
+		return signingCrypto.NewECCMarshaler().EncodePublic(deviceInfo.ECCKeyPair.Public)
+	case "ED25519":
+		if deviceInfo.Ed25519KeyPair == nil {
+			return nil, fmt.Errorf("device %s has no Ed25519 key", deviceInfo.Id)
+		}
+		return signingCrypto.NewEd25519Marshaler().EncodePublic(deviceInfo.Ed25519KeyPair.Public)
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm %q", deviceInfo.Algorithm)
+	}
+}
+
+// DevicePrivateKey returns the private key matching the device algorithm
+func DevicePrivateKey(deviceInfo *persistence.DeviceInfo) (crypto.Signer, error) {
+	switch deviceInfo.Algorithm {
+	case "RSA":
+		if deviceInfo.RSAKeyPair == nil || deviceInfo.RSAKeyPair.Private == nil {
+			return nil, fmt.Errorf("device %s has no RSA private key", deviceInfo.Id)
+		}
+		return deviceInfo.RSAKeyPair.Private, nil
+	case "ECC":
+		if deviceInfo.ECCKeyPair == nil || deviceInfo.ECCKeyPair.Private == nil {
+			return nil, fmt.Errorf("device %s has no ECC private key", deviceInfo.Id)
+		}
+		return deviceInfo.ECCKeyPair.Private, nil
+	case "ED25519":
+		if deviceInfo.Ed25519KeyPair == nil || deviceInfo.Ed25519KeyPair.Private == nil {
+			return nil, fmt.Errorf("device %s has no Ed25519 private key", deviceInfo.Id)
+		}
+		return deviceInfo.Ed25519KeyPair.Private, nil
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm %q", deviceInfo.Algorithm)
+	}
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"crypto"
+	"fmt"
+	"signing-service/config"
+	"signing-service/domain"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type KeyRotationResponse struct {
+	DeviceId             string `json:"deviceId"`
+	KeyVersion           int    `json:"key_version"`
+	PublicKeyFingerprint string `json:"public_key_fingerprint"`
+	// SignatureCounter, Signed_Data and Signature are the key rotation link signed with the previous key
+	SignatureCounter int    `json:"signature_counter"`
+	Signed_Data      string `json:"signed_data"`
+	Signature        string `json:"signature"`
+}
+
+type KeyVersionResponse struct {
+	Version              int        `json:"version"`
+	PublicKeyFingerprint string     `json:"public_key_fingerprint"`
+	FirstSignature       int        `json:"first_signature"`
+	LastSignature        int        `json:"last_signature,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+	RotatedAt            *time.Time `json:"rotated_at,omitempty"`
+}
+
+// RotateDeviceKey replaces the device key by a new key version of the same algorithm and key
+// parameters. The rotation is a link of the device signature chain signed with the previous
+// key, its data announces the version and fingerprint of the new key. The previous key keeps
+// only its public key and the range of signature counters it signed, its certificate is
+// superseded by one for the new key.
+func (s Service) RotateDeviceKey(id string) (*KeyRotationResponse, error) {
+	s.log.Println(">> [deviceService][RotateDeviceKey][Received]")
+
+	var keyRotationResponse KeyRotationResponse
+
+	_, err := s.queryer.AdvanceSignatureChain(id, func(deviceInfo *persistence.DeviceInfo) (*persistence.SignatureRecord, error) {
+		if deviceInfo.State == domain.DeviceRetired {
+			return nil, fmt.Errorf("%w: device %s is %s", ErrDeviceNotActive, deviceInfo.Id, deviceInfo.State)
+		}
+
+		nextKey := persistence.DeviceInfo{
+			Id:            deviceInfo.Id,
+			Algorithm:     deviceInfo.Algorithm,
+			KeyParameters: deviceInfo.KeyParameters,
+		}
+		if err := generateDeviceKey(&nextKey); err != nil {
+			return nil, err
+		}
+		nextPublicKey, err := DevicePublicKey(&nextKey)
+		if err != nil {
+			return nil, err
+		}
+		nextFingerprint, err := signingCrypto.Fingerprint(nextPublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		version := DeviceKeyVersion(deviceInfo)
+		record, _, err := signChainLink(deviceInfo, signingCrypto.KeyRotationData(version+1, nextFingerprint))
+		if err != nil {
+			return nil, err
+		}
+
+		publicKeyPEM, err := EncodeDevicePublicKey(deviceInfo)
+		if err != nil {
+			return nil, err
+		}
+		deviceInfo.KeyVersions = append(deviceInfo.KeyVersions, persistence.KeyVersion{
+			Version:        version,
+			PublicKey:      string(publicKeyPEM),
+			FirstSignature: deviceKeyFirstSignature(deviceInfo),
+			LastSignature:  record.SignatureCounter,
+			CreatedAt:      deviceInfo.KeyCreatedAt,
+			RotatedAt:      record.Timestamp,
+			Certificate:    deviceInfo.Certificate,
+		})
+
+		deviceInfo.RSAKeyPair = nextKey.RSAKeyPair
+		deviceInfo.ECCKeyPair = nextKey.ECCKeyPair
+		deviceInfo.Ed25519KeyPair = nextKey.Ed25519KeyPair
+		deviceInfo.KeyCreatedAt = record.Timestamp
+
+		//The certificate of the previous key is superseded, an uploaded chain has to be requested again
+		deviceInfo.Certificate = nil
+		deviceInfo.CertificateChain = nil
+		if _, err := issueDeviceCertificate(deviceInfo); err != nil {
+			return nil, err
+		}
+
+		keyRotationResponse = KeyRotationResponse{
+			DeviceId:             deviceInfo.Id,
+			KeyVersion:           version + 1,
+			PublicKeyFingerprint: nextFingerprint,
+			SignatureCounter:     record.SignatureCounter,
+			Signed_Data:          record.SignedData,
+			Signature:            record.Signature,
+		}
+		return record, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyRotationResponse, nil
+}
+
+// DeviceKeyVersion returns the version of the current device key, 1 until it is rotated
+func DeviceKeyVersion(deviceInfo *persistence.DeviceInfo) int {
+	return len(deviceInfo.KeyVersions) + 1
+}
+
+// deviceKeyFirstSignature returns the first signature counter of the current device key
+func deviceKeyFirstSignature(deviceInfo *persistence.DeviceInfo) int {
+	if len(deviceInfo.KeyVersions) == 0 {
+		return deviceInfo.ImportedSignatureCounter + 1
+	}
+
+	return deviceInfo.KeyVersions[len(deviceInfo.KeyVersions)-1].LastSignature + 1
+}
+
+// deviceKeyVersionForCounter returns the key version that signed the signature counter, the
+// counters of the chain an imported device continues were signed by its first key
+func deviceKeyVersionForCounter(deviceInfo *persistence.DeviceInfo, signatureCounter int) int {
+	for _, keyVersion := range deviceInfo.KeyVersions {
+		if signatureCounter <= keyVersion.LastSignature {
+			return keyVersion.Version
+		}
+	}
+
+	return DeviceKeyVersion(deviceInfo)
+}
+
+// DeviceKeyVersionPublicKey returns the public key of a device key version, the current key
+// for a version of 0
+func DeviceKeyVersionPublicKey(deviceInfo *persistence.DeviceInfo, version int) (crypto.PublicKey, error) {
+	if version == 0 || version == DeviceKeyVersion(deviceInfo) {
+		return DevicePublicKey(deviceInfo)
+	}
+	if version < 0 || version > len(deviceInfo.KeyVersions) {
+		return nil, fmt.Errorf("%w: device %s has no key version %d", persistence.ErrDeviceNotFound, deviceInfo.Id, version)
+	}
+
+	return signingCrypto.ParsePublicKey([]byte(deviceInfo.KeyVersions[version-1].PublicKey))
+}
+
+// NewDeviceKeyVerifier returns the verifier of a device key version
+func NewDeviceKeyVerifier(deviceInfo *persistence.DeviceInfo, version int) (signingCrypto.Verifier, error) {
+	publicKey, err := DeviceKeyVersionPublicKey(deviceInfo, version)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := DeviceSignatureParameters(deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return signingCrypto.NewVerifier(publicKey, params)
+}
+
+// deviceChainKeys returns all key versions of the device for chain verification
+func deviceChainKeys(deviceInfo *persistence.DeviceInfo) ([]signingCrypto.ChainKey, error) {
+	chainKeys := make([]signingCrypto.ChainKey, 0, DeviceKeyVersion(deviceInfo))
+	for version := 1; version <= DeviceKeyVersion(deviceInfo); version++ {
+		publicKey, err := DeviceKeyVersionPublicKey(deviceInfo, version)
+		if err != nil {
+			return nil, err
+		}
+
+		chainKey := signingCrypto.ChainKey{Version: version}
+		if chainKey.Fingerprint, err = signingCrypto.Fingerprint(publicKey); err != nil {
+			return nil, err
+		}
+		if chainKey.Verifier, err = NewDeviceKeyVerifier(deviceInfo, version); err != nil {
+			return nil, err
+		}
+		if version <= len(deviceInfo.KeyVersions) {
+			chainKey.LastSignature = deviceInfo.KeyVersions[version-1].LastSignature
+		}
+		chainKeys = append(chainKeys, chainKey)
+	}
+
+	return chainKeys, nil
+}
+
+// deviceKeyVersions lists the key versions of the device with their signature counter ranges
+func deviceKeyVersions(deviceInfo *persistence.DeviceInfo) ([]KeyVersionResponse, error) {
+	keyVersions := make([]KeyVersionResponse, 0, DeviceKeyVersion(deviceInfo))
+	for i := range deviceInfo.KeyVersions {
+		keyVersion := &deviceInfo.KeyVersions[i]
+		publicKey, err := signingCrypto.ParsePublicKey([]byte(keyVersion.PublicKey))
+		if err != nil {
+			return nil, err
+		}
+		fingerprint, err := signingCrypto.Fingerprint(publicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keyVersions = append(keyVersions, KeyVersionResponse{
+			Version:              keyVersion.Version,
+			PublicKeyFingerprint: fingerprint,
+			FirstSignature:       keyVersion.FirstSignature,
+			LastSignature:        keyVersion.LastSignature,
+			CreatedAt:            keyVersion.CreatedAt,
+			RotatedAt:            &keyVersion.RotatedAt,
+		})
+	}
+
+	publicKey, err := DevicePublicKey(deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := signingCrypto.Fingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(keyVersions, KeyVersionResponse{
+		Version:              DeviceKeyVersion(deviceInfo),
+		PublicKeyFingerprint: fingerprint,
+		FirstSignature:       deviceKeyFirstSignature(deviceInfo),
+		CreatedAt:            deviceInfo.KeyCreatedAt,
+	}), nil
+}
+
+// KeyRotationInterval is the age after which a device key is due for rotation
+func KeyRotationInterval() time.Duration {
+	return time.Duration(config.Env.KeyRotationDays) * 24 * time.Hour
+}
+
+// keyRotationDue reports whether the current device key is older than KeyRotationInterval
+func keyRotationDue(deviceInfo *persistence.DeviceInfo) bool {
+	return config.Env.KeyRotationDays > 0 && time.Since(deviceInfo.KeyCreatedAt) > KeyRotationInterval()
+}
+
+// signedDataCounter returns the signature counter signed data starts with, or 0
+func signedDataCounter(signedData string) int {
+	counter, err := strconv.Atoi(strings.SplitN(signedData, "_", 2)[0])
+	if err != nil {
+		return 0
+	}
+
+	return counter
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"signing-service/domain"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+	"strings"
+	"testing"
+)
+
+// rotateTestDevice rotates the key of the device and checks the rotation link announces the new key
+func rotateTestDevice(t *testing.T, deviceService *Service, id string) *KeyRotationResponse {
+	t.Helper()
+
+	rotation, err := deviceService.RotateDeviceKey(id)
+	if err != nil {
+		t.Fatalf("RotateDeviceKey: %v", err)
+	}
+
+	deviceInfo, err := deviceService.GetSignatureDeviceInfo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := DevicePublicKey(deviceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := signingCrypto.Fingerprint(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := signingCrypto.KeyRotationData(rotation.KeyVersion, fingerprint)
+	if rotation.KeyVersion != DeviceKeyVersion(deviceInfo) || rotation.PublicKeyFingerprint != fingerprint ||
+		!strings.HasPrefix(rotation.Signed_Data, fmt.Sprintf("%d_%s_", rotation.SignatureCounter, data)) {
+		t.Fatalf("rotation %+v does not announce key version %d with fingerprint %s", *rotation, DeviceKeyVersion(deviceInfo), fingerprint)
+	}
+	return rotation
+}
+
+// TestRotateDeviceKeyChain signs across two key rotations and verifies every signature and the chain
+func TestRotateDeviceKeyChain(t *testing.T) {
+	for _, algorithm := range []string{"RSA", "ECC", "ED25519"} {
+		t.Run(algorithm, func(t *testing.T) {
+			id := "rotated-" + algorithm
+			deviceService := createTestDevice(t, id, algorithm)
+
+			type signature struct {
+				counter    int
+				version    int
+				signedData string
+				signature  string
+			}
+			var signatures []signature
+			sign := func(count int, version int) {
+				for i := 0; i < count; i++ {
+					response, err := deviceService.SignTransaction(id, "transaction", "")
+					if err != nil {
+						t.Fatal(err)
+					}
+					signatures = append(signatures, signature{len(signatures) + 1, version, response.Signed_Data, response.Signature})
+				}
+			}
+
+			sign(2, 1)
+			rotation := rotateTestDevice(t, deviceService, id)
+			signatures = append(signatures, signature{rotation.SignatureCounter, 1, rotation.Signed_Data, rotation.Signature})
+			sign(2, 2)
+			rotation = rotateTestDevice(t, deviceService, id)
+			signatures = append(signatures, signature{rotation.SignatureCounter, 2, rotation.Signed_Data, rotation.Signature})
+			sign(1, 3)
+
+			deviceInfo, err := deviceService.GetSignatureDeviceInfo(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if DeviceKeyVersion(deviceInfo) != 3 || deviceInfo.SignatureCounter != 7 {
+				t.Fatalf("device is at key version %d and signature %d, want 3 and 7", DeviceKeyVersion(deviceInfo), deviceInfo.SignatureCounter)
+			}
+
+			keyVersions, err := deviceKeyVersions(deviceInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantRanges := [][2]int{{1, 3}, {4, 6}, {7, 0}}
+			for i, keyVersion := range keyVersions {
+				if keyVersion.Version != i+1 || keyVersion.FirstSignature != wantRanges[i][0] || keyVersion.LastSignature != wantRanges[i][1] {
+					t.Errorf("key version %+v, want signatures %v", keyVersion, wantRanges[i])
+				}
+			}
+
+			for _, s := range signatures {
+				signatureBytes, err := base64.StdEncoding.DecodeString(s.signature)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := deviceService.VerifySignature(deviceInfo, []byte(s.signedData), signatureBytes); err != nil {
+					t.Errorf("signature %d: %v", s.counter, err)
+				}
+				if deviceKeyVersionForCounter(deviceInfo, s.counter) != s.version {
+					t.Errorf("signature %d is assigned key version %d, want %d", s.counter, deviceKeyVersionForCounter(deviceInfo, s.counter), s.version)
+				}
+
+				//Another key version does not verify the signature
+				other := s.version%3 + 1
+				verifier, err := NewDeviceKeyVerifier(deviceInfo, other)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if verifier.Verify([]byte(s.signedData), signatureBytes) == nil {
+					t.Errorf("signature %d verifies with key version %d", s.counter, other)
+				}
+			}
+
+			report, err := deviceService.VerifySignatureChain(id)
+			if err != nil || !report.Valid || report.VerifiedSignatures != 7 {
+				t.Errorf("chain across key versions: %+v, %v", report, err)
+			}
+		})
+	}
+}
+
+func TestRotateDeviceKeyRetired(t *testing.T) {
+	id := "rotate-retired-device"
+	deviceService := createTestDevice(t, id, "ED25519")
+	if _, err := deviceService.SignTransaction(id, "transaction", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := deviceService.TransitionSignatureDevice(id, domain.Retire); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := deviceService.RotateDeviceKey(id); !errors.Is(err, ErrDeviceNotActive) {
+		t.Errorf("rotation of a retired device: %v, want %v", err, ErrDeviceNotActive)
+	}
+
+	deviceInfo, err := deviceService.GetSignatureDeviceInfo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if DeviceKeyVersion(deviceInfo) != 1 || deviceInfo.SignatureCounter != 1 {
+		t.Errorf("rejected rotation left the device at key version %d and signature %d", DeviceKeyVersion(deviceInfo), deviceInfo.SignatureCounter)
+	}
+
+	if _, err := deviceService.RotateDeviceKey("missing-device"); !errors.Is(err, persistence.ErrDeviceNotFound) {
+		t.Errorf("rotation of a missing device: %v, want %v", err, persistence.ErrDeviceNotFound)
+	}
+}
+
+// TestSignTransactionRotationPrefix checks that user data cannot pose as a key rotation link
+func TestSignTransactionRotationPrefix(t *testing.T) {
+	id := "rotation-prefix-device"
+	deviceService := createTestDevice(t, id, "ED25519")
+
+	for _, data := range []string{
+		signingCrypto.KeyRotationData(2, "fingerprint"),
+		"key_rotation:",
+		"key_rotation:anything",
+	} {
+		if _, err := deviceService.SignTransaction(id, data, ""); !errors.Is(err, ErrInvalidSignData) {
+			t.Errorf("SignTransaction(%q) = %v, want %v", data, err, ErrInvalidSignData)
+		}
+	}
+
+	//The prefix is only reserved at the start of the data
+	if _, err := deviceService.SignTransaction(id, "no key_rotation:2:fingerprint", ""); err != nil {
+		t.Errorf("data containing the rotation prefix: %v", err)
+	}
+
+	deviceInfo, err := deviceService.GetSignatureDeviceInfo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deviceInfo.SignatureCounter != 1 {
+		t.Errorf("device is at signature %d, want 1", deviceInfo.SignatureCounter)
+	}
+}
+
+// TestGetPublicKeyVersion checks that the public key of a key version stays available after rotation
+func TestGetPublicKeyVersion(t *testing.T) {
+	id := "public-key-version-device"
+	deviceService := createTestDevice(t, id, "ECC")
+
+	first, err := deviceService.GetPublicKey(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotateTestDevice(t, deviceService, id)
+	current, err := deviceService.GetPublicKey(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.KeyVersion != 2 || current.PublicKey == first.PublicKey || current.Kid == first.Kid {
+		t.Fatalf("current key %d is the key before the rotation", current.KeyVersion)
+	}
+
+	historical, err := deviceService.GetPublicKey(id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if historical.KeyVersion != 1 || historical.PublicKey != first.PublicKey || historical.Kid != first.Kid || historical.JWK.X != first.JWK.X {
+		t.Errorf("key version 1 is %+v, want the key before the rotation %+v", *historical, *first)
+	}
+
+	latest, err := deviceService.GetPublicKey(id, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.PublicKey != current.PublicKey || latest.Kid != current.Kid {
+		t.Error("key version 2 is not the current key")
+	}
+
+	for _, version := range []int{3, -1} {
+		if _, err := deviceService.GetPublicKey(id, version); !errors.Is(err, persistence.ErrDeviceNotFound) {
+			t.Errorf("GetPublicKey(%d) = %v, want %v", version, err, persistence.ErrDeviceNotFound)
+		}
+	}
+}
+
+// TestVerifySignatureChainTamperedRotation checks that a stored rotation link cannot hand the chain
+// over to another key or be turned into an ordinary signature
+func TestVerifySignatureChainTamperedRotation(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(record *persistence.SignatureRecord, rotation *KeyRotationResponse)
+		reason string
+	}{
+		{
+			name: "announced fingerprint",
+			tamper: func(record *persistence.SignatureRecord, rotation *KeyRotationResponse) {
+				record.SignedData = strings.Replace(record.SignedData, rotation.PublicKeyFingerprint, strings.Repeat("0", len(rotation.PublicKeyFingerprint)), 1)
+			},
+			reason: "key rotation to version 2 announces fingerprint",
+		},
+		{
+			name: "announced version",
+			tamper: func(record *persistence.SignatureRecord, rotation *KeyRotationResponse) {
+				record.SignedData = strings.Replace(record.SignedData, "key_rotation:2:", "key_rotation:3:", 1)
+			},
+			reason: "chain rotates to key version 3, expected 2",
+		},
+		{
+			name: "rotation turned into a transaction",
+			tamper: func(record *persistence.SignatureRecord, rotation *KeyRotationResponse) {
+				record.SignedData = strings.Replace(record.SignedData, "key_rotation:2:"+rotation.PublicKeyFingerprint, "transaction", 1)
+			},
+			reason: "key version 1 was rotated at signature 3, but it is no key rotation",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := "tampered-rotation-" + strings.ReplaceAll(test.name, " ", "-")
+			deviceService := createTestDevice(t, id, "ED25519")
+			for i := 0; i < 2; i++ {
+				if _, err := deviceService.SignTransaction(id, "transaction", ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			rotation := rotateTestDevice(t, deviceService, id)
+			if _, err := deviceService.SignTransaction(id, "transaction", ""); err != nil {
+				t.Fatal(err)
+			}
+
+			tamperSignatureRecord(t, id, rotation.SignatureCounter, func(record *persistence.SignatureRecord) {
+				test.tamper(record, rotation)
+			})
+
+			report, err := deviceService.VerifySignatureChain(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Valid || report.BrokenAt != rotation.SignatureCounter || !strings.HasPrefix(report.Reason, test.reason) {
+				t.Errorf("got %+v, want broken at %d: %s", *report, rotation.SignatureCounter, test.reason)
+			}
+		})
+	}
+}
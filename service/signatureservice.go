@@ -0,0 +1,274 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"signing-service/domain"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidSignData is returned when the data to be signed cannot be part of the signature chain
+var ErrInvalidSignData = errors.New("invalid data to be signed")
+
+// chainVerificationPageSize is the number of signature records read at once during chain verification
+const chainVerificationPageSize = 500
+
+// SignTransaction signs the data with the device key and advances the device
+// signature chain. Reading the counter and last signature, signing and storing the
+// new state happen in one transaction, so concurrent requests never share a counter.
+//
+// The signed data follows <signature_counter>_<data_to_be_signed>_<last_signature_base64_encoded>,
+// where the base64 encoded device id is used as last signature for the first signature.
+// A format of domain.FormatJWS or domain.FormatCOSE returns the signature record as compact
+// JWS or COSE_Sign1 message as well.
+func (s Service) SignTransaction(id string, data string, format string) (*SignatureResponse, error) {
+	s.log.Println(">> [deviceService][SignTransaction][Received]")
+
+	var signatureResponse SignatureResponse
+
+	_, err := s.queryer.AdvanceSignatureChain(id, func(deviceInfo *persistence.DeviceInfo) (*persistence.SignatureRecord, error) {
+		record, last_signature_base64_encoded, err := newSignatureRecord(deviceInfo, data)
+		if err != nil {
+			return nil, err
+		}
+
+		signatureResponse = SignatureResponse{
+			Signature:   record.Signature,
+			Signed_Data: record.SignedData,
+			Message:     "Data Signature Successfully",
+		}
+		if deviceInfo.Algorithm == "ECC" {
+			signatureResponse.SignatureFormat = deviceInfo.KeyParameters.SignatureFormat
+		}
+		if format == domain.FormatJWS {
+			signatureResponse.JWS, err = NewDeviceJWS(deviceInfo, JWSPayload{
+				SignatureCounter: record.SignatureCounter,
+				Data:             data,
+				LastSignature:    last_signature_base64_encoded,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if format == domain.FormatCOSE {
+			signatureResponse.COSE, err = NewDeviceCOSE(deviceInfo, signingCrypto.COSEPayload{
+				SignatureCounter: record.SignatureCounter,
+				Data:             data,
+				LastSignature:    last_signature_base64_encoded,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return record, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &signatureResponse, nil
+}
+
+// newSignatureRecord signs the next link of the device signature chain for the data. It returns
+// the record and the last signature embedded in its signed data.
+func newSignatureRecord(deviceInfo *persistence.DeviceInfo, data string) (*persistence.SignatureRecord, string, error) {
+	if err := checkDeviceActive(deviceInfo); err != nil {
+		return nil, "", err
+	}
+	if signingCrypto.IsKeyRotationData(data) {
+		return nil, "", fmt.Errorf("%w: data must not start with the key rotation prefix", ErrInvalidSignData)
+	}
+
+	return signChainLink(deviceInfo, data)
+}
+
+// signChainLink signs the next link of the device signature chain with the current device key
+func signChainLink(deviceInfo *persistence.DeviceInfo, data string) (*persistence.SignatureRecord, string, error) {
+	signatureCounter := deviceInfo.SignatureCounter + 1
+
+	last_signature_base64_encoded := deviceInfo.Last_Signature_Base64_Encoded
+	if last_signature_base64_encoded == "" {
+		//Use device id base64 as last signature device
+		last_signature_base64_encoded = base64.StdEncoding.EncodeToString([]byte(deviceInfo.Id))
+	}
+
+	signed_data := strconv.Itoa(signatureCounter) + "_" + data + "_" + last_signature_base64_encoded
+
+	signer, err := NewDeviceSigner(deviceInfo)
+	if err != nil {
+		return nil, "", err
+	}
+
+	signature_byte, err := signer.Sign([]byte(signed_data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &persistence.SignatureRecord{
+		DeviceId:         deviceInfo.Id,
+		SignatureCounter: signatureCounter,
+		SignedData:       signed_data,
+		Signature:        base64.StdEncoding.EncodeToString(signature_byte),
+		Timestamp:        time.Now().UTC(),
+	}, last_signature_base64_encoded, nil
+}
+
+// Get a page of the device signature history with signature counters in [from, to], a to of 0 has no upper bound
+func (s Service) ListSignatureRecords(id string, from int, to int, limit int) (*SignatureHistoryResponse, error) {
+	s.log.Println(">> [deviceService][ListSignatureRecords][Received]")
+	records, err := s.queryer.ListSignatureRecords(id, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	signatureHistoryResponse := SignatureHistoryResponse{
+		DeviceId:   id,
+		Signatures: records,
+	}
+	if len(records) == limit {
+		signatureHistoryResponse.NextFrom = records[len(records)-1].SignatureCounter + 1
+	}
+
+	return &signatureHistoryResponse, nil
+}
+
+// ExportSignatureRecords writes the device signature history with signature counters in
+// [from, to] as JSON Lines, one signature record per line. A to of 0 has no upper bound.
+func (s Service) ExportSignatureRecords(id string, from int, to int, w io.Writer) error {
+	s.log.Println(">> [deviceService][ExportSignatureRecords][Received]")
+
+	encoder := json.NewEncoder(w)
+	for {
+		records, err := s.queryer.ListSignatureRecords(id, from, to, chainVerificationPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+
+		if len(records) < chainVerificationPageSize {
+			return nil
+		}
+		from = records[len(records)-1].SignatureCounter + 1
+	}
+}
+
+// VerifySignatureChain walks the stored signature history of the device from counter 1,
+// or from the end of the chain of an imported device, and reports the first broken link:
+// a counter gap, signed data not embedding the previous signature, or a signature not
+// verifying with the device key version of its counter. The signature gaps recorded by
+// restoring a backup are not verified, they are listed as gaps of the report.
+func (s Service) VerifySignatureChain(id string) (*signingCrypto.ChainReport, error) {
+	s.log.Println(">> [deviceService][VerifySignatureChain][Received]")
+
+	deviceInfo, err := s.queryer.GetSignatureDeviceInfo(id)
+	if err != nil {
+		return nil, err
+	}
+
+	chainKeys, err := deviceChainKeys(deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	chainVerifier := signingCrypto.NewKeyedChainVerifier(deviceInfo.Id, chainKeys)
+	if deviceInfo.ImportedSignatureCounter > 0 {
+		chainVerifier.Continue(deviceInfo.ImportedSignatureCounter, deviceInfo.ImportedLastSignature)
+	}
+
+	gaps := deviceInfo.SignatureGaps
+	//skipGaps continues the chain after the signature gaps ending before the counter
+	skipGaps := func(signatureCounter int) error {
+		for len(gaps) > 0 && gaps[0].To < signatureCounter {
+			if err := chainVerifier.Skip(gaps[0].From, gaps[0].To, gaps[0].LastSignature); err != nil {
+				return err
+			}
+			gaps = gaps[1:]
+		}
+		return nil
+	}
+
+	for from := deviceInfo.ImportedSignatureCounter + 1; from <= deviceInfo.SignatureCounter; {
+		records, err := s.queryer.ListSignatureRecords(id, from, deviceInfo.SignatureCounter, chainVerificationPageSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			break
+		}
+
+		for _, record := range records {
+			link := signingCrypto.ChainLink{
+				SignatureCounter: record.SignatureCounter,
+				SignedData:       record.SignedData,
+				Signature:        record.Signature,
+			}
+			if skipGaps(record.SignatureCounter) != nil || chainVerifier.Next(link) != nil {
+				report := chainVerifier.Report()
+				return &report, nil
+			}
+		}
+
+		from = records[len(records)-1].SignatureCounter + 1
+	}
+
+	if skipGaps(deviceInfo.SignatureCounter+1) == nil {
+		chainVerifier.End(deviceInfo.SignatureCounter, deviceInfo.Last_Signature_Base64_Encoded)
+	}
+
+	report := chainVerifier.Report()
+	return &report, nil
+}
+
+// VerifySignature checks the signature of the signed data with the device key version
+// that signed the signature counter the data starts with
+func (s Service) VerifySignature(deviceInfo *persistence.DeviceInfo, signedData []byte, signature []byte) error {
+	s.log.Println(">> [deviceService][VerifySignature][Received]")
+
+	version := deviceKeyVersionForCounter(deviceInfo, signedDataCounter(string(signedData)))
+	verifier, err := NewDeviceKeyVerifier(deviceInfo, version)
+	if err != nil {
+		return err
+	}
+
+	return verifier.Verify(signedData, signature)
+}
+
+// NewDeviceSigner returns the signer matching the device algorithm
+func NewDeviceSigner(deviceInfo *persistence.DeviceInfo) (signingCrypto.Signer, error) {
+	params, err := DeviceSignatureParameters(deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDeviceSigner(deviceInfo, params)
+}
+
+func newDeviceSigner(deviceInfo *persistence.DeviceInfo, params signingCrypto.SignatureParameters) (signingCrypto.Signer, error) {
+	switch deviceInfo.Algorithm {
+	case "RSA":
+		return signingCrypto.NewRSASigner(deviceInfo.RSAKeyPair, params)
+	case "ECC":
+		return signingCrypto.NewECCSigner(deviceInfo.ECCKeyPair, params)
+	case "ED25519":
+		return signingCrypto.NewEd25519Signer(deviceInfo.Ed25519KeyPair)
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm %q", deviceInfo.Algorithm)
+	}
+}
+
+// NewDeviceVerifier returns the verifier of the current device key
+func NewDeviceVerifier(deviceInfo *persistence.DeviceInfo) (signingCrypto.Verifier, error) {
+	return NewDeviceKeyVerifier(deviceInfo, 0)
+}
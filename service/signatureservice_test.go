@@ -0,0 +1,452 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"signing-service/config"
+	"signing-service/persistence"
+	"signing-service/signingCrypto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+var testLogger = log.New(ioutil.Discard, "", 0)
+
+// TestMain opens the database of the package config.json, an in-memory database, seals
+// device keys with a random master key and creates the certificate authority
+func TestMain(m *testing.M) {
+	if err := persistence.OpenDB(config.Env.Database); err != nil {
+		log.Fatalf("Could not open database, Error: %v", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal(err)
+	}
+	masterKey, err := persistence.NewMasterKey(key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	persistence.Keys = persistence.NewKeyring(masterKey)
+
+	if err := LoadCertificateAuthority(config.Env.CertificateAuthority, testLogger); err != nil {
+		log.Fatalf("Could not load certificate authority, Error: %v", err)
+	}
+
+	code := m.Run()
+	persistence.CloseDB()
+	os.Exit(code)
+}
+
+// createTestDevice creates a device with a fresh key of the algorithm
+func createTestDevice(t *testing.T, id string, algorithm string) *Service {
+	t.Helper()
+
+	deviceService := NewService(testLogger)
+	if err := deviceService.CreateSignatureDevice(&persistence.DeviceInfo{Id: id, Algorithm: algorithm, Label: id}); err != nil {
+		t.Fatalf("CreateSignatureDevice: %v", err)
+	}
+	return deviceService
+}
+
+func TestSignTransactionConcurrent(t *testing.T) {
+	const signers = 64
+	id := "concurrent-device"
+	deviceService := createTestDevice(t, id, "RSA")
+
+	var wg sync.WaitGroup
+	responses := make([]*SignatureResponse, signers)
+	errs := make(chan error, signers)
+	for i := 0; i < signers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			//Every goroutine uses its own service, like concurrent requests do
+			response, err := NewService(testLogger).SignTransaction(id, fmt.Sprintf("transaction-%d", i), "")
+			if err != nil {
+				errs <- err
+				return
+			}
+			responses[i] = response
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("SignTransaction: %v", err)
+	}
+
+	//Every counter is used exactly once
+	byCounter := make([]*SignatureResponse, signers+1)
+	for _, response := range responses {
+		counter, err := strconv.Atoi(strings.SplitN(response.Signed_Data, "_", 2)[0])
+		if err != nil || counter < 1 || counter > signers {
+			t.Fatalf("signed data %q has no counter in 1..%d", response.Signed_Data, signers)
+		}
+		if byCounter[counter] != nil {
+			t.Fatalf("signature counter %d used twice", counter)
+		}
+		byCounter[counter] = response
+	}
+
+	deviceInfo, err := deviceService.GetSignatureDeviceInfo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousSignature := base64.StdEncoding.EncodeToString([]byte(id))
+	for counter := 1; counter <= signers; counter++ {
+		response := byCounter[counter]
+		if !strings.HasSuffix(response.Signed_Data, "_"+previousSignature) {
+			t.Errorf("signature %d does not embed the signature of %d", counter, counter-1)
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(response.Signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := deviceService.VerifySignature(deviceInfo, []byte(response.Signed_Data), signature); err != nil {
+			t.Errorf("signature %d: %v", counter, err)
+		}
+		previousSignature = response.Signature
+	}
+
+	if deviceInfo.SignatureCounter != signers || deviceInfo.Last_Signature_Base64_Encoded != previousSignature {
+		t.Errorf("device is at signature %d, want %d with the last signature", deviceInfo.SignatureCounter, signers)
+	}
+}
+
+// appendSignatureRecords stores count further records in the chain of the device, without
+// signing them
+func appendSignatureRecords(t *testing.T, id string, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		_, err := persistence.New(testLogger).AdvanceSignatureChain(id, func(deviceInfo *persistence.DeviceInfo) (*persistence.SignatureRecord, error) {
+			counter := deviceInfo.SignatureCounter + 1
+			return &persistence.SignatureRecord{
+				DeviceId:         id,
+				SignatureCounter: counter,
+				SignedData:       fmt.Sprintf("%d_data", counter),
+				Signature:        fmt.Sprintf("signature-%d", counter),
+			}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestListSignatureRecordsNextFrom(t *testing.T) {
+	id := "history-device"
+	deviceService := createTestDevice(t, id, "ED25519")
+	appendSignatureRecords(t, id, 5)
+
+	tests := []struct {
+		name     string
+		from     int
+		to       int
+		limit    int
+		want     []int
+		nextFrom int
+	}{
+		{"first page", 1, 0, 2, []int{1, 2}, 3},
+		{"next page", 3, 0, 2, []int{3, 4}, 5},
+		{"last page", 5, 0, 2, []int{5}, 0},
+		//A full page cannot tell that the history ends, the following page is empty
+		{"full last page", 4, 0, 2, []int{4, 5}, 6},
+		{"after the last page", 6, 0, 2, []int{}, 0},
+		{"page of a range", 2, 3, 2, []int{2, 3}, 4},
+		{"range shorter than the page", 2, 3, 10, []int{2, 3}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history, err := deviceService.ListSignatureRecords(id, test.from, test.to, test.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			counters := []int{}
+			for _, record := range history.Signatures {
+				counters = append(counters, record.SignatureCounter)
+			}
+			if fmt.Sprint(counters) != fmt.Sprint(test.want) || history.NextFrom != test.nextFrom {
+				t.Errorf("got %v next from %d, want %v next from %d", counters, history.NextFrom, test.want, test.nextFrom)
+			}
+		})
+	}
+}
+
+// TestExportSignatureRecords exports histories longer than a page of the store as JSON Lines
+func TestExportSignatureRecords(t *testing.T) {
+	id := "export-device"
+	deviceService := createTestDevice(t, id, "ED25519")
+	count := 2*chainVerificationPageSize + 1
+	appendSignatureRecords(t, id, count)
+
+	tests := []struct {
+		name  string
+		from  int
+		to    int
+		first int
+		last  int
+	}{
+		{"whole history", 1, 0, 1, count},
+		{"range across a page", chainVerificationPageSize, chainVerificationPageSize + 1, chainVerificationPageSize, chainVerificationPageSize + 1},
+		{"range ending with a page", 1, chainVerificationPageSize, 1, chainVerificationPageSize},
+		{"last record", count, 0, count, count},
+		{"to beyond the chain", count - 1, count + 10, count - 1, count},
+		{"empty range", count + 1, 0, 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var export bytes.Buffer
+			if err := deviceService.ExportSignatureRecords(id, test.from, test.to, &export); err != nil {
+				t.Fatal(err)
+			}
+
+			var lines []string
+			if export.Len() > 0 {
+				lines = strings.Split(strings.TrimSuffix(export.String(), "\n"), "\n")
+			}
+			want := 0
+			if test.last > 0 {
+				want = test.last - test.first + 1
+			}
+			if len(lines) != want {
+				t.Fatalf("exported %d lines, want %d", len(lines), want)
+			}
+
+			for i, line := range lines {
+				var record persistence.SignatureRecord
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatalf("line %d: %v", i+1, err)
+				}
+				if record.DeviceId != id || record.SignatureCounter != test.first+i || record.Signature != fmt.Sprintf("signature-%d", test.first+i) {
+					t.Fatalf("line %d is %+v, want signature %d", i+1, record, test.first+i)
+				}
+			}
+		})
+	}
+
+	if err := deviceService.ExportSignatureRecords("missing-device", 1, 0, ioutil.Discard); !errors.Is(err, persistence.ErrDeviceNotFound) {
+		t.Errorf("export of a missing device: %v, want %v", err, persistence.ErrDeviceNotFound)
+	}
+}
+
+// storedSignatureKey is the store key of a signature record, see persistence.signatureKey
+func storedSignatureKey(id string, counter int) []byte {
+	return []byte(fmt.Sprintf("signature/%s/%020d", id, counter))
+}
+
+// tamperSignatureRecord changes the stored signature record of the counter in place
+func tamperSignatureRecord(t *testing.T, id string, counter int, tamper func(record *persistence.SignatureRecord)) {
+	t.Helper()
+
+	err := persistence.DBConn.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(storedSignatureKey(id, counter))
+		if err != nil {
+			return err
+		}
+
+		var record persistence.SignatureRecord
+		if err := item.Value(func(v []byte) error {
+			return json.Unmarshal(v, &record)
+		}); err != nil {
+			return err
+		}
+		tamper(&record)
+
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return txn.Set(storedSignatureKey(id, counter), value)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dropSignatureRecord deletes the stored signature record of the counter
+func dropSignatureRecord(t *testing.T, id string, counter int) {
+	t.Helper()
+
+	err := persistence.DBConn.Update(func(txn *badger.Txn) error {
+		return txn.Delete(storedSignatureKey(id, counter))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestVerifySignatureChainFailures breaks the stored history of a device in different ways
+// and checks the first failing counter and reason of the report
+func TestVerifySignatureChainFailures(t *testing.T) {
+	const signatures = 5
+
+	tests := []struct {
+		name     string
+		breakAt  func(t *testing.T, id string)
+		brokenAt int
+		reason   string
+	}{
+		{
+			name:     "tampered data",
+			brokenAt: 3,
+			reason:   signingCrypto.ErrInvalidSignature.Error(),
+			breakAt: func(t *testing.T, id string) {
+				tamperSignatureRecord(t, id, 3, func(record *persistence.SignatureRecord) {
+					record.SignedData = strings.Replace(record.SignedData, "transaction-3", "transaction-X", 1)
+				})
+			},
+		},
+		{
+			name:     "tampered signature",
+			brokenAt: 2,
+			reason:   signingCrypto.ErrInvalidSignature.Error(),
+			breakAt: func(t *testing.T, id string) {
+				tamperSignatureRecord(t, id, 2, func(record *persistence.SignatureRecord) {
+					signature, _ := base64.StdEncoding.DecodeString(record.Signature)
+					signature[0] ^= 0xff
+					record.Signature = base64.StdEncoding.EncodeToString(signature)
+				})
+			},
+		},
+		{
+			name:     "broken link",
+			brokenAt: 4,
+			reason:   "signed data does not embed the previous signature",
+			breakAt: func(t *testing.T, id string) {
+				tamperSignatureRecord(t, id, 4, func(record *persistence.SignatureRecord) {
+					record.SignedData = "4_transaction-4_" + base64.StdEncoding.EncodeToString([]byte(id))
+				})
+			},
+		},
+		{
+			name:     "dropped counter",
+			brokenAt: 3,
+			reason:   "expected signature counter 3, found 4",
+			breakAt: func(t *testing.T, id string) {
+				dropSignatureRecord(t, id, 3)
+			},
+		},
+		{
+			name:     "dropped first counter",
+			brokenAt: 1,
+			reason:   "expected signature counter 1, found 2",
+			breakAt: func(t *testing.T, id string) {
+				dropSignatureRecord(t, id, 1)
+			},
+		},
+		{
+			name:     "dropped last counter",
+			brokenAt: 5,
+			reason:   "chain ends at signature 4, expected 5",
+			breakAt: func(t *testing.T, id string) {
+				dropSignatureRecord(t, id, 5)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := "broken-chain-" + strings.ReplaceAll(test.name, " ", "-")
+			deviceService := createTestDevice(t, id, "ED25519")
+			for i := 1; i <= signatures; i++ {
+				if _, err := deviceService.SignTransaction(id, fmt.Sprintf("transaction-%d", i), ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			report, err := deviceService.VerifySignatureChain(id)
+			if err != nil || !report.Valid || report.VerifiedSignatures != signatures {
+				t.Fatalf("chain before breaking it: %+v, %v", report, err)
+			}
+
+			test.breakAt(t, id)
+
+			report, err = deviceService.VerifySignatureChain(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Valid || report.BrokenAt != test.brokenAt || report.Reason != test.reason {
+				t.Errorf("got %+v, want broken at %d: %s", *report, test.brokenAt, test.reason)
+			}
+			if report.VerifiedSignatures != test.brokenAt-1 {
+				t.Errorf("verified %d signatures before signature %d", report.VerifiedSignatures, test.brokenAt)
+			}
+		})
+	}
+}
+
+func TestSignTransactionEd25519(t *testing.T) {
+	id := "ed25519-device"
+	deviceService := createTestDevice(t, id, "ED25519")
+
+	var responses []*SignatureResponse
+	for _, data := range []string{"first transaction", "second transaction"} {
+		response, err := deviceService.SignTransaction(id, data, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, response)
+	}
+
+	deviceInfo, err := deviceService.GetSignatureDeviceInfo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deviceInfo.Algorithm != "ED25519" || deviceInfo.Ed25519KeyPair.Private == nil {
+		t.Fatalf("device is %s without an Ed25519 key", deviceInfo.Algorithm)
+	}
+
+	publicKey, err := deviceService.GetPublicKey(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedKey, err := signingCrypto.ParsePublicKey([]byte(publicKey.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deviceInfo.Ed25519KeyPair.Public.Equal(parsedKey) || publicKey.JWK.Alg != "EdDSA" {
+		t.Errorf("public key %s with JWK alg %s is not the Ed25519 device key", publicKey.PublicKey, publicKey.JWK.Alg)
+	}
+
+	for i, response := range responses {
+		signature, err := base64.StdEncoding.DecodeString(response.Signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(signature) != ed25519.SignatureSize {
+			t.Errorf("signature %d has %d bytes", i+1, len(signature))
+		}
+		if err := deviceService.VerifySignature(deviceInfo, []byte(response.Signed_Data), signature); err != nil {
+			t.Errorf("signature %d: %v", i+1, err)
+		}
+		//Ed25519 signs the data itself, any change of it is rejected
+		tampered := strings.Replace(response.Signed_Data, "transaction", "Transaction", 1)
+		if err := deviceService.VerifySignature(deviceInfo, []byte(tampered), signature); !errors.Is(err, signingCrypto.ErrInvalidSignature) {
+			t.Errorf("tampered signature %d: %v, want %v", i+1, err, signingCrypto.ErrInvalidSignature)
+		}
+	}
+
+	report, err := deviceService.VerifySignatureChain(id)
+	if err != nil || !report.Valid || report.VerifiedSignatures != 2 {
+		t.Errorf("chain of the Ed25519 device: %+v, %v", report, err)
+	}
+}
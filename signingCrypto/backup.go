@@ -0,0 +1,251 @@
+package signingCrypto
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// BackupVersion is the version of the backup envelope format
+const BackupVersion = 1
+
+// BackupPasswordIterations is the PBKDF2-HMAC-SHA256 iteration count of password encrypted backups
+const BackupPasswordIterations = 600000
+
+// Encryption algorithms of backup envelopes
+const (
+	BackupPasswordPBKDF2 = "PBKDF2-HMAC-SHA256"
+	BackupRecipientRSA   = "RSA-OAEP-SHA256"
+	BackupRecipientECDH  = "ECDH-ES-SHA256"
+)
+
+// backupLabel binds the key encryption of an envelope to backups of this service
+var backupLabel = []byte("signing-service backup")
+
+// ErrBackupDecryption is returned when a backup cannot be decrypted with the given password or key
+var ErrBackupDecryption = errors.New("backup cannot be decrypted")
+
+// BackupEnvelope is an AES-256-GCM encrypted backup. The content key is derived from a
+// password or encrypted for the public key of a recipient. The device id and creation
+// time are readable without decrypting, they are authenticated as associated data.
+type BackupEnvelope struct {
+	Version    int              `json:"version"`
+	DeviceId   string           `json:"device_id"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Password   *BackupPassword  `json:"password,omitempty"`
+	Recipient  *BackupRecipient `json:"recipient,omitempty"`
+	Nonce      []byte           `json:"nonce"`
+	Ciphertext []byte           `json:"ciphertext"`
+}
+
+// BackupPassword are the key derivation parameters of a password encrypted backup
+type BackupPassword struct {
+	Algorithm  string `json:"algorithm"`
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+}
+
+// BackupRecipient names the public key a backup is encrypted for. RSA keys encrypt the
+// content key with OAEP, EC keys derive it from an ECDH agreement with an ephemeral key.
+type BackupRecipient struct {
+	Algorithm            string `json:"algorithm"`
+	PublicKeyFingerprint string `json:"public_key_fingerprint"`
+	EncryptedKey         []byte `json:"encrypted_key,omitempty"`
+	EphemeralPublicKey   []byte `json:"ephemeral_public_key,omitempty"`
+}
+
+// EncryptBackupWithPassword encrypts the backup of a device with a key derived from the password.
+func EncryptBackupWithPassword(deviceId string, plaintext []byte, password []byte) (*BackupEnvelope, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	envelope := newBackupEnvelope(deviceId)
+	envelope.Password = &BackupPassword{
+		Algorithm:  BackupPasswordPBKDF2,
+		Salt:       salt,
+		Iterations: BackupPasswordIterations,
+	}
+
+	return envelope, envelope.seal(pbkdf2(password, salt, BackupPasswordIterations, 32, sha256.New), plaintext)
+}
+
+// EncryptBackupForRecipient encrypts the backup of a device for the holder of the private key
+// of the RSA or EC public key.
+func EncryptBackupForRecipient(deviceId string, plaintext []byte, publicKey crypto.PublicKey) (*BackupEnvelope, error) {
+	fingerprint, err := Fingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := newBackupEnvelope(deviceId)
+	envelope.Recipient = &BackupRecipient{PublicKeyFingerprint: fingerprint}
+
+	var key []byte
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		key = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		envelope.Recipient.Algorithm = BackupRecipientRSA
+		envelope.Recipient.EncryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, backupLabel)
+		if err != nil {
+			return nil, err
+		}
+	case *ecdsa.PublicKey:
+		ephemeral, err := ecdsa.GenerateKey(pub.Curve, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		envelope.Recipient.Algorithm = BackupRecipientECDH
+		envelope.Recipient.EphemeralPublicKey, err = x509.MarshalPKIXPublicKey(&ephemeral.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		key = ecdhBackupKey(ephemeral, pub, envelope.Recipient.EphemeralPublicKey)
+	default:
+		return nil, fmt.Errorf("unsupported backup recipient key type %T, RSA or EC keys are required", publicKey)
+	}
+
+	return envelope, envelope.seal(key, plaintext)
+}
+
+// DecryptWithPassword returns the plaintext of a password encrypted backup.
+func (e *BackupEnvelope) DecryptWithPassword(password []byte) ([]byte, error) {
+	if e.Password == nil {
+		return nil, errors.New("backup is not password encrypted")
+	}
+	if e.Password.Algorithm != BackupPasswordPBKDF2 {
+		return nil, fmt.Errorf("unsupported backup key derivation %q", e.Password.Algorithm)
+	}
+	if e.Password.Iterations < 1 || e.Password.Iterations > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("unsupported PBKDF2 iteration count %d", e.Password.Iterations)
+	}
+
+	return e.open(pbkdf2(password, e.Password.Salt, e.Password.Iterations, 32, sha256.New))
+}
+
+// DecryptWithKey returns the plaintext of a backup encrypted for the public key of the private key.
+func (e *BackupEnvelope) DecryptWithKey(privateKey crypto.Signer) ([]byte, error) {
+	if e.Recipient == nil {
+		return nil, errors.New("backup is not encrypted for a recipient key")
+	}
+
+	fingerprint, err := Fingerprint(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	if fingerprint != e.Recipient.PublicKeyFingerprint {
+		return nil, fmt.Errorf("%w: backup is encrypted for key %s, not %s", ErrBackupDecryption, e.Recipient.PublicKeyFingerprint, fingerprint)
+	}
+
+	var key []byte
+	switch priv := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if e.Recipient.Algorithm != BackupRecipientRSA {
+			return nil, fmt.Errorf("backup algorithm %q does not match the RSA key", e.Recipient.Algorithm)
+		}
+		key, err = rsa.DecryptOAEP(sha256.New(), nil, priv, e.Recipient.EncryptedKey, backupLabel)
+		if err != nil {
+			return nil, ErrBackupDecryption
+		}
+	case *ecdsa.PrivateKey:
+		if e.Recipient.Algorithm != BackupRecipientECDH {
+			return nil, fmt.Errorf("backup algorithm %q does not match the EC key", e.Recipient.Algorithm)
+		}
+		parsed, err := x509.ParsePKIXPublicKey(e.Recipient.EphemeralPublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("malformed ephemeral public key: %v", err)
+		}
+		ephemeral, ok := parsed.(*ecdsa.PublicKey)
+		if !ok || ephemeral.Curve != priv.Curve {
+			return nil, errors.New("ephemeral public key is not on the curve of the key")
+		}
+		key = ecdhBackupKey(priv, ephemeral, e.Recipient.EphemeralPublicKey)
+	default:
+		return nil, fmt.Errorf("unsupported backup recipient key type %T, RSA or EC keys are required", privateKey)
+	}
+
+	return e.open(key)
+}
+
+func newBackupEnvelope(deviceId string) *BackupEnvelope {
+	return &BackupEnvelope{
+		Version:   BackupVersion,
+		DeviceId:  deviceId,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// additionalData authenticates the readable fields of the envelope
+func (e *BackupEnvelope) additionalData() []byte {
+	return []byte(fmt.Sprintf("%s:%d:%s:%s", backupLabel, e.Version, e.DeviceId, e.CreatedAt.UTC().Format(time.RFC3339)))
+}
+
+func (e *BackupEnvelope) seal(key []byte, plaintext []byte) error {
+	aead, err := newBackupAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	e.Nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, e.Nonce); err != nil {
+		return err
+	}
+	e.Ciphertext = aead.Seal(nil, e.Nonce, plaintext, e.additionalData())
+	return nil
+}
+
+func (e *BackupEnvelope) open(key []byte) ([]byte, error) {
+	if e.Version != BackupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", e.Version)
+	}
+
+	aead, err := newBackupAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Nonce) != aead.NonceSize() {
+		return nil, errors.New("malformed backup nonce")
+	}
+
+	plaintext, err := aead.Open(nil, e.Nonce, e.Ciphertext, e.additionalData())
+	if err != nil {
+		return nil, ErrBackupDecryption
+	}
+	return plaintext, nil
+}
+
+func newBackupAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// ecdhBackupKey derives the content key SHA-256(Z || label || ephemeral public key) from the
+// ECDH shared secret Z of the private and public key
+func ecdhBackupKey(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, ephemeralPublicKey []byte) []byte {
+	x, _ := privateKey.Curve.ScalarMult(publicKey.X, publicKey.Y, privateKey.D.Bytes())
+	shared := make([]byte, (privateKey.Curve.Params().BitSize+7)/8)
+	x.FillBytes(shared)
+
+	digest := sha256.New()
+	digest.Write(shared)
+	digest.Write(backupLabel)
+	digest.Write(ephemeralPublicKey)
+	return digest.Sum(nil)
+}
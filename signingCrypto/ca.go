@@ -0,0 +1,158 @@
+package signingCrypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// CertificateAuthority issues device certificates and CRLs with an intermediate CA key
+// certified by a root CA. Verifiers only need to trust the root.
+type CertificateAuthority struct {
+	Root         *x509.Certificate
+	Intermediate *x509.Certificate
+	signer       crypto.Signer
+}
+
+// NewCertificateAuthority creates a CertificateAuthority issuing with the intermediate key.
+// The intermediate certificate must be issued by the root and match the key.
+func NewCertificateAuthority(root *x509.Certificate, intermediate *x509.Certificate, intermediateKey crypto.Signer) (*CertificateAuthority, error) {
+	if err := intermediate.CheckSignatureFrom(root); err != nil {
+		return nil, fmt.Errorf("ca: intermediate certificate is not issued by the root: %v", err)
+	}
+
+	keyFingerprint, err := Fingerprint(intermediateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	certificateFingerprint, err := Fingerprint(intermediate.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if keyFingerprint != certificateFingerprint {
+		return nil, errors.New("ca: intermediate key does not match the intermediate certificate")
+	}
+
+	return &CertificateAuthority{
+		Root:         root,
+		Intermediate: intermediate,
+		signer:       intermediateKey,
+	}, nil
+}
+
+// NewRootCertificate creates a self-signed root CA certificate for the key.
+func NewRootCertificate(key crypto.Signer, subject pkix.Name, notBefore time.Time, notAfter time.Time) (*x509.Certificate, error) {
+	template, err := caTemplate(subject, notBefore, notAfter, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return createCertificate(template, template, key.Public(), key)
+}
+
+// NewIntermediateCertificate certifies the intermediate CA public key with the root CA key.
+// The intermediate may only issue end-entity certificates.
+func NewIntermediateCertificate(root *x509.Certificate, rootKey crypto.Signer, publicKey crypto.PublicKey, subject pkix.Name, notBefore time.Time, notAfter time.Time) (*x509.Certificate, error) {
+	template, err := caTemplate(subject, notBefore, notAfter, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return createCertificate(template, root, publicKey, rootKey)
+}
+
+// IssueCertificate issues an end-entity signing certificate for the public key. The
+// extensions are added to the certificate as they are.
+func (ca *CertificateAuthority) IssueCertificate(publicKey crypto.PublicKey, subject pkix.Name, extensions []pkix.Extension, notBefore time.Time, notAfter time.Time) (*x509.Certificate, error) {
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		BasicConstraintsValid: true,
+		ExtraExtensions:       extensions,
+	}
+
+	return createCertificate(template, ca.Intermediate, publicKey, ca.signer)
+}
+
+// Chain returns the CA certificates above an issued certificate, intermediate first.
+func (ca *CertificateAuthority) Chain() []*x509.Certificate {
+	return []*x509.Certificate{ca.Intermediate, ca.Root}
+}
+
+// Verify checks that the certificate was issued by the CA and is valid at the given time.
+func (ca *CertificateAuthority) Verify(certificate *x509.Certificate, at time.Time) error {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(ca.Intermediate)
+
+	_, err := certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
+
+// CreateCRL returns the DER encoded CRL of the certificates issued by the intermediate.
+func (ca *CertificateAuthority) CreateCRL(revoked []pkix.RevokedCertificate, number *big.Int, thisUpdate time.Time, nextUpdate time.Time) ([]byte, error) {
+	return x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificates: revoked,
+		Number:              number,
+		ThisUpdate:          thisUpdate,
+		NextUpdate:          nextUpdate,
+	}, ca.Intermediate, ca.signer)
+}
+
+// caTemplate returns the template of a CA certificate allowing maxPathLen CAs below it.
+func caTemplate(subject pkix.Name, notBefore time.Time, notAfter time.Time, maxPathLen int) (*x509.Certificate, error) {
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	return &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            maxPathLen,
+		MaxPathLenZero:        maxPathLen == 0,
+	}, nil
+}
+
+func createCertificate(template *x509.Certificate, parent *x509.Certificate, publicKey crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+// newSerialNumber returns a random positive 128 bit serial number.
+func newSerialNumber() (*big.Int, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	return serialNumber.Add(serialNumber, big.NewInt(1)), nil
+}
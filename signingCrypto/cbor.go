@@ -0,0 +1,221 @@
+package signingCrypto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The minimal CBOR (RFC 8949) subset needed for COSE: integers, byte and text
+// strings, arrays, maps and tags, all of definite length. Encoding follows the
+// core deterministic rules of section 4.2.1 (shortest heads), map entries are
+// written in the order given.
+
+const (
+	cborUnsigned byte = 0
+	cborNegative byte = 1
+	cborBytes    byte = 2
+	cborText     byte = 3
+	cborArray    byte = 4
+	cborMap      byte = 5
+	cborTag      byte = 6
+)
+
+// cborMaxDepth bounds the nesting of decoded items.
+const cborMaxDepth = 16
+
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+// cborPair is a map entry in the order it was encoded.
+type cborPair struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// cborTagged is a tagged item.
+type cborTagged struct {
+	Number  uint64
+	Content interface{}
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= math.MaxUint8:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= math.MaxUint16:
+		head := []byte{major<<5 | 25, 0, 0}
+		binary.BigEndian.PutUint16(head[1:], uint16(n))
+		return head
+	case n <= math.MaxUint32:
+		head := []byte{major<<5 | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(head[1:], uint32(n))
+		return head
+	default:
+		head := []byte{major<<5 | 27, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(head[1:], n)
+		return head
+	}
+}
+
+func cborEncodeInt(v int64) []byte {
+	if v < 0 {
+		return cborHead(cborNegative, uint64(-(v + 1)))
+	}
+	return cborHead(cborUnsigned, uint64(v))
+}
+
+func cborEncodeBytes(b []byte) []byte {
+	return append(cborHead(cborBytes, uint64(len(b))), b...)
+}
+
+func cborEncodeText(s string) []byte {
+	return append(cborHead(cborText, uint64(len(s))), s...)
+}
+
+func cborEncodeArray(items ...[]byte) []byte {
+	encoded := cborHead(cborArray, uint64(len(items)))
+	for _, item := range items {
+		encoded = append(encoded, item...)
+	}
+	return encoded
+}
+
+// cborEncodeMap encodes the encoded keys and values given in alternating order.
+func cborEncodeMap(keysAndValues ...[]byte) []byte {
+	encoded := cborHead(cborMap, uint64(len(keysAndValues)/2))
+	for _, item := range keysAndValues {
+		encoded = append(encoded, item...)
+	}
+	return encoded
+}
+
+func cborEncodeTag(number uint64, item []byte) []byte {
+	return append(cborHead(cborTag, number), item...)
+}
+
+// cborDecode decodes a single CBOR item that must span all of data. Integers are
+// returned as int64, byte strings as []byte, text strings as string, arrays as
+// []interface{}, maps as []cborPair and tags as cborTagged.
+func cborDecode(data []byte) (interface{}, error) {
+	item, rest, err := cborDecodeItem(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("cbor: trailing data")
+	}
+
+	return item, nil
+}
+
+func cborDecodeItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, errors.New("cbor: nesting too deep")
+	}
+
+	major, n, data, err := cborDecodeHead(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		if n > math.MaxInt64 {
+			return nil, nil, errors.New("cbor: integer overflow")
+		}
+		return int64(n), data, nil
+	case cborNegative:
+		if n > math.MaxInt64 {
+			return nil, nil, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(n), data, nil
+	case cborBytes, cborText:
+		if n > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+		if major == cborText {
+			return string(data[:n]), data[n:], nil
+		}
+		return append([]byte(nil), data[:n]...), data[n:], nil
+	case cborArray:
+		// every item takes at least one byte
+		if n > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+		items := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var item interface{}
+			item, data, err = cborDecodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+	case cborMap:
+		if n > uint64(len(data))/2 {
+			return nil, nil, errCBORTruncated
+		}
+		pairs := make([]cborPair, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var pair cborPair
+			pair.Key, data, err = cborDecodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			pair.Value, data, err = cborDecodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			pairs = append(pairs, pair)
+		}
+		return pairs, data, nil
+	case cborTag:
+		content, data, err := cborDecodeItem(data, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cborTagged{Number: n, Content: content}, data, nil
+	default:
+		return nil, nil, fmt.Errorf("cbor: unsupported major type %d", major)
+	}
+}
+
+func cborDecodeHead(data []byte) (byte, uint64, []byte, error) {
+	if len(data) == 0 {
+		return 0, 0, nil, errCBORTruncated
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), data, nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, nil, errors.New("cbor: indefinite length items are not supported")
+	}
+
+	if len(data) < size {
+		return 0, 0, nil, errCBORTruncated
+	}
+
+	var n uint64
+	for _, b := range data[:size] {
+		n = n<<8 | uint64(b)
+	}
+
+	return major, n, data[size:], nil
+}
@@ -0,0 +1,256 @@
+package signingCrypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatalf("invalid hex %q", s)
+	}
+	return b
+}
+
+// TestCBORInt checks the integer examples of RFC 8949 appendix A and the boundaries of
+// the head sizes
+func TestCBORInt(t *testing.T) {
+	tests := []struct {
+		value   int64
+		encoded string
+	}{
+		{0, "00"},
+		{1, "01"},
+		{10, "0a"},
+		{23, "17"},
+		{24, "18 18"},
+		{25, "18 19"},
+		{100, "18 64"},
+		{255, "18 ff"},
+		{256, "19 0100"},
+		{1000, "19 03e8"},
+		{65535, "19 ffff"},
+		{65536, "1a 00010000"},
+		{1000000, "1a 000f4240"},
+		{4294967295, "1a ffffffff"},
+		{4294967296, "1b 0000000100000000"},
+		{math.MaxInt64, "1b 7fffffffffffffff"},
+		{-1, "20"},
+		{-10, "29"},
+		{-24, "37"},
+		{-25, "38 18"},
+		{-100, "38 63"},
+		{-256, "38 ff"},
+		{-257, "39 0100"},
+		{-1000, "39 03e7"},
+		{-65536, "39 ffff"},
+		{-65537, "3a 00010000"},
+		{math.MinInt64, "3b 7fffffffffffffff"},
+	}
+
+	for _, test := range tests {
+		want := decodeHex(t, test.encoded)
+		encoded := cborEncodeInt(test.value)
+		if !bytes.Equal(encoded, want) {
+			t.Errorf("cborEncodeInt(%d) = %x, want %x", test.value, encoded, want)
+		}
+
+		decoded, err := cborDecode(encoded)
+		if err != nil {
+			t.Errorf("cborDecode(%x): %v", encoded, err)
+		} else if decoded != test.value {
+			t.Errorf("cborDecode(%x) = %v, want %d", encoded, decoded, test.value)
+		}
+	}
+}
+
+// TestCBORStrings round-trips byte and text strings with lengths on both sides of the head
+// size boundaries
+func TestCBORStrings(t *testing.T) {
+	tests := []struct {
+		length int
+		head   string
+	}{
+		{0, "40"},
+		{23, "57"},
+		{24, "58 18"},
+		{255, "58 ff"},
+		{256, "59 0100"},
+		{65535, "59 ffff"},
+		{65536, "5a 00010000"},
+	}
+
+	for _, test := range tests {
+		value := bytes.Repeat([]byte{'a'}, test.length)
+
+		head := decodeHex(t, test.head)
+		encoded := cborEncodeBytes(value)
+		if !bytes.HasPrefix(encoded, head) || len(encoded) != len(head)+test.length {
+			t.Errorf("byte string of %d bytes starts with %x, want %x", test.length, encoded[:len(head)], head)
+		}
+		decoded, err := cborDecode(encoded)
+		if err != nil || !bytes.Equal(decoded.([]byte), value) {
+			t.Errorf("byte string of %d bytes does not round-trip: %v", test.length, err)
+		}
+
+		//Text strings have major type 3, the head differs in the top three bits
+		head[0] |= cborText << 5
+		encoded = cborEncodeText(string(value))
+		if !bytes.HasPrefix(encoded, head) || len(encoded) != len(head)+test.length {
+			t.Errorf("text string of %d bytes starts with %x, want %x", test.length, encoded[:len(head)], head)
+		}
+		decoded, err = cborDecode(encoded)
+		if err != nil || decoded.(string) != string(value) {
+			t.Errorf("text string of %d bytes does not round-trip: %v", test.length, err)
+		}
+	}
+}
+
+// TestCBORItems checks the array, map and tag examples of RFC 8949 appendix A
+func TestCBORItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded []byte
+		want    string
+		decoded interface{}
+	}{
+		{
+			name:    `""`,
+			encoded: cborEncodeText(""),
+			want:    "60",
+			decoded: "",
+		},
+		{
+			name:    `"IETF"`,
+			encoded: cborEncodeText("IETF"),
+			want:    "64 49455446",
+			decoded: "IETF",
+		},
+		{
+			name:    "h'01020304'",
+			encoded: cborEncodeBytes([]byte{1, 2, 3, 4}),
+			want:    "44 01020304",
+			decoded: []byte{1, 2, 3, 4},
+		},
+		{
+			name:    "[]",
+			encoded: cborEncodeArray(),
+			want:    "80",
+			decoded: []interface{}{},
+		},
+		{
+			name: "[1, [2, 3], [4, 5]]",
+			encoded: cborEncodeArray(
+				cborEncodeInt(1),
+				cborEncodeArray(cborEncodeInt(2), cborEncodeInt(3)),
+				cborEncodeArray(cborEncodeInt(4), cborEncodeInt(5)),
+			),
+			want:    "83 01 82 02 03 82 04 05",
+			decoded: []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}},
+		},
+		{
+			name:    "{1: 2, 3: 4}",
+			encoded: cborEncodeMap(cborEncodeInt(1), cborEncodeInt(2), cborEncodeInt(3), cborEncodeInt(4)),
+			want:    "a2 01 02 03 04",
+			decoded: []cborPair{{int64(1), int64(2)}, {int64(3), int64(4)}},
+		},
+		{
+			name:    `{"a": 1, "b": [2, 3]}`,
+			encoded: cborEncodeMap(cborEncodeText("a"), cborEncodeInt(1), cborEncodeText("b"), cborEncodeArray(cborEncodeInt(2), cborEncodeInt(3))),
+			want:    "a2 61 61 01 61 62 82 02 03",
+			decoded: []cborPair{{"a", int64(1)}, {"b", []interface{}{int64(2), int64(3)}}},
+		},
+		{
+			name:    "1(1363896240)",
+			encoded: cborEncodeTag(1, cborEncodeInt(1363896240)),
+			want:    "c1 1a 514b67b0",
+			decoded: cborTagged{Number: 1, Content: int64(1363896240)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if want := decodeHex(t, test.want); !bytes.Equal(test.encoded, want) {
+				t.Errorf("encoded %x, want %x", test.encoded, want)
+			}
+
+			decoded, err := cborDecode(test.encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, test.decoded) {
+				t.Errorf("decoded %#v, want %#v", decoded, test.decoded)
+			}
+		})
+	}
+}
+
+func TestCBORArrayLengths(t *testing.T) {
+	for _, length := range []int{23, 24, 255, 256} {
+		items := make([][]byte, length)
+		for i := range items {
+			items[i] = cborEncodeInt(int64(i))
+		}
+
+		decoded, err := cborDecode(cborEncodeArray(items...))
+		if err != nil {
+			t.Fatalf("array of %d items: %v", length, err)
+		}
+		if array := decoded.([]interface{}); len(array) != length || array[length-1] != int64(length-1) {
+			t.Errorf("array of %d items does not round-trip", length)
+		}
+	}
+}
+
+func TestCBORDecodeRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"empty", ""},
+		{"truncated one byte head", "18"},
+		{"truncated two byte head", "19 01"},
+		{"truncated eight byte head", "1b 00000000"},
+		{"truncated byte string", "43 0102"},
+		{"truncated text string", "63 6162"},
+		{"truncated array", "82 01"},
+		{"map without value", "a1 01"},
+		{"tag without content", "c1"},
+		{"unsigned overflow", "1b ffffffffffffffff"},
+		{"negative overflow", "3b ffffffffffffffff"},
+		{"huge array", "9b ffffffffffffffff 00"},
+		{"huge map", "bb ffffffffffffffff 00"},
+		{"huge byte string", "5b ffffffffffffffff 00"},
+		{"reserved additional information", "1c"},
+		{"indefinite byte string", "5f 41 01 41 02 ff"},
+		{"indefinite text string", "7f 61 61 ff"},
+		{"indefinite array", "9f 01 02 ff"},
+		{"indefinite map", "bf 01 02 ff"},
+		{"simple value", "f5"},
+		{"float", "f9 3c00"},
+		{"trailing data", "01 02"},
+		{"nesting too deep", strings.Repeat("81", cborMaxDepth+1) + "00"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if decoded, err := cborDecode(decodeHex(t, test.encoded)); err == nil {
+				t.Errorf("decoded %#v, want an error", decoded)
+			}
+		})
+	}
+}
+
+func TestCBORMaxDepth(t *testing.T) {
+	encoded := decodeHex(t, strings.Repeat("81", cborMaxDepth)+"00")
+	if _, err := cborDecode(encoded); err != nil {
+		t.Errorf("%d nested arrays: %v", cborMaxDepth, err)
+	}
+}
@@ -0,0 +1,77 @@
+package signingCrypto
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ParseCertificateChain decodes the CERTIFICATE blocks of a PEM certificate chain in order.
+func ParseCertificateChain(chainPEM []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, chainPEM = pem.Decode(chainPEM)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("x509: unexpected PEM block %q in certificate chain", block.Type)
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, certificate)
+	}
+
+	if len(chain) == 0 {
+		return nil, errors.New("x509: no certificate found in PEM data")
+	}
+
+	return chain, nil
+}
+
+// VerifyCertificateChain checks that the first certificate of the chain certifies the public
+// key, that every certificate is issued by the CA certificate following it and that all of
+// them are valid at the given time. The chain does not need to end with a root.
+func VerifyCertificateChain(chain []*x509.Certificate, publicKey crypto.PublicKey, at time.Time) error {
+	if len(chain) == 0 {
+		return errors.New("x509: empty certificate chain")
+	}
+
+	keyFingerprint, err := Fingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+	certificateFingerprint, err := Fingerprint(chain[0].PublicKey)
+	if err != nil {
+		return err
+	}
+	if keyFingerprint != certificateFingerprint {
+		return errors.New("x509: certificate does not certify the public key")
+	}
+
+	for i, certificate := range chain {
+		if at.Before(certificate.NotBefore) || at.After(certificate.NotAfter) {
+			return fmt.Errorf("x509: certificate %d (%s) is not valid at %s", i, certificate.Subject, at.Format(time.RFC3339))
+		}
+		if i == len(chain)-1 {
+			break
+		}
+
+		issuer := chain[i+1]
+		if !issuer.IsCA {
+			return fmt.Errorf("x509: certificate %d (%s) is not a CA certificate", i+1, issuer.Subject)
+		}
+		if err := certificate.CheckSignatureFrom(issuer); err != nil {
+			return fmt.Errorf("x509: certificate %d (%s) is not issued by %s: %v", i, certificate.Subject, issuer.Subject, err)
+		}
+	}
+
+	return nil
+}
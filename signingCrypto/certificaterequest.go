@@ -0,0 +1,61 @@
+package signingCrypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// NewCertificateRequest returns the DER encoded PKCS#10 certificate request of the template,
+// signed by the key with the hash and RSA padding of the parameters.
+func NewCertificateRequest(key crypto.Signer, params SignatureParameters, template x509.CertificateRequest) ([]byte, error) {
+	signatureAlgorithm, err := x509SignatureAlgorithm(key.Public(), params)
+	if err != nil {
+		return nil, err
+	}
+	template.SignatureAlgorithm = signatureAlgorithm
+
+	return x509.CreateCertificateRequest(rand.Reader, &template, key)
+}
+
+// x509SignatureAlgorithm returns the crypto/x509 signature algorithm of signatures made with
+// the public key and parameters.
+func x509SignatureAlgorithm(publicKey crypto.PublicKey, params SignatureParameters) (x509.SignatureAlgorithm, error) {
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		params = params.rsaParameters()
+		algorithms := map[crypto.Hash][2]x509.SignatureAlgorithm{
+			crypto.SHA256: {x509.SHA256WithRSAPSS, x509.SHA256WithRSA},
+			crypto.SHA384: {x509.SHA384WithRSAPSS, x509.SHA384WithRSA},
+			crypto.SHA512: {x509.SHA512WithRSAPSS, x509.SHA512WithRSA},
+		}
+		algorithm, ok := algorithms[params.Hash]
+		if !ok {
+			return x509.UnknownSignatureAlgorithm, fmt.Errorf("x509: unsupported hash %v", params.Hash)
+		}
+		if params.Padding == RSAPaddingPKCS1v15 {
+			return algorithm[1], nil
+		}
+		return algorithm[0], nil
+	case *ecdsa.PublicKey:
+		switch hash := params.eccHash(pub.Curve); hash {
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		default:
+			return x509.UnknownSignatureAlgorithm, fmt.Errorf("x509: unsupported hash %v", hash)
+		}
+	case ed25519.PublicKey:
+		return x509.PureEd25519, nil
+	default:
+		return x509.UnknownSignatureAlgorithm, errors.New("x509: unsupported public key type")
+	}
+}
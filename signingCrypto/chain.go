@@ -0,0 +1,290 @@
+package signingCrypto
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChainLink is one signature of a device signature chain. SignedData follows
+// <signature_counter>_<data_to_be_signed>_<last_signature_base64_encoded>.
+type ChainLink struct {
+	SignatureCounter int    `json:"signature_counter"`
+	SignedData       string `json:"signed_data"`
+	Signature        string `json:"signature"`
+}
+
+// ChainReport is the outcome of verifying a signature chain. BrokenAt is the
+// signature counter of the first link that failed verification.
+type ChainReport struct {
+	DeviceId           string `json:"deviceId"`
+	Valid              bool   `json:"valid"`
+	VerifiedSignatures int    `json:"verified_signatures"`
+	BrokenAt           int    `json:"broken_at,omitempty"`
+	Reason             string `json:"reason,omitempty"`
+	// ContinuedFrom is the last counter of an external chain the verified links continue
+	ContinuedFrom int `json:"continued_from,omitempty"`
+	// Gaps are the ranges of links within the chain that were not available to verify
+	Gaps []ChainGap `json:"gaps,omitempty"`
+}
+
+// ChainGap is a range of signature counters missing from a verified chain, e.g. the
+// signatures a restored backup was ahead of the device by.
+type ChainGap struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// keyRotationPrefix starts the data of the chain link announcing a new key version.
+const keyRotationPrefix = "key_rotation:"
+
+// KeyRotationData returns the data of the chain link that hands the chain over to a new
+// key version. The link is signed with the previous key, the fingerprint names the new one.
+func KeyRotationData(version int, fingerprint string) string {
+	return keyRotationPrefix + strconv.Itoa(version) + ":" + fingerprint
+}
+
+// IsKeyRotationData reports whether data is reserved for key rotation links.
+func IsKeyRotationData(data string) bool {
+	return strings.HasPrefix(data, keyRotationPrefix)
+}
+
+// parseKeyRotationData returns the key version and fingerprint announced by rotation link data.
+func parseKeyRotationData(data string) (int, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(data, keyRotationPrefix), ":", 2)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("malformed key rotation %q", data)
+	}
+
+	version, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("malformed key rotation %q", data)
+	}
+
+	return version, parts[1], nil
+}
+
+// ChainKey is a key version of a device. LastSignature is the counter of the rotation link
+// it signed last, 0 if it is the current key or the counter is not known.
+type ChainKey struct {
+	Version       int
+	Fingerprint   string
+	LastSignature int
+	Verifier      Verifier
+}
+
+// ChainVerifier walks the links of a device signature chain in counter order. It checks
+// that counters are gap-free from 1, or from the external chain it continues, that each
+// signed data embeds the previous signature (the base64 encoded device id for the first
+// link) and that each signature verifies.
+// Each link is verified with the key version in effect at its counter: the chain starts
+// with the first key and a key rotation link, signed with the old key, hands it over to
+// the key version and fingerprint it announces.
+type ChainVerifier struct {
+	deviceId          string
+	keys              []ChainKey
+	key               int
+	previousSignature string
+	skipped           int
+	report            ChainReport
+}
+
+// NewChainVerifier creates a ChainVerifier for the chain of a device that never rotated its key.
+func NewChainVerifier(deviceId string, verifier Verifier) *ChainVerifier {
+	return NewKeyedChainVerifier(deviceId, []ChainKey{{Version: 1, Verifier: verifier}})
+}
+
+// NewKeyedChainVerifier creates a ChainVerifier for the chain of a device with the given
+// key versions, ordered by version.
+func NewKeyedChainVerifier(deviceId string, keys []ChainKey) *ChainVerifier {
+	return &ChainVerifier{
+		deviceId:          deviceId,
+		keys:              keys,
+		previousSignature: base64.StdEncoding.EncodeToString([]byte(deviceId)),
+		report: ChainReport{
+			DeviceId: deviceId,
+			Valid:    true,
+		},
+	}
+}
+
+// Continue makes the verification start after the link signatureCounter of an external
+// chain with the signature lastSignature, e.g. the chain of a device imported from another
+// signing provider or restored from a backup. The links up to signatureCounter are not
+// verified, the first link is verified with the key version in effect after signatureCounter.
+func (c *ChainVerifier) Continue(signatureCounter int, lastSignature string) *ChainVerifier {
+	c.report.ContinuedFrom = signatureCounter
+	c.previousSignature = lastSignature
+	for c.key < len(c.keys)-1 && c.keys[c.key].LastSignature != 0 && c.keys[c.key].LastSignature <= signatureCounter {
+		c.key++
+	}
+	return c
+}
+
+// Skip makes the verification continue after the link to with the signature lastSignature.
+// The links from up to to are not verified and reported as gap, the following link is
+// verified with the key version in effect after to. The gap must start at the next link,
+// otherwise the chain is broken there.
+func (c *ChainVerifier) Skip(from int, to int, lastSignature string) error {
+	if !c.report.Valid {
+		return fmt.Errorf("chain is broken at signature %d: %s", c.report.BrokenAt, c.report.Reason)
+	}
+
+	expectedCounter := c.nextCounter()
+	if from != expectedCounter || to < from {
+		err := fmt.Errorf("expected signature counter %d, found gap %d to %d", expectedCounter, from, to)
+		c.report.Valid = false
+		c.report.BrokenAt = expectedCounter
+		c.report.Reason = err.Error()
+		return err
+	}
+
+	c.report.Gaps = append(c.report.Gaps, ChainGap{From: from, To: to})
+	c.skipped += to - from + 1
+	c.previousSignature = lastSignature
+	for c.key < len(c.keys)-1 && c.keys[c.key].LastSignature != 0 && c.keys[c.key].LastSignature <= to {
+		c.key++
+	}
+	return nil
+}
+
+// nextCounter returns the signature counter the next link must have
+func (c *ChainVerifier) nextCounter() int {
+	return c.report.ContinuedFrom + c.skipped + c.report.VerifiedSignatures + 1
+}
+
+// Next verifies the next link of the chain. Once a link is broken, the chain stays
+// broken and every further link is rejected with the first error.
+func (c *ChainVerifier) Next(link ChainLink) error {
+	if !c.report.Valid {
+		return fmt.Errorf("chain is broken at signature %d: %s", c.report.BrokenAt, c.report.Reason)
+	}
+
+	expectedCounter := c.nextCounter()
+	rotated, err := c.checkLink(expectedCounter, link)
+	if err != nil {
+		c.report.Valid = false
+		c.report.BrokenAt = expectedCounter
+		c.report.Reason = err.Error()
+		return err
+	}
+
+	c.report.VerifiedSignatures++
+	c.previousSignature = link.Signature
+	if rotated {
+		c.key++
+	}
+	return nil
+}
+
+// End checks that the chain ended at the expected signature counter with the
+// expected last signature. An empty lastSignature skips the signature check.
+func (c *ChainVerifier) End(signatureCounter int, lastSignature string) error {
+	if !c.report.Valid {
+		return nil
+	}
+
+	lastCounter := c.nextCounter() - 1
+
+	var err error
+	switch {
+	case lastCounter != signatureCounter:
+		err = fmt.Errorf("chain ends at signature %d, expected %d", lastCounter, signatureCounter)
+		c.report.BrokenAt = lastCounter + 1
+	case lastSignature != "" && signatureCounter > 0 && lastSignature != c.previousSignature:
+		err = fmt.Errorf("last signature of the chain does not match the expected last signature")
+		c.report.BrokenAt = signatureCounter
+	default:
+		return nil
+	}
+
+	c.report.Valid = false
+	c.report.Reason = err.Error()
+	return err
+}
+
+// LastSignature returns the signature of the last verified link, or the base64
+// encoded device id (the continued signature) if no link was verified yet.
+func (c *ChainVerifier) LastSignature() string {
+	return c.previousSignature
+}
+
+// Report returns the verification outcome of the links seen so far.
+func (c *ChainVerifier) Report() ChainReport {
+	return c.report
+}
+
+// checkLink verifies the link and reports whether it rotates the chain to the next key version.
+func (c *ChainVerifier) checkLink(expectedCounter int, link ChainLink) (bool, error) {
+	if link.SignatureCounter != expectedCounter {
+		return false, fmt.Errorf("expected signature counter %d, found %d", expectedCounter, link.SignatureCounter)
+	}
+
+	prefix := strconv.Itoa(link.SignatureCounter) + "_"
+	if !strings.HasPrefix(link.SignedData, prefix) {
+		return false, fmt.Errorf("signed data does not start with signature counter %d", link.SignatureCounter)
+	}
+
+	suffix := "_" + c.previousSignature
+	if !strings.HasSuffix(link.SignedData, suffix) || len(link.SignedData) < len(prefix)+len(suffix) {
+		return false, fmt.Errorf("signed data does not embed the previous signature")
+	}
+
+	if len(c.keys) == 0 {
+		return false, fmt.Errorf("no key to verify signature %d", link.SignatureCounter)
+	}
+	key := c.keys[c.key]
+	if key.LastSignature != 0 && link.SignatureCounter > key.LastSignature {
+		return false, fmt.Errorf("key version %d signed until signature %d, but the chain was not rotated", key.Version, key.LastSignature)
+	}
+
+	data := link.SignedData[len(prefix) : len(link.SignedData)-len(suffix)]
+	if IsKeyRotationData(data) {
+		if err := c.checkRotation(link.SignatureCounter, data); err != nil {
+			return false, err
+		}
+	} else if key.LastSignature == link.SignatureCounter {
+		return false, fmt.Errorf("key version %d was rotated at signature %d, but it is no key rotation", key.Version, link.SignatureCounter)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(link.Signature)
+	if err != nil {
+		return false, fmt.Errorf("signature is not valid base64")
+	}
+
+	if err := key.Verifier.Verify([]byte(link.SignedData), signature); err != nil {
+		if len(c.keys) > 1 {
+			return false, fmt.Errorf("key version %d: %v", key.Version, err)
+		}
+		return false, err
+	}
+
+	return IsKeyRotationData(data), nil
+}
+
+// checkRotation checks that a key rotation link hands the chain over to the next key version
+// with the fingerprint it announces.
+func (c *ChainVerifier) checkRotation(signatureCounter int, data string) error {
+	version, fingerprint, err := parseKeyRotationData(data)
+	if err != nil {
+		return err
+	}
+
+	key := c.keys[c.key]
+	if c.key+1 >= len(c.keys) {
+		return fmt.Errorf("chain rotates to key version %d, which is not known", version)
+	}
+	next := c.keys[c.key+1]
+	if version != next.Version {
+		return fmt.Errorf("chain rotates to key version %d, expected %d", version, next.Version)
+	}
+	if next.Fingerprint != "" && fingerprint != next.Fingerprint {
+		return fmt.Errorf("key rotation to version %d announces fingerprint %s, the key has %s", version, fingerprint, next.Fingerprint)
+	}
+	if key.LastSignature != 0 && key.LastSignature != signatureCounter {
+		return fmt.Errorf("key version %d was rotated at signature %d, expected %d", key.Version, signatureCounter, key.LastSignature)
+	}
+
+	return nil
+}
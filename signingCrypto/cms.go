@@ -0,0 +1,408 @@
+package signingCrypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// Object identifiers of CMS (RFC 5652) and the algorithms of RFC 3370, RFC 4056,
+// RFC 5754 and RFC 8419.
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSASSAPSS     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidMGF1          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidEd25519       = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// cmsHashes maps the digest algorithms to their object identifier, the RSA PKCS#1 v1.5
+// signature algorithm and the ECDSA signature algorithm.
+var cmsHashes = map[crypto.Hash]struct {
+	digest asn1.ObjectIdentifier
+	rsa    asn1.ObjectIdentifier
+	ecdsa  asn1.ObjectIdentifier
+}{
+	crypto.SHA256: {oidSHA256, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+	crypto.SHA384: {oidSHA384, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}},
+	crypto.SHA512: {oidSHA512, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}},
+}
+
+// cmsContentInfo holds the content in an explicit [0] tag, kept as raw value
+// because encoding/asn1 does not apply the tag when marshaling a RawValue.
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo cmsEncapsulatedContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+// cmsEncapsulatedContentInfo has no eContent, the signatures are detached.
+type cmsEncapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	Sid                cmsIssuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type cmsIssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// rsaPSSParameters is RSASSA-PSS-params of RFC 4055, trailerField is left at its default.
+type rsaPSSParameters struct {
+	HashAlgorithm    pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MaskGenAlgorithm pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+	SaltLength       int                      `asn1:"explicit,tag:2"`
+}
+
+// CMSSignature is a decoded detached CMS SignedData with a single signer.
+type CMSSignature struct {
+	// Certificate is the certificate of the signer, taken from the SignedData certificates
+	Certificate *x509.Certificate
+	// SigningTime is the signing time signed attribute, zero if absent
+	SigningTime time.Time
+
+	hash          crypto.Hash
+	params        SignatureParameters
+	messageDigest []byte
+	signedAttrs   []byte
+	signature     []byte
+}
+
+// SignDetachedCMS returns the DER encoded CMS SignedData (RFC 5652) of a detached signature
+// of the document. The signer must hold the private key of the certificate and produce
+// signatures of the given parameters; ECDSA signatures must be ASN.1 DER encoded. The
+// certificate and the chain are embedded, signed attributes are content type, signing
+// time and message digest.
+func SignDetachedCMS(signer Signer, params SignatureParameters, certificate *x509.Certificate, chain []*x509.Certificate, document []byte, signingTime time.Time) ([]byte, error) {
+	hash, digestAlgorithm, signatureAlgorithm, err := cmsAlgorithms(certificate.PublicKey, params)
+	if err != nil {
+		return nil, err
+	}
+
+	messageDigest, err := hashData(hash, document)
+	if err != nil {
+		return nil, err
+	}
+
+	signedAttrs, err := cmsSignedAttributes(messageDigest, signingTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// the signature covers the DER encoding of the attributes as SET OF
+	signature, err := signer.Sign(cmsSet(signedAttrs).FullBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	certificates := append([]byte(nil), certificate.Raw...)
+	for _, c := range chain {
+		certificates = append(certificates, c.Raw...)
+	}
+
+	signedData, err := asn1.Marshal(cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlgorithm},
+		EncapContentInfo: cmsEncapsulatedContentInfo{EContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificates},
+		SignerInfos: []cmsSignerInfo{{
+			Version: 1,
+			Sid: cmsIssuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: certificate.RawIssuer},
+				SerialNumber: certificate.SerialNumber,
+			},
+			DigestAlgorithm:    digestAlgorithm,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedAttrs},
+			SignatureAlgorithm: signatureAlgorithm,
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
+
+// ParseDetachedCMS decodes a DER encoded CMS SignedData with a single signer whose
+// certificate is embedded. The signature is not verified, see Verify.
+func ParseDetachedCMS(der []byte) (*CMSSignature, error) {
+	var contentInfo cmsContentInfo
+	if rest, err := asn1.Unmarshal(der, &contentInfo); err != nil || len(rest) != 0 {
+		return nil, errors.New("cms: malformed ContentInfo")
+	}
+	if !contentInfo.ContentType.Equal(oidSignedData) || contentInfo.Content.Class != asn1.ClassContextSpecific || contentInfo.Content.Tag != 0 {
+		return nil, errors.New("cms: content is not SignedData")
+	}
+
+	var signedData cmsSignedData
+	if rest, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil || len(rest) != 0 {
+		return nil, errors.New("cms: malformed SignedData")
+	}
+	if len(signedData.SignerInfos) != 1 {
+		return nil, fmt.Errorf("cms: expected one signer, found %d", len(signedData.SignerInfos))
+	}
+	signerInfo := signedData.SignerInfos[0]
+
+	certificates, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cms: %v", err)
+	}
+
+	var cms CMSSignature
+	for _, certificate := range certificates {
+		if bytes.Equal(certificate.RawIssuer, signerInfo.Sid.Issuer.FullBytes) &&
+			certificate.SerialNumber.Cmp(signerInfo.Sid.SerialNumber) == 0 {
+			cms.Certificate = certificate
+			break
+		}
+	}
+	if cms.Certificate == nil {
+		return nil, errors.New("cms: signer certificate is not embedded")
+	}
+
+	cms.hash, cms.params, err = parseCMSAlgorithms(signerInfo.DigestAlgorithm, signerInfo.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signerInfo.SignedAttrs.Bytes) == 0 {
+		return nil, errors.New("cms: signed attributes are missing")
+	}
+	cms.signedAttrs = cmsSet(signerInfo.SignedAttrs.Bytes).FullBytes
+	cms.signature = signerInfo.Signature
+
+	if err := cms.decodeSignedAttributes(signerInfo.SignedAttrs.Bytes); err != nil {
+		return nil, err
+	}
+
+	return &cms, nil
+}
+
+// Verify checks that the signature covers the document and was made with the key of the signer certificate.
+func (c *CMSSignature) Verify(document []byte) error {
+	messageDigest, err := hashData(c.hash, document)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(messageDigest, c.messageDigest) {
+		return errors.New("cms: message digest does not match the document")
+	}
+
+	verifier, err := NewVerifier(c.Certificate.PublicKey, c.params)
+	if err != nil {
+		return err
+	}
+
+	return verifier.Verify(c.signedAttrs, c.signature)
+}
+
+func (c *CMSSignature) decodeSignedAttributes(attributes []byte) error {
+	var contentType asn1.ObjectIdentifier
+
+	for len(attributes) > 0 {
+		var attribute cmsAttribute
+		var err error
+		attributes, err = asn1.Unmarshal(attributes, &attribute)
+		if err != nil {
+			return errors.New("cms: malformed signed attribute")
+		}
+
+		switch {
+		case attribute.Type.Equal(oidContentType):
+			_, err = asn1.Unmarshal(attribute.Values.Bytes, &contentType)
+		case attribute.Type.Equal(oidMessageDigest):
+			_, err = asn1.Unmarshal(attribute.Values.Bytes, &c.messageDigest)
+		case attribute.Type.Equal(oidSigningTime):
+			_, err = asn1.Unmarshal(attribute.Values.Bytes, &c.SigningTime)
+		}
+		if err != nil {
+			return fmt.Errorf("cms: malformed signed attribute %v", attribute.Type)
+		}
+	}
+
+	if !contentType.Equal(oidData) {
+		return errors.New("cms: content type attribute is missing")
+	}
+	if len(c.messageDigest) == 0 {
+		return errors.New("cms: message digest attribute is missing")
+	}
+
+	return nil
+}
+
+// cmsSignedAttributes returns the DER encoded attributes sorted as DER requires for SET OF.
+func cmsSignedAttributes(messageDigest []byte, signingTime time.Time) ([]byte, error) {
+	values := []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidContentType, oidData},
+		{oidSigningTime, signingTime.UTC()},
+		{oidMessageDigest, messageDigest},
+	}
+
+	var encoded [][]byte
+	for _, v := range values {
+		value, err := asn1.Marshal(v.value)
+		if err != nil {
+			return nil, err
+		}
+		attribute, err := asn1.Marshal(cmsAttribute{Type: v.oid, Values: cmsSet(value)})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, attribute)
+	}
+
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+
+	return bytes.Join(encoded, nil), nil
+}
+
+// cmsSet wraps DER encoded elements in a universal SET.
+func cmsSet(elements []byte) asn1.RawValue {
+	set := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: elements}
+	set.FullBytes, _ = asn1.Marshal(set)
+	return set
+}
+
+// cmsAlgorithms returns the digest, digest algorithm and signature algorithm of a signature
+// made with the public key and parameters. Ed25519 signs pure with SHA-512 message digests.
+func cmsAlgorithms(publicKey crypto.PublicKey, params SignatureParameters) (crypto.Hash, pkix.AlgorithmIdentifier, pkix.AlgorithmIdentifier, error) {
+	var hash crypto.Hash
+	var signatureAlgorithm pkix.AlgorithmIdentifier
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		params = params.rsaParameters()
+		hash = params.Hash
+		if params.Padding == RSAPaddingPKCS1v15 {
+			signatureAlgorithm.Algorithm = cmsHashes[hash].rsa
+			signatureAlgorithm.Parameters = asn1.NullRawValue
+		} else {
+			pssParameters, err := marshalPSSParameters(hash)
+			if err != nil {
+				return 0, pkix.AlgorithmIdentifier{}, pkix.AlgorithmIdentifier{}, err
+			}
+			signatureAlgorithm.Algorithm = oidRSASSAPSS
+			signatureAlgorithm.Parameters = asn1.RawValue{FullBytes: pssParameters}
+		}
+	case *ecdsa.PublicKey:
+		hash = params.eccHash(key.Curve)
+		signatureAlgorithm.Algorithm = cmsHashes[hash].ecdsa
+	case ed25519.PublicKey:
+		hash = crypto.SHA512
+		signatureAlgorithm.Algorithm = oidEd25519
+	default:
+		return 0, pkix.AlgorithmIdentifier{}, pkix.AlgorithmIdentifier{}, errors.New("cms: unsupported public key type")
+	}
+
+	if _, ok := cmsHashes[hash]; !ok {
+		return 0, pkix.AlgorithmIdentifier{}, pkix.AlgorithmIdentifier{}, fmt.Errorf("cms: unsupported hash %v", hash)
+	}
+
+	return hash, pkix.AlgorithmIdentifier{Algorithm: cmsHashes[hash].digest}, signatureAlgorithm, nil
+}
+
+// parseCMSAlgorithms returns the digest and the verifier parameters of the signer algorithms.
+func parseCMSAlgorithms(digestAlgorithm pkix.AlgorithmIdentifier, signatureAlgorithm pkix.AlgorithmIdentifier) (crypto.Hash, SignatureParameters, error) {
+	var params SignatureParameters
+
+	for hash, oids := range cmsHashes {
+		if digestAlgorithm.Algorithm.Equal(oids.digest) {
+			params.Hash = hash
+		}
+		if signatureAlgorithm.Algorithm.Equal(oids.rsa) {
+			params.Padding = RSAPaddingPKCS1v15
+		}
+	}
+	if params.Hash == 0 {
+		return 0, params, fmt.Errorf("cms: unsupported digest algorithm %v", digestAlgorithm.Algorithm)
+	}
+
+	// RFC 3370 allows rsaEncryption for PKCS#1 v1.5 signers, OpenSSL writes it by default
+	if signatureAlgorithm.Algorithm.Equal(oidRSAEncryption) {
+		params.Padding = RSAPaddingPKCS1v15
+	}
+
+	if signatureAlgorithm.Algorithm.Equal(oidRSASSAPSS) {
+		var pssParameters rsaPSSParameters
+		if _, err := asn1.Unmarshal(signatureAlgorithm.Parameters.FullBytes, &pssParameters); err != nil {
+			return 0, params, errors.New("cms: malformed RSASSA-PSS parameters")
+		}
+		if !pssParameters.HashAlgorithm.Algorithm.Equal(digestAlgorithm.Algorithm) {
+			return 0, params, errors.New("cms: RSASSA-PSS hash does not match the digest algorithm")
+		}
+		params.Padding = RSAPaddingPSS
+	}
+
+	if signatureAlgorithm.Algorithm.Equal(oidEd25519) {
+		// Ed25519 signs the signed attributes as they are
+		params.Hash = 0
+		return crypto.SHA512, params, nil
+	}
+
+	return params.Hash, params, nil
+}
+
+// marshalPSSParameters encodes RSASSA-PSS-params with MGF1 over the same hash and a salt
+// as long as the hash, matching the salt length the RSASigner uses.
+func marshalPSSParameters(hash crypto.Hash) ([]byte, error) {
+	hashAlgorithm := pkix.AlgorithmIdentifier{Algorithm: cmsHashes[hash].digest, Parameters: asn1.NullRawValue}
+
+	mgfParameters, err := asn1.Marshal(hashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(rsaPSSParameters{
+		HashAlgorithm:    hashAlgorithm,
+		MaskGenAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: mgfParameters}},
+		SaltLength:       hash.Size(),
+	})
+}
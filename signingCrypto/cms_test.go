@@ -0,0 +1,198 @@
+package signingCrypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// The detached signatures in testdata were written by OpenSSL 3.0 over cms-document.txt
+// with self-signed certificates:
+//
+//	openssl cms -sign -binary -md sha256 -outform DER -in cms-document.txt -signer rsa.crt -inkey rsa.key -out cms-rsa-pkcs1.p7s
+//	openssl cms -sign -binary -md sha256 -outform DER -in cms-document.txt -signer rsa.crt -inkey rsa.key -keyopt rsa_padding_mode:pss -out cms-rsa-pss.p7s
+//	openssl cms -sign -binary -md sha256 -outform DER -in cms-document.txt -signer ec.crt -inkey ec.key -out cms-ecdsa.p7s
+//
+// OpenSSL 3.0 cannot write Ed25519 SignedData, Ed25519 is covered by the round trip only.
+
+// cmsTestSigner is a signer with a self-signed certificate of its key
+type cmsTestSigner struct {
+	name        string
+	signer      Signer
+	params      SignatureParameters
+	certificate *x509.Certificate
+}
+
+func selfSignedCertificate(t *testing.T, name string, publicKey crypto.PublicKey, privateKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, publicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+func cmsTestSigners(t *testing.T) []cmsTestSigner {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublicKey, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKeyPair := &RSAKeyPair{Public: &rsaKey.PublicKey, Private: rsaKey}
+	rsaCertificate := selfSignedCertificate(t, "rsa", &rsaKey.PublicKey, rsaKey)
+	pssParams := SignatureParameters{Hash: crypto.SHA384, Padding: RSAPaddingPSS}
+	pssSigner, err := NewRSASigner(rsaKeyPair, pssParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1Params := SignatureParameters{Hash: crypto.SHA256, Padding: RSAPaddingPKCS1v15}
+	pkcs1Signer, err := NewRSASigner(rsaKeyPair, pkcs1Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecParams := SignatureParameters{Format: ECDSAFormatDER}
+	ecSigner, err := NewECCSigner(&ECCKeyPair{Public: &ecKey.PublicKey, Private: ecKey}, ecParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edSigner, err := NewEd25519Signer(&Ed25519KeyPair{Public: edPublicKey, Private: edPrivateKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []cmsTestSigner{
+		{"RSA-PSS", pssSigner, pssParams, rsaCertificate},
+		{"RSA PKCS#1 v1.5", pkcs1Signer, pkcs1Params, rsaCertificate},
+		{"ECDSA", ecSigner, ecParams, selfSignedCertificate(t, "ecdsa", &ecKey.PublicKey, ecKey)},
+		{"Ed25519", edSigner, SignatureParameters{}, selfSignedCertificate(t, "ed25519", edPublicKey, edPrivateKey)},
+	}
+}
+
+func TestDetachedCMSRoundTrip(t *testing.T) {
+	document := []byte("Invoice 2026-0042\nTotal: 118.00 EUR\n")
+	signingTime := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	for _, test := range cmsTestSigners(t) {
+		t.Run(test.name, func(t *testing.T) {
+			der, err := SignDetachedCMS(test.signer, test.params, test.certificate, nil, document, signingTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cms, err := ParseDetachedCMS(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cms.Certificate.Equal(test.certificate) {
+				t.Error("parsed signer certificate differs from the signing certificate")
+			}
+			if !cms.SigningTime.Equal(signingTime) {
+				t.Errorf("signing time = %v, want %v", cms.SigningTime, signingTime)
+			}
+			if err := cms.Verify(document); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+			if err := cms.Verify([]byte("Invoice 2026-0042\nTotal: 811.00 EUR\n")); err == nil {
+				t.Error("signature verified for a tampered document")
+			}
+		})
+	}
+}
+
+// TestDetachedCMSWrongCertificate signs with one key and embeds the certificate of another
+// key of the same type, the signature must not verify
+func TestDetachedCMSWrongCertificate(t *testing.T) {
+	document := []byte("Invoice 2026-0042\nTotal: 118.00 EUR\n")
+	signers := cmsTestSigners(t)
+	others := cmsTestSigners(t)
+
+	for i, test := range signers {
+		t.Run(test.name, func(t *testing.T) {
+			der, err := SignDetachedCMS(test.signer, test.params, others[i].certificate, nil, document, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			cms, err := ParseDetachedCMS(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cms.Verify(document); err == nil {
+				t.Error("signature verified against the certificate of another key")
+			}
+		})
+	}
+}
+
+func TestDetachedCMSOpenSSL(t *testing.T) {
+	document := readTestData(t, "cms-document.txt")
+
+	for _, name := range []string{"cms-rsa-pkcs1.p7s", "cms-rsa-pss.p7s", "cms-ecdsa.p7s"} {
+		t.Run(name, func(t *testing.T) {
+			cms, err := ParseDetachedCMS(readTestData(t, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cms.Verify(document); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+
+			tampered := append([]byte(nil), document...)
+			tampered[len(tampered)-2] ^= 1
+			if err := cms.Verify(tampered); err == nil {
+				t.Error("signature verified for a tampered document")
+			}
+		})
+	}
+}
+
+func TestParseDetachedCMSRejects(t *testing.T) {
+	der := readTestData(t, "cms-ecdsa.p7s")
+
+	tests := []struct {
+		name string
+		der  []byte
+	}{
+		{"empty", nil},
+		{"truncated", der[:len(der)-1]},
+		{"trailing data", append(append([]byte(nil), der...), 0)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseDetachedCMS(test.der); err == nil {
+				t.Error("malformed SignedData parsed")
+			}
+		})
+	}
+}
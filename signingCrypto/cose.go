@@ -0,0 +1,219 @@
+package signingCrypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// COSE header labels (RFC 9052 section 3.1) and the COSE_Sign1 tag.
+const (
+	coseHeaderAlg  = 1
+	coseHeaderKid  = 4
+	coseSign1Tag   = 18
+	coseSignature1 = "Signature1"
+)
+
+// COSEHeaderSignatureCounter is the text label of the signature counter protected header.
+const COSEHeaderSignatureCounter = "signature_counter"
+
+// coseAlgorithms maps JWS algorithm names to the COSE algorithm identifiers of the
+// IANA COSE Algorithms registry.
+var coseAlgorithms = map[string]int64{
+	"ES256": -7,
+	"ES384": -35,
+	"ES512": -36,
+	"EdDSA": -8,
+	"PS256": -37,
+	"PS384": -38,
+	"PS512": -39,
+	"RS256": -257,
+	"RS384": -258,
+	"RS512": -259,
+}
+
+// COSEAlgorithm returns the COSE algorithm identifier of a JWS algorithm name.
+func COSEAlgorithm(jwsAlgorithm string) (int64, error) {
+	alg, ok := coseAlgorithms[jwsAlgorithm]
+	if !ok {
+		return 0, fmt.Errorf("cose: no algorithm for %q", jwsAlgorithm)
+	}
+
+	return alg, nil
+}
+
+// COSEHeader is the protected header of a device COSE_Sign1 message.
+type COSEHeader struct {
+	Alg              int64
+	Kid              []byte
+	SignatureCounter int
+}
+
+// COSEPayload is the signature record carried as CBOR map payload.
+type COSEPayload struct {
+	SignatureCounter int
+	Data             string
+	LastSignature    string
+}
+
+// COSESign1 is a decoded COSE_Sign1 message (RFC 9052 section 4.2).
+type COSESign1 struct {
+	Header    COSEHeader
+	Payload   COSEPayload
+	protected []byte
+	payload   []byte
+	signature []byte
+}
+
+// SignCOSESign1 returns the tagged COSE_Sign1 message of the payload. The signer must
+// produce signatures of the header algorithm, for ECDSA in ECDSAFormatP1363.
+func SignCOSESign1(signer Signer, header COSEHeader, payload COSEPayload) ([]byte, error) {
+	protected := cborEncodeMap(
+		cborEncodeInt(coseHeaderAlg), cborEncodeInt(header.Alg),
+		cborEncodeInt(coseHeaderKid), cborEncodeBytes(header.Kid),
+		cborEncodeText(COSEHeaderSignatureCounter), cborEncodeInt(int64(header.SignatureCounter)),
+	)
+	payloadBytes := cborEncodeMap(
+		cborEncodeText("signature_counter"), cborEncodeInt(int64(payload.SignatureCounter)),
+		cborEncodeText("data"), cborEncodeText(payload.Data),
+		cborEncodeText("last_signature"), cborEncodeText(payload.LastSignature),
+	)
+
+	signature, err := signer.Sign(coseSigStructure(protected, payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	return cborEncodeTag(coseSign1Tag, cborEncodeArray(
+		cborEncodeBytes(protected),
+		cborEncodeMap(),
+		cborEncodeBytes(payloadBytes),
+		cborEncodeBytes(signature),
+	)), nil
+}
+
+// ParseCOSESign1 decodes a COSE_Sign1 message, tagged or untagged. The signature is
+// not verified, see Verify.
+func ParseCOSESign1(data []byte) (*COSESign1, error) {
+	item, err := cborDecode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if tagged, ok := item.(cborTagged); ok {
+		if tagged.Number != coseSign1Tag {
+			return nil, fmt.Errorf("cose: unexpected tag %d", tagged.Number)
+		}
+		item = tagged.Content
+	}
+
+	fields, ok := item.([]interface{})
+	if !ok || len(fields) != 4 {
+		return nil, errors.New("cose: COSE_Sign1 must be an array of four items")
+	}
+
+	var message COSESign1
+	message.protected, ok = fields[0].([]byte)
+	if !ok {
+		return nil, errors.New("cose: protected header must be a byte string")
+	}
+	if _, ok := fields[1].([]cborPair); !ok {
+		return nil, errors.New("cose: unprotected header must be a map")
+	}
+	message.payload, ok = fields[2].([]byte)
+	if !ok {
+		return nil, errors.New("cose: payload must be a byte string")
+	}
+	message.signature, ok = fields[3].([]byte)
+	if !ok {
+		return nil, errors.New("cose: signature must be a byte string")
+	}
+
+	if err := message.decodeHeader(); err != nil {
+		return nil, err
+	}
+	if err := message.decodePayload(); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// Verify checks the signature of the message and that the signature counter of
+// the protected header matches the one of the payload.
+func (m *COSESign1) Verify(verifier Verifier) error {
+	if m.Header.SignatureCounter != m.Payload.SignatureCounter {
+		return errors.New("cose: protected header and payload disagree on the signature counter")
+	}
+
+	return verifier.Verify(coseSigStructure(m.protected, m.payload), m.signature)
+}
+
+// HasKid reports whether the protected header carries the given key id.
+func (m *COSESign1) HasKid(kid []byte) bool {
+	return bytes.Equal(m.Header.Kid, kid)
+}
+
+func (m *COSESign1) decodeHeader() error {
+	item, err := cborDecode(m.protected)
+	if err != nil {
+		return fmt.Errorf("cose: protected header: %v", err)
+	}
+	pairs, ok := item.([]cborPair)
+	if !ok {
+		return errors.New("cose: protected header must be a map")
+	}
+
+	var hasAlg bool
+	for _, pair := range pairs {
+		switch pair.Key {
+		case int64(coseHeaderAlg):
+			m.Header.Alg, hasAlg = pair.Value.(int64)
+		case int64(coseHeaderKid):
+			m.Header.Kid, _ = pair.Value.([]byte)
+		case COSEHeaderSignatureCounter:
+			counter, _ := pair.Value.(int64)
+			m.Header.SignatureCounter = int(counter)
+		}
+	}
+	if !hasAlg {
+		return errors.New("cose: protected header has no algorithm")
+	}
+
+	return nil
+}
+
+func (m *COSESign1) decodePayload() error {
+	item, err := cborDecode(m.payload)
+	if err != nil {
+		return fmt.Errorf("cose: payload: %v", err)
+	}
+	pairs, ok := item.([]cborPair)
+	if !ok {
+		return errors.New("cose: payload must be a map")
+	}
+
+	for _, pair := range pairs {
+		switch pair.Key {
+		case "signature_counter":
+			counter, _ := pair.Value.(int64)
+			m.Payload.SignatureCounter = int(counter)
+		case "data":
+			m.Payload.Data, _ = pair.Value.(string)
+		case "last_signature":
+			m.Payload.LastSignature, _ = pair.Value.(string)
+		}
+	}
+
+	return nil
+}
+
+// coseSigStructure encodes the Sig_structure of a COSE_Sign1 message without external data.
+func coseSigStructure(protected []byte, payload []byte) []byte {
+	return cborEncodeArray(
+		cborEncodeText(coseSignature1),
+		cborEncodeBytes(protected),
+		cborEncodeBytes(nil),
+		cborEncodeBytes(payload),
+	)
+}
@@ -0,0 +1,203 @@
+package signingCrypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"testing"
+)
+
+// coseExampleSign1 is the single ECDSA signature COSE_Sign1 example of RFC 9052 appendix
+// C.2.1 (sign1-pass-01 of the COSE WG examples), signed with the P-256 key "11" of C.7.1:
+//
+//	18([h'a10126', {4: '11'}, 'This is the content.', h'8eb33e4c...'])
+const coseExampleSign1 = "d2 84 43 a10126 a1 04 42 3131 54 546869732069732074686520636f6e74656e742e" +
+	" 58 40 8eb33e4ca31d1c465ab05aac34cc6b23d58fef5c083106c4d25a91aef0b0117e" +
+	"2af9a291aa32e14ab834dc56ed2a223444547e01f11d3b0916e5a4c345cacb36"
+
+// coseExampleKey is the public key "11" of RFC 9052 appendix C.7.1
+func coseExampleKey(t *testing.T) *ecdsa.PublicKey {
+	t.Helper()
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(decodeHex(t, "bac5b11cad8f99f9c72b05cf4b9e26d244dc189f745228255a219a86d6a09eff")),
+		Y:     new(big.Int).SetBytes(decodeHex(t, "20138bf82dc1b6d562be0fa54ab7804a3a64b6d72ccfed6b6fb6ed28bbfc117e")),
+	}
+}
+
+// parseCOSEExample decodes the example message. Its payload is not a signature record, so
+// the message is assembled from the decoded items instead of by ParseCOSESign1.
+func parseCOSEExample(t *testing.T, encoded []byte) *COSESign1 {
+	t.Helper()
+
+	item, err := cborDecode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagged, ok := item.(cborTagged)
+	if !ok || tagged.Number != coseSign1Tag {
+		t.Fatalf("example is not a tagged COSE_Sign1 message: %#v", item)
+	}
+	fields := tagged.Content.([]interface{})
+
+	message := &COSESign1{
+		protected: fields[0].([]byte),
+		payload:   fields[2].([]byte),
+		signature: fields[3].([]byte),
+	}
+	if err := message.decodeHeader(); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestCOSEExampleSign1(t *testing.T) {
+	message := parseCOSEExample(t, decodeHex(t, coseExampleSign1))
+	if message.Header.Alg != coseAlgorithms["ES256"] {
+		t.Errorf("alg = %d, want ES256", message.Header.Alg)
+	}
+	if string(message.payload) != "This is the content." {
+		t.Errorf("payload = %q", message.payload)
+	}
+
+	verifier, err := NewECCVerifier(coseExampleKey(t), SignatureParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := message.Verify(verifier); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	message.payload = []byte("This is the content!")
+	if err := message.Verify(verifier); err == nil {
+		t.Error("tampered example verified")
+	}
+}
+
+func TestCOSESign1RoundTrip(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublicKey, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecParams := SignatureParameters{Format: ECDSAFormatP1363}
+	ecSigner, _ := NewECCSigner(&ECCKeyPair{Public: &ecKey.PublicKey, Private: ecKey}, ecParams)
+	ecVerifier, _ := NewECCVerifier(&ecKey.PublicKey, ecParams)
+	edSigner, _ := NewEd25519Signer(&Ed25519KeyPair{Public: edPublicKey, Private: edPrivateKey})
+	edVerifier, _ := NewEd25519Verifier(edPublicKey)
+	rsaSigner, _ := NewRSASigner(&RSAKeyPair{Public: &rsaKey.PublicKey, Private: rsaKey}, SignatureParameters{})
+	rsaVerifier, _ := NewRSAVerifier(&rsaKey.PublicKey, SignatureParameters{})
+
+	tests := []struct {
+		alg      string
+		signer   Signer
+		verifier Verifier
+	}{
+		{"ES384", ecSigner, ecVerifier},
+		{"EdDSA", edSigner, edVerifier},
+		{"PS256", rsaSigner, rsaVerifier},
+	}
+
+	for _, test := range tests {
+		t.Run(test.alg, func(t *testing.T) {
+			alg, err := COSEAlgorithm(test.alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header := COSEHeader{Alg: alg, Kid: []byte("device-kid"), SignatureCounter: 300}
+			payload := COSEPayload{SignatureCounter: 300, Data: "transaction", LastSignature: "bGFzdA=="}
+
+			encoded, err := SignCOSESign1(test.signer, header, payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			message, err := ParseCOSESign1(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if message.Header.Alg != header.Alg || !message.HasKid(header.Kid) || message.Header.SignatureCounter != header.SignatureCounter {
+				t.Errorf("header = %+v, want %+v", message.Header, header)
+			}
+			if message.Payload != payload {
+				t.Errorf("payload = %+v, want %+v", message.Payload, payload)
+			}
+			if err := message.Verify(test.verifier); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+
+			//The payload is signed, any change breaks the signature
+			tampered, err := ParseCOSESign1(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tampered.payload = cborEncodeMap(
+				cborEncodeText("signature_counter"), cborEncodeInt(300),
+				cborEncodeText("data"), cborEncodeText("transaction!"),
+				cborEncodeText("last_signature"), cborEncodeText("bGFzdA=="),
+			)
+			if err := tampered.Verify(test.verifier); err == nil {
+				t.Error("tampered payload verified")
+			}
+		})
+	}
+}
+
+func TestCOSESign1CounterMismatch(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := NewEd25519Signer(&Ed25519KeyPair{Public: privateKey.Public().(ed25519.PublicKey), Private: privateKey})
+	verifier, _ := NewEd25519Verifier(privateKey.Public().(ed25519.PublicKey))
+
+	encoded, err := SignCOSESign1(signer, COSEHeader{Alg: coseAlgorithms["EdDSA"], SignatureCounter: 1}, COSEPayload{SignatureCounter: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := ParseCOSESign1(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := message.Verify(verifier); err == nil {
+		t.Error("message with disagreeing signature counters verified")
+	}
+}
+
+func TestParseCOSESign1Rejects(t *testing.T) {
+	protected := cborEncodeMap(cborEncodeInt(coseHeaderAlg), cborEncodeInt(-7))
+	payload := cborEncodeMap()
+
+	tests := []struct {
+		name    string
+		encoded []byte
+	}{
+		{"not CBOR", []byte{0x1c}},
+		{"COSE_Sign tag", cborEncodeTag(98, cborEncodeArray(cborEncodeBytes(protected), cborEncodeMap(), cborEncodeBytes(payload), cborEncodeBytes(nil)))},
+		{"three items", cborEncodeArray(cborEncodeBytes(protected), cborEncodeMap(), cborEncodeBytes(payload))},
+		{"protected header map", cborEncodeArray(protected, cborEncodeMap(), cborEncodeBytes(payload), cborEncodeBytes(nil))},
+		{"unprotected header bytes", cborEncodeArray(cborEncodeBytes(protected), cborEncodeBytes(nil), cborEncodeBytes(payload), cborEncodeBytes(nil))},
+		{"payload array", cborEncodeArray(cborEncodeBytes(protected), cborEncodeMap(), cborEncodeArray(), cborEncodeBytes(nil))},
+		{"no algorithm", cborEncodeArray(cborEncodeBytes(cborEncodeMap()), cborEncodeMap(), cborEncodeBytes(payload), cborEncodeBytes(nil))},
+		{"payload not a map", cborEncodeArray(cborEncodeBytes(protected), cborEncodeMap(), cborEncodeBytes([]byte("content")), cborEncodeBytes(nil))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseCOSESign1(test.encoded); err == nil {
+				t.Error("malformed COSE_Sign1 parsed")
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 )
 
 // ECCKeyPair is a DTO that holds ECC private and public keys.
@@ -28,27 +29,39 @@ func (m ECCMarshaler) Encode(keyPair ECCKeyPair) ([]byte, []byte, error) {
 		return nil, nil, err
 	}
 
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&keyPair.Public)
+	encodedPublic, err := m.EncodePublic(keyPair.Public)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	encodedPrivate := pem.EncodeToMemory(&pem.Block{
-		Type:  "PRIVATE_KEY",
+		Type:  "EC PRIVATE KEY",
 		Bytes: privateKeyBytes,
 	})
 
-	encodedPublic := pem.EncodeToMemory(&pem.Block{
-		Type:  "PUBLIC_KEY",
-		Bytes: publicKeyBytes,
-	})
-
 	return encodedPublic, encodedPrivate, nil
 }
 
+// EncodePublic encodes an ECC public key as PEM wrapped SubjectPublicKeyInfo.
+func (m ECCMarshaler) EncodePublic(publicKey *ecdsa.PublicKey) ([]byte, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	}), nil
+}
+
 // Decode assembles an ECCKeyPair from an encoded private key.
 func (m ECCMarshaler) Decode(privateKeyBytes []byte) (*ECCKeyPair, error) {
 	block, _ := pem.Decode(privateKeyBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found in ECC private key")
+	}
+
 	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,63 @@
+package signingCrypto
+
+import (
+	"crypto/elliptic"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+// ECDSAFormat is the encoding of ECDSA signatures.
+type ECDSAFormat string
+
+const (
+	// ECDSAFormatDER is the ASN.1 DER encoded Ecdsa-Sig-Value of X9.62, as used by Java.
+	ECDSAFormatDER ECDSAFormat = "DER"
+	// ECDSAFormatP1363 is the IEEE P1363 concatenation r||s, each left padded to the
+	// byte length of the curve order, as used by .NET, JWS and COSE.
+	ECDSAFormatP1363 ECDSAFormat = "P1363"
+)
+
+// ecdsaSignature is the ASN.1 structure of a DER encoded ECDSA signature.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// encodeECDSASignature encodes r and s in the given format, DER if format is empty.
+func encodeECDSASignature(format ECDSAFormat, curve elliptic.Curve, r, s *big.Int) ([]byte, error) {
+	switch format {
+	case "", ECDSAFormatDER:
+		return asn1.Marshal(ecdsaSignature{R: r, S: s})
+	case ECDSAFormatP1363:
+		size := curveByteSize(curve)
+		signature := make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+		return signature, nil
+	default:
+		return nil, fmt.Errorf("unsupported ECDSA signature format %q", format)
+	}
+}
+
+// decodeECDSASignature decodes a DER or P1363 encoded signature into r and s. A
+// signature that is valid DER is taken as DER, otherwise a signature of twice the
+// byte length of the curve order is taken as P1363.
+func decodeECDSASignature(curve elliptic.Curve, signature []byte) (*big.Int, *big.Int, error) {
+	var sig ecdsaSignature
+	rest, err := asn1.Unmarshal(signature, &sig)
+	if err == nil && len(rest) == 0 && sig.R != nil && sig.S != nil {
+		return sig.R, sig.S, nil
+	}
+
+	size := curveByteSize(curve)
+	if len(signature) == 2*size {
+		return new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:]), nil
+	}
+
+	return nil, nil, ErrInvalidSignature
+}
+
+// curveByteSize returns the byte length of the curve order.
+func curveByteSize(curve elliptic.Curve) int {
+	return (curve.Params().N.BitLen() + 7) / 8
+}
@@ -0,0 +1,90 @@
+package signingCrypto
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+)
+
+func TestECDSASignatureRoundTrip(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		size := curveByteSize(curve)
+		// a small r needs left padding in P1363, a large s a leading zero byte in DER
+		r := big.NewInt(1)
+		s := new(big.Int).Sub(curve.Params().N, big.NewInt(1))
+
+		for _, format := range []ECDSAFormat{"", ECDSAFormatDER, ECDSAFormatP1363} {
+			signature, err := encodeECDSASignature(format, curve, r, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if format == ECDSAFormatP1363 {
+				if len(signature) != 2*size {
+					t.Errorf("%s P1363 signature has %d bytes, want %d", curve.Params().Name, len(signature), 2*size)
+				}
+			} else if _, err := asn1.Unmarshal(signature, &ecdsaSignature{}); err != nil {
+				t.Errorf("%s DER signature: %v", curve.Params().Name, err)
+			}
+
+			decodedR, decodedS, err := decodeECDSASignature(curve, signature)
+			if err != nil {
+				t.Fatalf("%s %q: %v", curve.Params().Name, format, err)
+			}
+			if decodedR.Cmp(r) != 0 || decodedS.Cmp(s) != 0 {
+				t.Errorf("%s %q: decoded (%X, %X), want (%X, %X)", curve.Params().Name, format, decodedR, decodedS, r, s)
+			}
+		}
+	}
+}
+
+func TestECDSASignatureP1363Padding(t *testing.T) {
+	signature, err := encodeECDSASignature(ECDSAFormatP1363, elliptic.P256(), big.NewInt(0x0102), big.NewInt(0x03))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]byte, 64)
+	want[30], want[31], want[63] = 0x01, 0x02, 0x03
+	if !bytes.Equal(signature, want) {
+		t.Errorf("signature = %X, want %X", signature, want)
+	}
+}
+
+func TestDecodeECDSASignatureRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		signature []byte
+	}{
+		{"empty", nil},
+		{"P1363 one byte short", make([]byte, 63)},
+		{"P1363 one byte long", make([]byte, 65)},
+		{"DER with trailing data", append(mustMarshal(t, ecdsaSignature{R: big.NewInt(1), S: big.NewInt(2)}), 0)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := decodeECDSASignature(elliptic.P256(), test.signature); err != ErrInvalidSignature {
+				t.Errorf("got %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestEncodeECDSASignatureUnknownFormat(t *testing.T) {
+	if _, err := encodeECDSASignature("JOSE", elliptic.P256(), big.NewInt(1), big.NewInt(2)); err == nil {
+		t.Error("unknown format encoded")
+	}
+}
+
+func mustMarshal(t *testing.T, value interface{}) []byte {
+	t.Helper()
+
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
@@ -0,0 +1,79 @@
+package signingCrypto
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+)
+
+// Ed25519KeyPair is a DTO that holds Ed25519 private and public keys.
+type Ed25519KeyPair struct {
+	Public  ed25519.PublicKey
+	Private ed25519.PrivateKey
+}
+
+// Ed25519Marshaler can encode and decode an Ed25519 key pair.
+type Ed25519Marshaler struct{}
+
+// NewEd25519Marshaler creates a new Ed25519Marshaler.
+func NewEd25519Marshaler() Ed25519Marshaler {
+	return Ed25519Marshaler{}
+}
+
+// Encode takes an Ed25519KeyPair and encodes it to be written on disk.
+// It returns the public and the private key as a byte slice, the private key as PKCS#8.
+func (m Ed25519Marshaler) Encode(keyPair Ed25519KeyPair) ([]byte, []byte, error) {
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(keyPair.Private)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encodedPublic, err := m.EncodePublic(keyPair.Public)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encodedPrivate := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	})
+
+	return encodedPublic, encodedPrivate, nil
+}
+
+// EncodePublic encodes an Ed25519 public key as PEM wrapped SubjectPublicKeyInfo.
+func (m Ed25519Marshaler) EncodePublic(publicKey ed25519.PublicKey) ([]byte, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	}), nil
+}
+
+// Decode assembles an Ed25519KeyPair from an encoded PKCS#8 private key.
+func (m Ed25519Marshaler) Decode(privateKeyBytes []byte) (*Ed25519KeyPair, error) {
+	block, _ := pem.Decode(privateKeyBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found in Ed25519 private key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("PKCS#8 key is not an Ed25519 private key")
+	}
+
+	return &Ed25519KeyPair{
+		Private: privateKey,
+		Public:  privateKey.Public().(ed25519.PublicKey),
+	}, nil
+}
@@ -0,0 +1,20 @@
+package signingCrypto
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+)
+
+// Fingerprint returns the hex encoded SHA-256 digest of the DER encoded
+// SubjectPublicKeyInfo of the public key.
+func Fingerprint(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:]), nil
+}
@@ -2,18 +2,26 @@ package signingCrypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 )
 
-// RSAGenerator generates a RSA key pair.
-type RSAGenerator struct{}
+// RSAGenerator generates a RSA key pair of Bits size, 2048 bits if Bits is zero.
+type RSAGenerator struct {
+	Bits int
+}
 
 // Generate generates a new RSAKeyPair.
 func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
 	// Security has been ignored for the sake of simplicity.
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	bits := g.Bits
+	if bits == 0 {
+		bits = 2048
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		return nil, err
 	}
@@ -24,13 +32,20 @@ func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
 	}, nil
 }
 
-// ECCGenerator generates an ECC key pair.
-type ECCGenerator struct{}
+// ECCGenerator generates an ECC key pair on Curve, P-384 if Curve is nil.
+type ECCGenerator struct {
+	Curve elliptic.Curve
+}
 
 // Generate generates a new ECCKeyPair.
 func (g *ECCGenerator) Generate() (*ECCKeyPair, error) {
 	// Security has been ignored for the sake of simplicity.
-	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	curve := g.Curve
+	if curve == nil {
+		curve = elliptic.P384()
+	}
+
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
 		return nil, err
 	}
@@ -40,3 +55,19 @@ func (g *ECCGenerator) Generate() (*ECCKeyPair, error) {
 		Private: key,
 	}, nil
 }
+
+// Ed25519Generator generates an Ed25519 key pair.
+type Ed25519Generator struct{}
+
+// Generate generates a new Ed25519KeyPair.
+func (g *Ed25519Generator) Generate() (*Ed25519KeyPair, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ed25519KeyPair{
+		Public:  public,
+		Private: private,
+	}, nil
+}
@@ -0,0 +1,107 @@
+package signingCrypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWK is a JSON Web Key (RFC 7517) holding a public signing key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// NewJWK builds the JWK of a public key. The key id is the RFC 7638 thumbprint
+// of the key, so it is stable for the lifetime of the key. The alg member is
+// left out if the signature parameters have no registered JWS algorithm.
+func NewJWK(publicKey crypto.PublicKey, params SignatureParameters) (*JWK, error) {
+	var jwk JWK
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk = JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		params := key.Curve.Params()
+		size := (params.BitSize + 7) / 8
+		jwk = JWK{
+			Kty: "EC",
+			Crv: params.Name,
+			X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+			Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+		}
+	case ed25519.PublicKey:
+		jwk = JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}
+	default:
+		return nil, errors.New("jwk: unsupported public key type")
+	}
+
+	jwk.Use = "sig"
+	jwk.Alg = JWSAlgorithm(publicKey, params)
+	jwk.Kid = jwk.Thumbprint()
+
+	return &jwk, nil
+}
+
+// JWSAlgorithm returns the JWS algorithm name (RFC 7518) of signatures made with the
+// key and signature parameters, or an empty string if there is none. ECDSA names
+// are only registered for the digest matching the curve, e.g. ES384 for P-384.
+func JWSAlgorithm(publicKey crypto.PublicKey, params SignatureParameters) string {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		params = params.rsaParameters()
+		if params.Padding == RSAPaddingPKCS1v15 {
+			return fmt.Sprintf("RS%d", params.Hash.Size()*8)
+		}
+		return fmt.Sprintf("PS%d", params.Hash.Size()*8)
+	case *ecdsa.PublicKey:
+		hash := params.eccHash(key.Curve)
+		if hash != hashForCurve(key.Curve) {
+			return ""
+		}
+		return fmt.Sprintf("ES%d", hash.Size()*8)
+	case ed25519.PublicKey:
+		return "EdDSA"
+	default:
+		return ""
+	}
+}
+
+// Thumbprint returns the base64url encoded SHA-256 JWK thumbprint (RFC 7638).
+// Only the required members are hashed, in lexicographic order.
+func (k *JWK) Thumbprint() string {
+	var canonical string
+
+	switch k.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, k.E, k.Kty, k.N)
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, k.Crv, k.Kty, k.X, k.Y)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, k.Crv, k.Kty, k.X)
+	}
+
+	digest := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
@@ -0,0 +1,70 @@
+package signingCrypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+)
+
+// rfc7638Modulus is the modulus of the RSA key of the RFC 7638 section 3.1 example
+const rfc7638Modulus = "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJEC" +
+	"PebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368Q" +
+	"QMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcR" +
+	"wr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"
+
+func decodeBase64URL(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid base64url %q", s)
+	}
+	return b
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  JWK
+		want string
+	}{
+		// RFC 7638 section 3.1
+		{"RSA", JWK{Kty: "RSA", N: rfc7638Modulus, E: "AQAB", Alg: "RS256", Kid: "2011-04-29"}, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"},
+		// RFC 8037 appendix A.3
+		{"Ed25519", JWK{Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.jwk.Thumbprint(); got != test.want {
+				t.Errorf("Thumbprint() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+// TestNewJWK builds the JWKs of the example keys, their key id is the thumbprint of the examples
+func TestNewJWK(t *testing.T) {
+	rsaKey := &rsa.PublicKey{N: new(big.Int).SetBytes(decodeBase64URL(t, rfc7638Modulus)), E: 65537}
+	jwk, err := NewJWK(rsaKey, SignatureParameters{Padding: RSAPaddingPKCS1v15})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwk.N != rfc7638Modulus || jwk.E != "AQAB" || jwk.Alg != "RS256" || jwk.Use != "sig" {
+		t.Errorf("RSA JWK = %+v", *jwk)
+	}
+	if jwk.Kid != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("RSA key id = %s", jwk.Kid)
+	}
+
+	edKey := ed25519.PublicKey(decodeBase64URL(t, "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"))
+	jwk, err = NewJWK(edKey, SignatureParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwk.Alg != "EdDSA" || jwk.Kid != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Errorf("Ed25519 JWK = %+v", *jwk)
+	}
+}
@@ -0,0 +1,37 @@
+package signingCrypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// JWSHeader is the protected header of a JWS (RFC 7515).
+type JWSHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// SignJWS returns the JWS compact serialization of the payload. The signer must
+// produce signatures of the header algorithm, for ECDSA in ECDSAFormatP1363.
+func SignJWS(signer Signer, header JWSHeader, payload []byte) (string, error) {
+	if header.Alg == "" {
+		return "", errors.New("jws: algorithm is missing")
+	}
+
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerBytes) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+
+	signature, err := signer.Sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,90 @@
+package signingCrypto
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"fmt"
+)
+
+// RSAPadding is the padding scheme of RSA signatures.
+type RSAPadding string
+
+const (
+	RSAPaddingPSS      RSAPadding = "PSS"
+	RSAPaddingPKCS1v15 RSAPadding = "PKCS1v15"
+)
+
+// SignatureParameters select the digest and RSA padding of signers and verifiers.
+// The zero value selects the defaults: RSA-PSS over SHA-256 for RSA keys and the
+// digest matching the curve size, random nonces and DER encoding for ECDSA keys.
+// Ed25519 ignores them.
+type SignatureParameters struct {
+	Hash    crypto.Hash
+	Padding RSAPadding
+	// Deterministic selects RFC 6979 nonces for ECDSA signatures
+	Deterministic bool
+	// Format is the encoding of ECDSA signatures, verifiers accept both
+	Format ECDSAFormat
+}
+
+// ParseSignatureParameters parses the hash name (SHA-256, SHA-384, SHA-512) and the
+// RSA padding (PSS, PKCS1v15). Empty names select the defaults.
+func ParseSignatureParameters(hashName string, padding string) (SignatureParameters, error) {
+	var params SignatureParameters
+
+	switch hashName {
+	case "":
+	case "SHA-256":
+		params.Hash = crypto.SHA256
+	case "SHA-384":
+		params.Hash = crypto.SHA384
+	case "SHA-512":
+		params.Hash = crypto.SHA512
+	default:
+		return params, fmt.Errorf("unsupported hash %q", hashName)
+	}
+
+	switch RSAPadding(padding) {
+	case "", RSAPaddingPSS, RSAPaddingPKCS1v15:
+		params.Padding = RSAPadding(padding)
+	default:
+		return params, fmt.Errorf("unsupported RSA padding %q", padding)
+	}
+
+	return params, nil
+}
+
+// ParseCurve returns the NIST curve of the given name (P-256, P-384, P-521).
+func ParseCurve(name string) (elliptic.Curve, error) {
+	switch name {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", name)
+	}
+}
+
+// rsaParameters applies the RSA defaults to the parameters.
+func (p SignatureParameters) rsaParameters() SignatureParameters {
+	if p.Hash == 0 {
+		p.Hash = crypto.SHA256
+	}
+	if p.Padding == "" {
+		p.Padding = RSAPaddingPSS
+	}
+
+	return p
+}
+
+// eccHash returns the digest of the parameters, or the digest matching the curve.
+func (p SignatureParameters) eccHash(curve elliptic.Curve) crypto.Hash {
+	if p.Hash == 0 {
+		return hashForCurve(curve)
+	}
+
+	return p.Hash
+}
@@ -0,0 +1,220 @@
+package signingCrypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// maxPBKDF2Iterations bounds the key derivation work an imported key or a backup can ask
+// for, a request must not be able to keep the service busy for minutes
+const maxPBKDF2Iterations = 1000000
+
+// encryptedPrivateKeyInfo is the PKCS#8 EncryptedPrivateKeyInfo (RFC 5958)
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Parameters are the PBES2-params of RFC 8018
+type pbes2Parameters struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Parameters are the PBKDF2-params of RFC 8018, the PRF defaults to HMAC-SHA1
+type pbkdf2Parameters struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// ParsePrivateKey parses a PEM encoded private key in PKCS#8 ("PRIVATE KEY"), PKCS#1
+// ("RSA PRIVATE KEY") or SEC1 ("EC PRIVATE KEY") form. Password protected keys, PKCS#8
+// "ENCRYPTED PRIVATE KEY" with PBES2 or PEM blocks with the legacy Proc-Type encryption
+// header, are decrypted with the password. A wrong password returns x509.IncorrectPasswordError.
+func ParsePrivateKey(privateKeyPEM []byte, password []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM block found in private key")
+	}
+
+	der := block.Bytes
+	encrypted := block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block)
+	if encrypted && len(password) == 0 {
+		return nil, errors.New("private key is encrypted, a password is required")
+	}
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		var err error
+		if der, err = decryptPKCS8(block.Bytes, password); err != nil {
+			return nil, err
+		}
+		block.Type = "PRIVATE KEY"
+	} else if encrypted {
+		//The legacy PEM encryption is weak, it is only accepted to import keys of older tools
+		var err error
+		if der, err = x509.DecryptPEMBlock(block, password); err != nil {
+			return nil, err
+		}
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(der)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(der)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(der)
+	default:
+		return nil, fmt.Errorf("unsupported private key PEM block %q", block.Type)
+	}
+	if err != nil && encrypted {
+		//A wrong password may still decrypt to valid padding
+		return nil, x509.IncorrectPasswordError
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	return signer, nil
+}
+
+// decryptPKCS8 decrypts a PKCS#8 EncryptedPrivateKeyInfo protected with PBES2, PBKDF2 and AES-CBC
+func decryptPKCS8(der []byte, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) != 0 {
+		return nil, errors.New("malformed encrypted private key")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption %v, only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Parameters
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.New("malformed PBES2 parameters")
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation %v, only PBKDF2 is supported", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Parameters
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, errors.New("malformed PBKDF2 parameters")
+	}
+	if kdf.IterationCount < 1 || kdf.IterationCount > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("unsupported PBKDF2 iteration count %d", kdf.IterationCount)
+	}
+
+	var prf func() hash.Hash
+	switch algorithm := kdf.PRF.Algorithm; {
+	case len(algorithm) == 0, algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case algorithm.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 PRF %v", algorithm)
+	}
+
+	var keyLength int
+	switch algorithm := params.EncryptionScheme.Algorithm; {
+	case algorithm.Equal(oidAES128CBC):
+		keyLength = 16
+	case algorithm.Equal(oidAES192CBC):
+		keyLength = 24
+	case algorithm.Equal(oidAES256CBC):
+		keyLength = 32
+	default:
+		return nil, fmt.Errorf("unsupported private key cipher %v, only AES-CBC is supported", algorithm)
+	}
+	if kdf.KeyLength != 0 && kdf.KeyLength != keyLength {
+		return nil, errors.New("PBKDF2 key length does not match the cipher")
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("malformed AES-CBC parameters")
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, errors.New("malformed encrypted private key")
+	}
+
+	block, err := aes.NewCipher(pbkdf2(password, kdf.Salt, kdf.IterationCount, keyLength, prf))
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, info.EncryptedData)
+
+	//A wrong password shows as broken padding
+	padding := int(plaintext[len(plaintext)-1])
+	if padding < 1 || padding > aes.BlockSize || !bytes.Equal(plaintext[len(plaintext)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, x509.IncorrectPasswordError
+	}
+
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// pbkdf2 derives a key of keyLength bytes from the password (RFC 8018, section 5.2)
+func pbkdf2(password []byte, salt []byte, iterations int, keyLength int, prf func() hash.Hash) []byte {
+	mac := hmac.New(prf, password)
+	key := make([]byte, 0, keyLength+mac.Size())
+
+	for blockIndex := uint32(1); len(key) < keyLength; blockIndex++ {
+		mac.Reset()
+		mac.Write(salt)
+		binary.Write(mac, binary.BigEndian, blockIndex)
+		u := mac.Sum(nil)
+
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+
+	return key[:keyLength]
+}
@@ -0,0 +1,107 @@
+package signingCrypto
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// The encrypted keys in testdata were written by
+//
+//	openssl pkcs8 -topk8 -v2 aes-256-cbc -in <key>.pem -out <key>-aes256.pem -passout pass:correct-horse
+//	openssl pkcs8 -topk8 -v2 aes-128-cbc -v2prf hmacWithSHA512 -in ec.pem -out ec-aes128-sha512.pem -passout pass:correct-horse
+//	openssl pkcs8 -topk8 -v2 aes-256-cbc -iter 2000000 -in ec.pem -out ec-iter.pem -passout pass:correct-horse
+const testKeyPassword = "correct-horse"
+
+func readTestData(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParsePrivateKeyEncryptedPKCS8(t *testing.T) {
+	tests := []struct {
+		name      string
+		plain     string
+		encrypted string
+	}{
+		{"RSA AES-256-CBC HMAC-SHA256", "rsa.pem", "rsa-aes256.pem"},
+		{"ECC AES-256-CBC HMAC-SHA256", "ec.pem", "ec-aes256.pem"},
+		{"ECC AES-128-CBC HMAC-SHA512", "ec.pem", "ec-aes128-sha512.pem"},
+		{"Ed25519 AES-256-CBC HMAC-SHA256", "ed25519.pem", "ed25519-aes256.pem"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want, err := ParsePrivateKey(readTestData(t, test.plain), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ParsePrivateKey(readTestData(t, test.encrypted), []byte(testKeyPassword))
+			if err != nil {
+				t.Fatalf("ParsePrivateKey: %v", err)
+			}
+			if !got.(interface{ Equal(crypto.PrivateKey) bool }).Equal(want) {
+				t.Error("decrypted key does not match the plaintext key")
+			}
+		})
+	}
+}
+
+func TestParsePrivateKeyWrongPassword(t *testing.T) {
+	for _, name := range []string{"rsa-aes256.pem", "ec-aes256.pem", "ed25519-aes256.pem"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParsePrivateKey(readTestData(t, name), []byte("wrong-horse"))
+			if !errors.Is(err, x509.IncorrectPasswordError) {
+				t.Errorf("got %v, want %v", err, x509.IncorrectPasswordError)
+			}
+		})
+	}
+}
+
+func TestParsePrivateKeyMissingPassword(t *testing.T) {
+	if _, err := ParsePrivateKey(readTestData(t, "ec-aes256.pem"), nil); err == nil {
+		t.Error("encrypted key parsed without a password")
+	}
+}
+
+func TestParsePrivateKeyIterationLimit(t *testing.T) {
+	_, err := ParsePrivateKey(readTestData(t, "ec-iter.pem"), []byte(testKeyPassword))
+	if err == nil || errors.Is(err, x509.IncorrectPasswordError) {
+		t.Errorf("got %v, want the iteration count to be rejected", err)
+	}
+}
+
+// TestPBKDF2 checks the PBKDF2-HMAC-SHA1 vectors of RFC 6070
+func TestPBKDF2(t *testing.T) {
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		keyLength  int
+		want       string
+	}{
+		{"password", "salt", 1, 20, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{"password", "salt", 2, 20, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{"password", "salt", 4096, 20, "4b007901b765489abead49d926f721d065a429c1"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 25, "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+		{"pass\x00word", "sa\x00lt", 4096, 16, "56fa6aa75548099dcc37d7f03425e0c3"},
+	}
+
+	for _, test := range tests {
+		got := hex.EncodeToString(pbkdf2([]byte(test.password), []byte(test.salt), test.iterations, test.keyLength, sha1.New))
+		if got != test.want {
+			t.Errorf("pbkdf2(%q, %q, %d) = %s, want %s", test.password, test.salt, test.iterations, got, test.want)
+		}
+	}
+}
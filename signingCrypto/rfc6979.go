@@ -0,0 +1,132 @@
+package signingCrypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"errors"
+	"math/big"
+)
+
+// signDeterministic signs the digest with ECDSA using the nonce derived from the
+// private key and the digest as specified in RFC 6979 section 3.2, with HMAC over
+// the signing hash. Signing the same data with the same key always returns the
+// same signature. The signature is returned as r and s.
+//
+// The scalar arithmetic uses math/big, which is not constant time.
+func signDeterministic(privateKey *ecdsa.PrivateKey, hash crypto.Hash, digest []byte) (*big.Int, *big.Int, error) {
+	curve := privateKey.Curve
+	n := curve.Params().N
+	if n.Sign() == 0 {
+		return nil, nil, errors.New("ecc signer: curve has no order")
+	}
+
+	e := bitsToInt(digest, n)
+	nonces := newNonceGenerator(hash, n, privateKey.D, digest)
+
+	for {
+		k := nonces.next()
+
+		x, _ := curve.ScalarBaseMult(k.Bytes())
+		r := new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		kInv := new(big.Int).ModInverse(k, n)
+		s := new(big.Int).Mul(r, privateKey.D)
+		s.Add(s, e)
+		s.Mul(s, kInv)
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+
+		return r, s, nil
+	}
+}
+
+// nonceGenerator is the HMAC_DRBG of RFC 6979 section 3.2 steps b to h.
+type nonceGenerator struct {
+	hash crypto.Hash
+	n    *big.Int
+	k    []byte
+	v    []byte
+	used bool
+}
+
+func newNonceGenerator(hash crypto.Hash, n *big.Int, x *big.Int, digest []byte) *nonceGenerator {
+	size := hash.Size()
+	g := &nonceGenerator{
+		hash: hash,
+		n:    n,
+		k:    make([]byte, size),
+		v:    make([]byte, size),
+	}
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+
+	seed := append(intToOctets(x, n), bitsToOctets(digest, n)...)
+
+	g.k = g.mac(g.k, g.v, []byte{0x00}, seed)
+	g.v = g.mac(g.k, g.v)
+	g.k = g.mac(g.k, g.v, []byte{0x01}, seed)
+	g.v = g.mac(g.k, g.v)
+
+	return g
+}
+
+// next returns the next nonce candidate in [1, n-1]. Every call after the first
+// reseeds the generator as step h.3 requires for rejected candidates.
+func (g *nonceGenerator) next() *big.Int {
+	for {
+		if g.used {
+			g.k = g.mac(g.k, g.v, []byte{0x00})
+			g.v = g.mac(g.k, g.v)
+		}
+		g.used = true
+
+		var t []byte
+		for len(t)*8 < g.n.BitLen() {
+			g.v = g.mac(g.k, g.v)
+			t = append(t, g.v...)
+		}
+
+		k := bitsToInt(t, g.n)
+		if k.Sign() > 0 && k.Cmp(g.n) < 0 {
+			return k
+		}
+	}
+}
+
+func (g *nonceGenerator) mac(key []byte, data ...[]byte) []byte {
+	h := hmac.New(g.hash.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// bitsToInt takes the leftmost bits of b as an integer, as many as the bit length of n.
+func bitsToInt(b []byte, n *big.Int) *big.Int {
+	v := new(big.Int).SetBytes(b)
+	if excess := len(b)*8 - n.BitLen(); excess > 0 {
+		v.Rsh(v, uint(excess))
+	}
+	return v
+}
+
+// intToOctets encodes v big endian in the byte length of n.
+func intToOctets(v *big.Int, n *big.Int) []byte {
+	return v.FillBytes(make([]byte, (n.BitLen()+7)/8))
+}
+
+// bitsToOctets reduces the leftmost bits of b modulo n and encodes them in the byte length of n.
+func bitsToOctets(b []byte, n *big.Int) []byte {
+	v := bitsToInt(b, n)
+	if v.Cmp(n) >= 0 {
+		v.Sub(v, n)
+	}
+	return intToOctets(v, n)
+}
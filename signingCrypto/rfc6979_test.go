@@ -0,0 +1,162 @@
+package signingCrypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"math/big"
+	"testing"
+)
+
+// rfc6979Vector is a test vector of RFC 6979 appendix A.2
+type rfc6979Vector struct {
+	name    string
+	curve   elliptic.Curve
+	hash    crypto.Hash
+	x       string
+	message string
+	k       string
+	r       string
+	s       string
+}
+
+var rfc6979Vectors = []rfc6979Vector{
+	// A.2.5, ECDSA 256 bits (prime field)
+	{
+		name:    "P-256 SHA-256 sample",
+		curve:   elliptic.P256(),
+		hash:    crypto.SHA256,
+		x:       "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+		message: "sample",
+		k:       "A6E3C57DD01ABE90086538398355DD4C3B17AA873382B0F24D6129493D8AAD60",
+		r:       "EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+		s:       "F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+	},
+	{
+		name:    "P-256 SHA-256 test",
+		curve:   elliptic.P256(),
+		hash:    crypto.SHA256,
+		x:       "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+		message: "test",
+		k:       "D16B6AE827F17175E040871A1C7EC3500192C4C92677336EC2537ACAEE0008E0",
+		r:       "F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+		s:       "019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+	},
+	// A.2.7, ECDSA 521 bits (prime field)
+	{
+		name:    "P-521 SHA-512 sample",
+		curve:   elliptic.P521(),
+		hash:    crypto.SHA512,
+		x:       "0FAD06DAA62BA3B25D2FB40133DA757205DE67F5BB0018FEE8C86E1B68C7E75CAA896EB32F1F47C70855836A6D16FCC1466F6D8FBEC67DB89EC0C08B0E996B83538",
+		message: "sample",
+		k:       "1DAE2EA071F8110DC26882D4D5EAE0621A3256FC8847FB9022E2B7D28E6F10198B1574FDD03A9053C08A1854A168AA5A57470EC97DD5CE090124EF52A2F7ECBFFD3",
+		r:       "0C328FAFCBD79DD77850370C46325D987CB525569FB63C5D3BC53950E6D4C5F174E25A1EE9017B5D450606ADD152B534931D7D4E8455CC91F9B15BF05EC36E377FA",
+		s:       "0617CCE7CF5064806C467F678D3B4080D6F1CC50AF26CA209417308281B68AF282623EAA63E5B5C0723D8B8C37FF0777B1A20F8CCB1DCCC43997F1EE0E44DA4A67A",
+	},
+	{
+		name:    "P-521 SHA-512 test",
+		curve:   elliptic.P521(),
+		hash:    crypto.SHA512,
+		x:       "0FAD06DAA62BA3B25D2FB40133DA757205DE67F5BB0018FEE8C86E1B68C7E75CAA896EB32F1F47C70855836A6D16FCC1466F6D8FBEC67DB89EC0C08B0E996B83538",
+		message: "test",
+		k:       "16200813020EC986863BEDFC1B121F605C1215645018AEA1A7B215A564DE9EB1B38A67AA1128B80CE391C4FB71187654AAA3431027BFC7F395766CA988C964DC56D",
+		r:       "13E99020ABF5CEE7525D16B69B229652AB6BDF2AFFCAEF38773B4B7D08725F10CDB93482FDCC54EDCEE91ECA4166B2A7C6265EF0CE2BD7051B7CEF945BABD47EE6D",
+		s:       "1FBD0013C674AA79CB39849527916CE301C66EA7CE8B80682786AD60F98F7E78A19CA69EFF5C57400E3B3A0AD66CE0978214D13BAF4E9AC60752F7B155E2DE4DCE3",
+	},
+}
+
+func fromHex(t *testing.T, s string) *big.Int {
+	t.Helper()
+
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("invalid hex %q", s)
+	}
+	return v
+}
+
+// rfc6979Key returns the key pair of the private key x on the curve
+func rfc6979Key(t *testing.T, curve elliptic.Curve, x string) *ecdsa.PrivateKey {
+	t.Helper()
+
+	privateKey := &ecdsa.PrivateKey{D: fromHex(t, x)}
+	privateKey.Curve = curve
+	privateKey.X, privateKey.Y = curve.ScalarBaseMult(privateKey.D.Bytes())
+	return privateKey
+}
+
+func TestRFC6979Nonce(t *testing.T) {
+	for _, vector := range rfc6979Vectors {
+		t.Run(vector.name, func(t *testing.T) {
+			privateKey := rfc6979Key(t, vector.curve, vector.x)
+			digest, err := hashData(vector.hash, []byte(vector.message))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			k := newNonceGenerator(vector.hash, vector.curve.Params().N, privateKey.D, digest).next()
+			if want := fromHex(t, vector.k); k.Cmp(want) != 0 {
+				t.Errorf("k = %X, want %X", k, want)
+			}
+		})
+	}
+}
+
+func TestRFC6979Signature(t *testing.T) {
+	for _, vector := range rfc6979Vectors {
+		t.Run(vector.name, func(t *testing.T) {
+			privateKey := rfc6979Key(t, vector.curve, vector.x)
+			digest, err := hashData(vector.hash, []byte(vector.message))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, s, err := signDeterministic(privateKey, vector.hash, digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := fromHex(t, vector.r); r.Cmp(want) != 0 {
+				t.Errorf("r = %X, want %X", r, want)
+			}
+			if want := fromHex(t, vector.s); s.Cmp(want) != 0 {
+				t.Errorf("s = %X, want %X", s, want)
+			}
+		})
+	}
+}
+
+// TestECCSignerDeterministic checks that deterministic ECC signers sign the vectors with
+// the RFC 6979 signature and that their verifier accepts it
+func TestECCSignerDeterministic(t *testing.T) {
+	for _, vector := range rfc6979Vectors {
+		t.Run(vector.name, func(t *testing.T) {
+			privateKey := rfc6979Key(t, vector.curve, vector.x)
+			params := SignatureParameters{Hash: vector.hash, Deterministic: true, Format: ECDSAFormatP1363}
+			signer, err := NewECCSigner(&ECCKeyPair{Public: &privateKey.PublicKey, Private: privateKey}, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signature, err := signer.Sign([]byte(vector.message))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := encodeECDSASignature(ECDSAFormatP1363, vector.curve, fromHex(t, vector.r), fromHex(t, vector.s))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(signature, want) {
+				t.Errorf("signature = %X, want %X", signature, want)
+			}
+
+			verifier, err := NewECCVerifier(&privateKey.PublicKey, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verifier.Verify([]byte(vector.message), signature); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 )
 
 // RSAKeyPair is a DTO that holds RSA private and public keys.
@@ -24,24 +25,40 @@ func NewRSAMarshaler() RSAMarshaler {
 // It returns the public and the private key as a byte slice.
 func (m *RSAMarshaler) Marshal(keyPair RSAKeyPair) ([]byte, []byte, error) {
 	privateKeyBytes := x509.MarshalPKCS1PrivateKey(keyPair.Private)
-	publicKeyBytes := x509.MarshalPKCS1PublicKey(keyPair.Public)
 
 	encodedPrivate := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA_PRIVATE_KEY",
+		Type:  "RSA PRIVATE KEY",
 		Bytes: privateKeyBytes,
 	})
 
-	encodePublic := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA_PUBLIC_KEY",
-		Bytes: publicKeyBytes,
-	})
+	encodePublic, err := m.MarshalPublic(keyPair.Public)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	return encodePublic, encodedPrivate, nil
 }
 
+// MarshalPublic encodes an RSA public key as PEM wrapped SubjectPublicKeyInfo.
+func (m *RSAMarshaler) MarshalPublic(publicKey *rsa.PublicKey) ([]byte, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	}), nil
+}
+
 // Unmarshal takes an encoded RSA private key and transforms it into a rsa.PrivateKey.
 func (m *RSAMarshaler) Unmarshal(privateKeyBytes []byte) (*RSAKeyPair, error) {
 	block, _ := pem.Decode(privateKeyBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found in RSA private key")
+	}
+
 	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
 	if err != nil {
 		return nil, err
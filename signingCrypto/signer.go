@@ -1,9 +1,143 @@
 package signingCrypto
 
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"errors"
+	"math/big"
+)
+
 // Signer defines a contract for different types of signing implementations.
 type Signer interface {
-	RSASign(dataToBeSigned []byte) ([]byte, error)
-	ECCSign(dataToBeSigned []byte) ([]byte, error)
+	Sign(dataToBeSigned []byte) ([]byte, error)
+}
+
+// RSASigner signs data with an RSA private key using RSA-PSS or PKCS#1 v1.5,
+// over SHA-256 unless the signature parameters select another digest.
+type RSASigner struct {
+	keyPair *RSAKeyPair
+	params  SignatureParameters
+}
+
+// NewRSASigner creates a new RSASigner for the given key pair.
+func NewRSASigner(keyPair *RSAKeyPair, params SignatureParameters) (*RSASigner, error) {
+	if keyPair == nil || keyPair.Private == nil {
+		return nil, errors.New("rsa signer: private key is missing")
+	}
+
+	return &RSASigner{keyPair: keyPair, params: params.rsaParameters()}, nil
+}
+
+// Sign hashes the data and signs the digest with the configured RSA padding.
+func (s *RSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
+	digest, err := hashData(s.params.Hash, dataToBeSigned)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.params.Padding == RSAPaddingPKCS1v15 {
+		return rsa.SignPKCS1v15(rand.Reader, s.keyPair.Private, s.params.Hash, digest)
+	}
+
+	return rsa.SignPSS(rand.Reader, s.keyPair.Private, s.params.Hash, digest, &rsa.PSSOptions{
+		SaltLength: rsa.PSSSaltLengthEqualsHash,
+	})
+}
+
+// ECCSigner signs data with an ECDSA private key. Unless the signature parameters
+// select a digest, it is chosen to match the curve size (SHA-384 for the default
+// P-384 device keys). Nonces are random unless the signature parameters select
+// deterministic nonces (RFC 6979). The signature is returned ASN.1 DER encoded,
+// or as fixed width r||s if the parameters select ECDSAFormatP1363.
+type ECCSigner struct {
+	keyPair       *ECCKeyPair
+	hash          crypto.Hash
+	deterministic bool
+	format        ECDSAFormat
+}
+
+// NewECCSigner creates a new ECCSigner for the given key pair.
+func NewECCSigner(keyPair *ECCKeyPair, params SignatureParameters) (*ECCSigner, error) {
+	if keyPair == nil || keyPair.Private == nil {
+		return nil, errors.New("ecc signer: private key is missing")
+	}
+	if keyPair.Private.Curve == nil {
+		return nil, errors.New("ecc signer: private key has no curve")
+	}
+
+	return &ECCSigner{
+		keyPair:       keyPair,
+		hash:          params.eccHash(keyPair.Private.Curve),
+		deterministic: params.Deterministic,
+		format:        params.Format,
+	}, nil
 }
 
-// TODO: implement RSA and ECDSA signing ...
+// Sign hashes the data and signs the digest with ECDSA.
+func (s *ECCSigner) Sign(dataToBeSigned []byte) ([]byte, error) {
+	digest, err := hashData(s.hash, dataToBeSigned)
+	if err != nil {
+		return nil, err
+	}
+
+	var r, sig *big.Int
+	if s.deterministic {
+		r, sig, err = signDeterministic(s.keyPair.Private, s.hash, digest)
+	} else {
+		r, sig, err = ecdsa.Sign(rand.Reader, s.keyPair.Private, digest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeECDSASignature(s.format, s.keyPair.Private.Curve, r, sig)
+}
+
+// Ed25519Signer signs data with an Ed25519 private key. Ed25519 hashes the
+// message itself, so the data is signed as is.
+type Ed25519Signer struct {
+	keyPair *Ed25519KeyPair
+}
+
+// NewEd25519Signer creates a new Ed25519Signer for the given key pair.
+func NewEd25519Signer(keyPair *Ed25519KeyPair) (*Ed25519Signer, error) {
+	if keyPair == nil || len(keyPair.Private) != ed25519.PrivateKeySize {
+		return nil, errors.New("ed25519 signer: private key is missing")
+	}
+
+	return &Ed25519Signer{keyPair: keyPair}, nil
+}
+
+// Sign signs the data with Ed25519.
+func (s *Ed25519Signer) Sign(dataToBeSigned []byte) ([]byte, error) {
+	return ed25519.Sign(s.keyPair.Private, dataToBeSigned), nil
+}
+
+// hashForCurve returns the hash function whose output size matches the curve order.
+func hashForCurve(curve elliptic.Curve) crypto.Hash {
+	switch curve.Params().BitSize {
+	case 521:
+		return crypto.SHA512
+	case 384:
+		return crypto.SHA384
+	default:
+		return crypto.SHA256
+	}
+}
+
+// hashData returns the digest of data using the given hash function.
+func hashData(hash crypto.Hash, data []byte) ([]byte, error) {
+	if !hash.Available() {
+		return nil, errors.New("hash function is not available")
+	}
+
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil), nil
+}
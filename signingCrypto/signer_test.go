@@ -0,0 +1,112 @@
+package signingCrypto
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"errors"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	rsaKeyPair, err := (&RSAGenerator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKeyPair, err := (&Ed25519Generator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testCase struct {
+		name     string
+		signer   Signer
+		verifier Verifier
+	}
+	var tests []testCase
+
+	for _, padding := range []RSAPadding{RSAPaddingPSS, RSAPaddingPKCS1v15} {
+		for _, hash := range []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+			params := SignatureParameters{Hash: hash, Padding: padding}
+			signer, err := NewRSASigner(rsaKeyPair, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier, err := NewVerifier(rsaKeyPair.Public, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tests = append(tests, testCase{"RSA " + string(padding) + " " + hash.String(), signer, verifier})
+		}
+	}
+
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		keyPair, err := (&ECCGenerator{Curve: curve}).Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, format := range []ECDSAFormat{ECDSAFormatDER, ECDSAFormatP1363} {
+			params := SignatureParameters{Format: format}
+			signer, err := NewECCSigner(keyPair, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier, err := NewVerifier(keyPair.Public, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tests = append(tests, testCase{"ECC " + curve.Params().Name + " " + string(format), signer, verifier})
+		}
+	}
+
+	edSigner, err := NewEd25519Signer(edKeyPair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edVerifier, err := NewVerifier(edKeyPair.Public, SignatureParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests = append(tests, testCase{"Ed25519", edSigner, edVerifier})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := []byte("1_transaction_ZGV2aWNl")
+			signature, err := test.signer.Sign(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := test.verifier.Verify(data, signature); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+			if err := test.verifier.Verify([]byte("1_transaction_ZGV2aWNm"), signature); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("other data: got %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+// TestRSAVerifierPaddingMismatch checks that a signature only verifies with the padding it was made with
+func TestRSAVerifierPaddingMismatch(t *testing.T) {
+	keyPair, err := (&RSAGenerator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("transaction")
+	signer, _ := NewRSASigner(keyPair, SignatureParameters{Hash: crypto.SHA256, Padding: RSAPaddingPSS})
+	signature, err := signer.Sign(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, _ := NewRSAVerifier(keyPair.Public, SignatureParameters{Hash: crypto.SHA256, Padding: RSAPaddingPKCS1v15})
+	if err := verifier.Verify(data, signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("PSS signature with a PKCS#1 v1.5 verifier: got %v, want %v", err, ErrInvalidSignature)
+	}
+
+	verifier, _ = NewRSAVerifier(keyPair.Public, SignatureParameters{Hash: crypto.SHA384, Padding: RSAPaddingPSS})
+	if err := verifier.Verify(data, signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("SHA-256 signature with a SHA-384 verifier: got %v, want %v", err, ErrInvalidSignature)
+	}
+}
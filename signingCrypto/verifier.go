@@ -0,0 +1,141 @@
+package signingCrypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+)
+
+// ErrInvalidSignature is returned when a signature does not match the signed data.
+var ErrInvalidSignature = errors.New("signature does not match the signed data")
+
+// Verifier defines a contract for checking signatures created by a Signer.
+type Verifier interface {
+	Verify(signedData []byte, signature []byte) error
+}
+
+// NewVerifier creates the verifier matching the type of the public key.
+func NewVerifier(publicKey crypto.PublicKey, params SignatureParameters) (Verifier, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return NewRSAVerifier(key, params)
+	case *ecdsa.PublicKey:
+		return NewECCVerifier(key, params)
+	case ed25519.PublicKey:
+		return NewEd25519Verifier(key)
+	default:
+		return nil, errors.New("verifier: unsupported public key type")
+	}
+}
+
+// ParsePublicKey decodes a PEM encoded SubjectPublicKeyInfo, as written by
+// ECCMarshaler.EncodePublic, RSAMarshaler.MarshalPublic and Ed25519Marshaler.EncodePublic.
+func ParsePublicKey(publicKeyBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(publicKeyBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found in public key")
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// RSAVerifier verifies RSA-PSS or PKCS#1 v1.5 signatures, over SHA-256 unless
+// the signature parameters select another digest.
+type RSAVerifier struct {
+	publicKey *rsa.PublicKey
+	params    SignatureParameters
+}
+
+// NewRSAVerifier creates a new RSAVerifier for the given public key.
+func NewRSAVerifier(publicKey *rsa.PublicKey, params SignatureParameters) (*RSAVerifier, error) {
+	if publicKey == nil {
+		return nil, errors.New("rsa verifier: public key is missing")
+	}
+
+	return &RSAVerifier{publicKey: publicKey, params: params.rsaParameters()}, nil
+}
+
+// Verify checks the RSA signature of the signed data.
+func (v *RSAVerifier) Verify(signedData []byte, signature []byte) error {
+	digest, err := hashData(v.params.Hash, signedData)
+	if err != nil {
+		return err
+	}
+
+	if v.params.Padding == RSAPaddingPKCS1v15 {
+		err = rsa.VerifyPKCS1v15(v.publicKey, v.params.Hash, digest, signature)
+	} else {
+		err = rsa.VerifyPSS(v.publicKey, v.params.Hash, digest, signature, &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthAuto,
+		})
+	}
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// ECCVerifier verifies ECDSA signatures, ASN.1 DER or P1363 (r||s) encoded.
+type ECCVerifier struct {
+	publicKey *ecdsa.PublicKey
+	hash      crypto.Hash
+}
+
+// NewECCVerifier creates a new ECCVerifier for the given public key.
+func NewECCVerifier(publicKey *ecdsa.PublicKey, params SignatureParameters) (*ECCVerifier, error) {
+	if publicKey == nil || publicKey.Curve == nil {
+		return nil, errors.New("ecc verifier: public key is missing")
+	}
+
+	return &ECCVerifier{
+		publicKey: publicKey,
+		hash:      params.eccHash(publicKey.Curve),
+	}, nil
+}
+
+// Verify checks the ECDSA signature of the signed data.
+func (v *ECCVerifier) Verify(signedData []byte, signature []byte) error {
+	digest, err := hashData(v.hash, signedData)
+	if err != nil {
+		return err
+	}
+
+	r, s, err := decodeECDSASignature(v.publicKey.Curve, signature)
+	if err != nil {
+		return err
+	}
+
+	if !ecdsa.Verify(v.publicKey, digest, r, s) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// Ed25519Verifier verifies Ed25519 signatures.
+type Ed25519Verifier struct {
+	publicKey ed25519.PublicKey
+}
+
+// NewEd25519Verifier creates a new Ed25519Verifier for the given public key.
+func NewEd25519Verifier(publicKey ed25519.PublicKey) (*Ed25519Verifier, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, errors.New("ed25519 verifier: public key is missing")
+	}
+
+	return &Ed25519Verifier{publicKey: publicKey}, nil
+}
+
+// Verify checks the Ed25519 signature of the signed data.
+func (v *Ed25519Verifier) Verify(signedData []byte, signature []byte) error {
+	if !ed25519.Verify(v.publicKey, signedData, signature) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}